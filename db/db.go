@@ -1,13 +1,14 @@
 package db
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"os"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type PostgresDB struct {
@@ -33,20 +34,26 @@ func createDB(secrets map[string]string) *sqlx.DB {
 
 	connectionString := fmt.Sprintf("host=%s port=%s user=%s password=%s",
 		dbHost, dbPort, secrets["username"], secrets["password"])
+	ssl, err := sslParams()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	connectionString += ssl + timeoutParams()
 
-	db, err := sqlx.Connect("postgres", connectionString)
+	connector, err := pq.NewConnector(connectionString)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-	// Create customers table
-	createTableSQL := `
-	CREATE TABLE customers (
-	    id SERIAL PRIMARY KEY,
-	    name VARCHAR(255),
-	    email VARCHAR(255) UNIQUE,
-	    address VARCHAR(255)
-	);
-	`
-	_, err = db.Exec(createTableSQL)
+	connector.Dialer(newDialer())
+
+	db := sqlx.NewDb(sql.OpenDB(connector), "postgres")
+	if err := waitForDB(db); err != nil {
+		log.Fatal(err.Error())
+	}
+	configurePool(db)
+
+	if err := migrate(db); err != nil {
+		log.Fatal(err.Error())
+	}
 	return db
 }
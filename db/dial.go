@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTCPKeepAlive = 15 * time.Second
+
+func envDuration(name string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// timeoutDialer dials Postgres with TCP keepalives and, when readTimeout is
+// set, a per-read deadline, so a silently dropped connection fails within
+// seconds instead of waiting on the OS TCP timeout.
+type timeoutDialer struct {
+	dialer      net.Dialer
+	readTimeout time.Duration
+}
+
+// newDialer reads DB_TCP_KEEPALIVE and DB_READ_TIMEOUT. The read timeout
+// bounds every wait for the server, so it must exceed the longest query,
+// i.e. DB_STATEMENT_TIMEOUT when that is set.
+func newDialer() *timeoutDialer {
+	return &timeoutDialer{
+		dialer:      net.Dialer{KeepAlive: envDuration("DB_TCP_KEEPALIVE", defaultTCPKeepAlive)},
+		readTimeout: envDuration("DB_READ_TIMEOUT", 0),
+	}
+}
+
+func (d *timeoutDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d *timeoutDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, address)
+}
+
+func (d *timeoutDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, address)
+	if err != nil || d.readTimeout <= 0 {
+		return conn, err
+	}
+	return &deadlineConn{Conn: conn, timeout: d.readTimeout}, nil
+}
+
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// timeoutParams adds connect_timeout and statement_timeout to the
+// connection string from DB_CONNECT_TIMEOUT and DB_STATEMENT_TIMEOUT.
+func timeoutParams() string {
+	params := make([]string, 0)
+	if t := envDuration("DB_CONNECT_TIMEOUT", 0); t > 0 {
+		seconds := int((t + time.Second - 1) / time.Second)
+		params = append(params, "connect_timeout="+strconv.Itoa(seconds))
+	}
+	if t := envDuration("DB_STATEMENT_TIMEOUT", 0); t > 0 {
+		params = append(params, "statement_timeout="+strconv.FormatInt(t.Milliseconds(), 10))
+	}
+	if len(params) == 0 {
+		return ""
+	}
+	return " " + strings.Join(params, " ")
+}
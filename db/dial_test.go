@@ -0,0 +1,65 @@
+package db
+
+import (
+	"database/sql"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestSilentServerIsDetectedByTheReadTimeout(t *testing.T) {
+	// This listener accepts connections and never answers, like a server
+	// behind a dropped network path.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	t.Setenv("DB_READ_TIMEOUT", "200ms")
+
+	addr := listener.Addr().(*net.TCPAddr)
+	connector, err := pq.NewConnector("host=127.0.0.1 port=" + strconv.Itoa(addr.Port) + " sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector.Dialer(newDialer())
+	conn := sql.OpenDB(connector)
+	defer conn.Close()
+
+	start := time.Now()
+	err = conn.Ping()
+	if err == nil {
+		t.Fatal("ping against a silent server succeeded")
+	}
+	if !IsUnavailable(err) {
+		t.Errorf("%v is not reported as unavailable", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("the dead connection took %s to detect", elapsed)
+	}
+}
+
+func TestTimeoutParams(t *testing.T) {
+	t.Setenv("DB_CONNECT_TIMEOUT", "1500ms")
+	t.Setenv("DB_STATEMENT_TIMEOUT", "30s")
+	if got, want := timeoutParams(), " connect_timeout=2 statement_timeout=30000"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	t.Setenv("DB_CONNECT_TIMEOUT", "")
+	t.Setenv("DB_STATEMENT_TIMEOUT", "")
+	if got := timeoutParams(); got != "" {
+		t.Errorf("got %q without timeouts set", got)
+	}
+}
@@ -0,0 +1,24 @@
+package db
+
+import "context"
+
+func (p *PostgresDB) Ping(ctx context.Context) error {
+	return p.DB.PingContext(ctx)
+}
+
+// CheckWritable confirms the server accepts writes by writing to a temporary
+// table inside a transaction that is always rolled back. A ping succeeds
+// against a primary in recovery or a read-only replica; this does not.
+func (p *PostgresDB) CheckWritable(ctx context.Context) error {
+	tx, err := p.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `CREATE TEMP TABLE health_write_check (ok BOOLEAN) ON COMMIT DROP`); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO health_write_check VALUES (true)`)
+	return err
+}
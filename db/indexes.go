@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	indexWhere = regexp.MustCompile(`(?is)^WHERE\s+(.+)$`)
+	indexHead  = regexp.MustCompile(`(?i)^([a-z_][a-z0-9_]*)\s+ON\s+([a-z_][a-z0-9_]*)\s*(?:USING\s+([a-z]+)\s*)?\(`)
+)
+
+// indexTables are the tables EXTRA_INDEXES may index.
+var indexTables = map[string]bool{
+	"customers":           true,
+	"customer_events":     true,
+	"customer_audit":      true,
+	"customer_tombstones": true,
+	"customer_syncs":      true,
+	"saved_queries":       true,
+}
+
+var indexMethods = map[string]bool{"btree": true, "hash": true, "gist": true, "spgist": true, "gin": true, "brin": true}
+
+// extraIndex is a deployment-specific index from EXTRA_INDEXES.
+type extraIndex struct {
+	name, definition string
+}
+
+// extraIndexes parses EXTRA_INDEXES, a semicolon separated list of index
+// definitions without the CREATE INDEX prefix, such as
+// "customers_partner_owner_idx ON customers (partner, lower(owner)) WHERE partner IS NOT NULL".
+// The table must be one of indexTables and the method, if given, a
+// built-in one. The definition is rebuilt from the parsed parts.
+func extraIndexes() ([]extraIndex, error) {
+	indexes := make([]extraIndex, 0)
+	for _, def := range strings.Split(os.Getenv("EXTRA_INDEXES"), ";") {
+		def = strings.TrimSpace(def)
+		if len(def) == 0 {
+			continue
+		}
+		index, err := parseExtraIndex(def)
+		if err != nil {
+			return nil, fmt.Errorf("EXTRA_INDEXES entry %q: %w", def, err)
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+func parseExtraIndex(def string) (extraIndex, error) {
+	if strings.Contains(def, "--") || strings.Contains(def, "/*") {
+		return extraIndex{}, fmt.Errorf("comments are not allowed")
+	}
+	head := indexHead.FindStringSubmatch(def)
+	if head == nil {
+		return extraIndex{}, fmt.Errorf(`must look like "<name> ON <table> [USING <method>] (...) [WHERE ...]"`)
+	}
+	name, table, method := strings.ToLower(head[1]), strings.ToLower(head[2]), strings.ToLower(head[3])
+	if !indexTables[table] {
+		return extraIndex{}, fmt.Errorf("unknown table %q", table)
+	}
+	if len(method) != 0 && !indexMethods[method] {
+		return extraIndex{}, fmt.Errorf("unknown index method %q", method)
+	}
+
+	// The key list runs to the parenthesis closing the one head ends on.
+	rest := def[len(head[0]):]
+	depth, end := 1, -1
+	for i, r := range rest {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return extraIndex{}, fmt.Errorf("unbalanced parentheses")
+	}
+	keys := strings.TrimSpace(rest[:end])
+	if len(keys) == 0 {
+		return extraIndex{}, fmt.Errorf("no columns to index")
+	}
+
+	definition := name + " ON " + table
+	if len(method) != 0 {
+		definition += " USING " + method
+	}
+	definition += " (" + keys + ")"
+
+	if where := strings.TrimSpace(rest[end+1:]); len(where) != 0 {
+		clause := indexWhere.FindStringSubmatch(where)
+		if clause == nil {
+			return extraIndex{}, fmt.Errorf("only a WHERE clause may follow the columns")
+		}
+		definition += " WHERE " + clause[1]
+	}
+	return extraIndex{name: name, definition: definition}, nil
+}
+
+// applyExtraIndexes creates the configured indexes that do not exist yet.
+// They are built concurrently so a large table stays writable, on a
+// connection without the statement timeout. A build that failed part way
+// leaves an invalid index behind, which is dropped and rebuilt. An existing
+// index is never redefined; rename it to change its definition.
+func applyExtraIndexes(db *sqlx.DB) error {
+	indexes, err := extraIndexes()
+	if err != nil || len(indexes) == 0 {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SET statement_timeout = 0`); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `RESET statement_timeout`)
+
+	for _, index := range indexes {
+		var valid []bool
+		err := conn.SelectContext(ctx, &valid, `SELECT i.indisvalid FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		WHERE c.relname = $1 AND c.relnamespace = current_schema()::regnamespace`, index.name)
+		if err != nil {
+			return err
+		}
+		if len(valid) == 1 && valid[0] {
+			continue
+		}
+		if len(valid) == 1 {
+			log.Printf("rebuilding invalid index %s", index.name)
+			if _, err := conn.ExecContext(ctx, `DROP INDEX CONCURRENTLY `+index.name); err != nil {
+				return err
+			}
+		}
+
+		log.Printf("creating index %s", index.name)
+		if _, err := conn.ExecContext(ctx, `CREATE INDEX CONCURRENTLY `+index.definition); err != nil {
+			return fmt.Errorf("creating index %s: %w", index.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package db
+
+import "testing"
+
+func TestParseExtraIndex(t *testing.T) {
+	cases := []struct {
+		def, want string
+	}{
+		{
+			def:  "customers_partner_owner_idx ON customers (partner, lower(owner)) WHERE partner IS NOT NULL",
+			want: "customers_partner_owner_idx ON customers (partner, lower(owner)) WHERE partner IS NOT NULL",
+		},
+		{
+			def:  "customers_tags_idx on Customers using GIN (tags)",
+			want: "customers_tags_idx ON customers USING gin (tags)",
+		},
+		{
+			def:  "customers_live_idx ON customers ((lower(email))) WHERE (deleted_at IS NULL)",
+			want: "customers_live_idx ON customers ((lower(email))) WHERE (deleted_at IS NULL)",
+		},
+	}
+	for _, c := range cases {
+		index, err := parseExtraIndex(c.def)
+		if err != nil {
+			t.Errorf("%q: %v", c.def, err)
+			continue
+		}
+		if index.definition != c.want {
+			t.Errorf("%q: got %q, want %q", c.def, index.definition, c.want)
+		}
+	}
+}
+
+func TestParseExtraIndexRejectsUnknownTables(t *testing.T) {
+	for _, def := range []string{
+		"users_idx ON users (id)",
+		"customers_idx ON customers, pg_authid (id)",
+		"customers_idx ON customers (id) -- comment",
+		"customers_idx ON customers (id) INCLUDE (name)",
+		"customers_idx ON customers (lower(email)",
+		"customers_idx ON customers USING evil (id)",
+	} {
+		if _, err := parseExtraIndex(def); err == nil {
+			t.Errorf("%q was accepted", def)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+// lockKey maps a job name onto the bigint key space used by advisory locks.
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// TryAdvisoryLock takes the session-level advisory lock for name without
+// waiting. The lock lives on a dedicated connection, so the returned release
+// func must be called to unlock it and hand the connection back to the pool.
+func (p *PostgresDB) TryAdvisoryLock(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := p.DB.Connx(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	key := lockKey(name)
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, false, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	release := func() {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+		conn.Close()
+	}
+	return release, true, nil
+}
+
+// RunExclusive runs fn only if no other instance currently holds the lock for
+// name. It reports whether fn ran.
+func (p *PostgresDB) RunExclusive(ctx context.Context, name string, fn func() error) (bool, error) {
+	release, acquired, err := p.TryAdvisoryLock(ctx, name)
+	if err != nil || !acquired {
+		return false, err
+	}
+	defer release()
+
+	return true, fn()
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// testURL is TEST_DATABASE_URL; tests that need a database skip without it.
+func testURL(t *testing.T) string {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if len(url) == 0 {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	return url
+}
+
+// testDB connects to the database in TEST_DATABASE_URL.
+func testDB(t *testing.T) *PostgresDB {
+	t.Helper()
+	conn, err := sqlx.Connect("postgres", testURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &PostgresDB{DB: conn}
+}
+
+func TestAdvisoryLockIsExclusiveUntilReleased(t *testing.T) {
+	p := testDB(t)
+	ctx := context.Background()
+
+	release, ok, err := p.TryAdvisoryLock(ctx, "test-job")
+	if err != nil || !ok {
+		t.Fatalf("first acquire: %v, %v", ok, err)
+	}
+	if _, ok, err := p.TryAdvisoryLock(ctx, "test-job"); err != nil || ok {
+		t.Fatalf("second acquire while held: got %v, %v, want refused", ok, err)
+	}
+	ran, err := p.RunExclusive(ctx, "test-job", func() error { return nil })
+	if err != nil || ran {
+		t.Errorf("RunExclusive while held: ran %v, %v", ran, err)
+	}
+	other, ok, err := p.TryAdvisoryLock(ctx, "other-job")
+	if err != nil || !ok {
+		t.Fatalf("another name was locked too: %v", err)
+	}
+	other()
+
+	release()
+	ran, err = p.RunExclusive(ctx, "test-job", func() error { return nil })
+	if err != nil || !ran {
+		t.Errorf("RunExclusive after release: ran %v, %v", ran, err)
+	}
+}
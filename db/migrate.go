@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrations are applied in order and recorded in schema_migrations, with
+// migration i+1 being migrations[i]. Only ever append to this list. The
+// early entries are idempotent because they predate version tracking.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS customers (
+	    id SERIAL PRIMARY KEY,
+	    name VARCHAR(255),
+	    email VARCHAR(255) UNIQUE,
+	    address VARCHAR(255)
+	)`,
+	`ALTER TABLE customers ADD COLUMN IF NOT EXISTS owner VARCHAR(255) NOT NULL DEFAULT ''`,
+	`ALTER TABLE customers ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+	`ALTER TABLE customers ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+	`ALTER TABLE customers ADD COLUMN IF NOT EXISTS partner VARCHAR(255) NOT NULL DEFAULT ''`,
+	`ALTER TABLE customers ADD COLUMN IF NOT EXISTS client_reference_id VARCHAR(255)`,
+	`ALTER TABLE customers ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}'`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS customers_partner_reference_idx ON customers (partner, client_reference_id)`,
+	`CREATE TABLE IF NOT EXISTS customer_audit (
+	    id SERIAL PRIMARY KEY,
+	    customer_id INTEGER NOT NULL,
+	    action VARCHAR(64) NOT NULL,
+	    detail JSONB,
+	    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS customer_tombstones (
+	    customer_id INTEGER PRIMARY KEY,
+	    deleted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE customer_events (
+	    seq BIGSERIAL PRIMARY KEY,
+	    type VARCHAR(64) NOT NULL,
+	    customer_id INTEGER NOT NULL,
+	    payload JSONB NOT NULL,
+	    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	// Every change to customers is appended from a trigger, so each event
+	// commits atomically with its mutation whichever code path made it.
+	`CREATE FUNCTION record_customer_event() RETURNS trigger AS $$
+	BEGIN
+	    IF TG_OP = 'DELETE' THEN
+	        INSERT INTO customer_events (type, customer_id, payload) VALUES ('customer.deleted', OLD.id, to_jsonb(OLD));
+	        RETURN OLD;
+	    END IF;
+	    INSERT INTO customer_events (type, customer_id, payload)
+	    VALUES (CASE TG_OP WHEN 'INSERT' THEN 'customer.created' ELSE 'customer.updated' END, NEW.id, to_jsonb(NEW));
+	    RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql`,
+	`CREATE TRIGGER customers_record_event AFTER INSERT OR UPDATE OR DELETE ON customers
+	    FOR EACH ROW EXECUTE FUNCTION record_customer_event()`,
+	`CREATE FUNCTION reject_event_change() RETURNS trigger AS $$
+	BEGIN
+	    RAISE EXCEPTION 'customer_events is append-only';
+	END;
+	$$ LANGUAGE plpgsql`,
+	`CREATE TRIGGER customer_events_append_only BEFORE UPDATE OR DELETE ON customer_events
+	    FOR EACH ROW EXECUTE FUNCTION reject_event_change()`,
+	`CREATE TABLE saved_queries (
+	    id SERIAL PRIMARY KEY,
+	    name VARCHAR(255) NOT NULL UNIQUE,
+	    filters JSONB NOT NULL,
+	    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	// A sequence hands out event seqs in insert order, but transactions
+	// commit in any order, so a reader paging by seq could pass a seq that
+	// commits later. Each event records the transaction that wrote it:
+	// readers only take events of transactions older than any still
+	// running, ordered by transaction and then seq, and that part of the
+	// log never changes. Events logged before this migration all count as
+	// transaction 0.
+	`ALTER TABLE customer_events ADD COLUMN xid xid8 NOT NULL DEFAULT '0'`,
+	`ALTER TABLE customer_events ALTER COLUMN xid SET DEFAULT pg_current_xact_id()`,
+	`CREATE INDEX customer_events_xid_seq_idx ON customer_events (xid, seq)`,
+	// Deferrable so a restore can insert children before their parents.
+	`ALTER TABLE customers ADD COLUMN parent_id INTEGER
+	    CONSTRAINT customers_parent_id_fkey REFERENCES customers (id) DEFERRABLE INITIALLY IMMEDIATE`,
+	`CREATE INDEX customers_parent_id_idx ON customers (parent_id)`,
+	`ALTER TABLE customer_audit ADD COLUMN actor VARCHAR(255) NOT NULL DEFAULT 'system'`,
+	// Bulk operations tag their events with the app.tx_id setting, and
+	// updates keep the row as it was, so a whole batch can be undone.
+	`ALTER TABLE customer_events ADD COLUMN tx_id VARCHAR(64), ADD COLUMN previous JSONB`,
+	`CREATE INDEX customer_events_tx_id_idx ON customer_events (tx_id) WHERE tx_id IS NOT NULL`,
+	`CREATE OR REPLACE FUNCTION record_customer_event() RETURNS trigger AS $$
+	DECLARE
+	    tx_id VARCHAR(64) := NULLIF(current_setting('app.tx_id', true), '');
+	BEGIN
+	    IF TG_OP = 'DELETE' THEN
+	        INSERT INTO customer_events (type, customer_id, payload, tx_id)
+	        VALUES ('customer.deleted', OLD.id, to_jsonb(OLD), tx_id);
+	        RETURN OLD;
+	    ELSIF TG_OP = 'UPDATE' THEN
+	        INSERT INTO customer_events (type, customer_id, payload, previous, tx_id)
+	        VALUES ('customer.updated', NEW.id, to_jsonb(NEW), to_jsonb(OLD), tx_id);
+	        RETURN NEW;
+	    END IF;
+	    INSERT INTO customer_events (type, customer_id, payload, tx_id)
+	    VALUES ('customer.created', NEW.id, to_jsonb(NEW), tx_id);
+	    RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql`,
+	// When each downstream integration last synced a customer. A customer
+	// is unsynced for an integration while its updated_at is newer.
+	`CREATE TABLE customer_syncs (
+	    customer_id INTEGER NOT NULL REFERENCES customers (id) ON DELETE CASCADE,
+	    integration VARCHAR(64) NOT NULL,
+	    synced_at TIMESTAMPTZ NOT NULL,
+	    PRIMARY KEY (integration, customer_id)
+	)`,
+	`ALTER TABLE customers ADD COLUMN lat DOUBLE PRECISION, ADD COLUMN lng DOUBLE PRECISION,
+	    ADD CONSTRAINT customers_coordinates_check CHECK (
+	        (lat IS NULL) = (lng IS NULL) AND lat BETWEEN -90 AND 90 AND lng BETWEEN -180 AND 180)`,
+	// Sync soft-deletes the customers missing from a partner's payload. The
+	// trigger logs setting deleted_at as a deletion and clearing it as a
+	// creation, both with the before-image so they can be undone.
+	`ALTER TABLE customers ADD COLUMN deleted_at TIMESTAMPTZ`,
+	`CREATE OR REPLACE FUNCTION record_customer_event() RETURNS trigger AS $$
+	DECLARE
+	    tx_id VARCHAR(64) := NULLIF(current_setting('app.tx_id', true), '');
+	BEGIN
+	    IF TG_OP = 'DELETE' THEN
+	        INSERT INTO customer_events (type, customer_id, payload, tx_id)
+	        VALUES ('customer.deleted', OLD.id, to_jsonb(OLD), tx_id);
+	        RETURN OLD;
+	    ELSIF TG_OP = 'UPDATE' THEN
+	        INSERT INTO customer_events (type, customer_id, payload, previous, tx_id)
+	        VALUES (CASE
+	            WHEN OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN 'customer.deleted'
+	            WHEN OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN 'customer.created'
+	            ELSE 'customer.updated'
+	        END, NEW.id, to_jsonb(NEW), to_jsonb(OLD), tx_id);
+	        RETURN NEW;
+	    END IF;
+	    INSERT INTO customer_events (type, customer_id, payload, tx_id)
+	    VALUES ('customer.created', NEW.id, to_jsonb(NEW), tx_id);
+	    RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql`,
+	// Active customers are what nearly every query reads.
+	`CREATE INDEX customers_active_idx ON customers (id) WHERE deleted_at IS NULL`,
+	// Requests set app.correlation_id on their transactions, so each event
+	// records the request that caused it.
+	`ALTER TABLE customer_events ADD COLUMN correlation_id VARCHAR(64) DEFAULT NULLIF(current_setting('app.correlation_id', true), '')`,
+	// Restores, syncs and undos set app.origin, so replays can tell their
+	// events from plain writes.
+	`ALTER TABLE customer_events ADD COLUMN origin VARCHAR(16) DEFAULT NULLIF(current_setting('app.origin', true), '')`,
+	// Saved queries belong to the partner that saved them. Queries saved
+	// before have no owner, so no caller can reach them.
+	`ALTER TABLE saved_queries ADD COLUMN owner VARCHAR(255) NOT NULL DEFAULT ''`,
+	`ALTER TABLE saved_queries DROP CONSTRAINT saved_queries_name_key,
+	    ADD CONSTRAINT saved_queries_owner_name_key UNIQUE (owner, name)`,
+	// The trash lists deleted customers newest deletion first.
+	`CREATE INDEX customers_deleted_idx ON customers (deleted_at DESC, id DESC) WHERE deleted_at IS NOT NULL`,
+}
+
+func migrate(db *sqlx.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+	    version INTEGER PRIMARY KEY,
+	    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := db.Get(&current, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`); err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		if err := applyMigration(db, i+1, migrations[i]); err != nil {
+			return err
+		}
+	}
+	return applyExtraIndexes(db)
+}
+
+func applyMigration(db *sqlx.DB, version int, stmt string) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(stmt); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Migrate applies any pending migrations. GetDB runs it on startup.
+func (p *PostgresDB) Migrate() error {
+	return migrate(p.DB)
+}
+
+// MigrationVersion returns the latest applied migration, or 0 if none.
+func (p *PostgresDB) MigrationVersion(ctx context.Context) (int, error) {
+	var version int
+	err := p.DB.GetContext(ctx, &version, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+	return version, err
+}
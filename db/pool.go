@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultMaxIdleConns = 2
+	warmupTimeout       = 10 * time.Second
+)
+
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// configurePool applies DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS and, when
+// DB_POOL_WARMUP=true, opens the idle connections up front so the first
+// requests after startup do not pay for connection setup.
+func configurePool(db *sqlx.DB) {
+	if maxOpen := envInt("DB_MAX_OPEN_CONNS", 0); maxOpen > 0 {
+		db.SetMaxOpenConns(maxOpen)
+	}
+	maxIdle := envInt("DB_MAX_IDLE_CONNS", defaultMaxIdleConns)
+	db.SetMaxIdleConns(maxIdle)
+
+	if os.Getenv("DB_POOL_WARMUP") != "true" {
+		return
+	}
+	if err := warmPool(db, maxIdle); err != nil {
+		log.Printf("warming connection pool: %v", err)
+	}
+}
+
+// warmPool checks out n connections at once, pings each, then returns them
+// all to the pool, leaving n idle connections ready for use.
+func warmPool(db *sqlx.DB, n int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), warmupTimeout)
+	defer cancel()
+
+	conns := make([]*sqlx.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		conn, err := db.Connx(ctx)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, conn)
+		if err := conn.PingContext(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestWarmupLeavesTheIdleConnectionsOpen(t *testing.T) {
+	conn, err := sqlx.Open("postgres", testURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("DB_MAX_IDLE_CONNS", "3")
+	t.Setenv("DB_POOL_WARMUP", "true")
+
+	configurePool(conn)
+	if stats := conn.Stats(); stats.Idle != 3 || stats.InUse != 0 {
+		t.Errorf("after warmup the pool has %d idle and %d in use, want 3 idle", stats.Idle, stats.InUse)
+	}
+}
+
+func TestPoolIsNotWarmedByDefault(t *testing.T) {
+	// Nothing listens here; opening the pool never dials.
+	conn, err := sqlx.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("DB_POOL_WARMUP", "")
+
+	configurePool(conn)
+	if open := conn.Stats().OpenConnections; open != 0 {
+		t.Errorf("%d connections opened without DB_POOL_WARMUP", open)
+	}
+}
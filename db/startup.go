@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	defaultStartupAttempts = 10
+	defaultStartupTimeout  = time.Minute
+	startupInitialBackoff  = 500 * time.Millisecond
+	startupMaxBackoff      = 10 * time.Second
+)
+
+// waitForDB pings until the database answers, so the service can start
+// before Postgres is ready. It retries with exponential backoff up to
+// DB_STARTUP_ATTEMPTS times (default 10) within DB_STARTUP_TIMEOUT
+// (default 1m) and returns the last error if the database never comes up.
+func waitForDB(db *sqlx.DB) error {
+	attempts := envInt("DB_STARTUP_ATTEMPTS", defaultStartupAttempts)
+	if attempts < 1 {
+		attempts = 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("DB_STARTUP_TIMEOUT", defaultStartupTimeout))
+	defer cancel()
+
+	backoff := startupInitialBackoff
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = db.PingContext(ctx); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+
+		log.Printf("database not ready (attempt %d/%d), retrying in %s: %v", attempt, attempts, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("database not ready within startup timeout: %w", err)
+		}
+		if backoff *= 2; backoff > startupMaxBackoff {
+			backoff = startupMaxBackoff
+		}
+	}
+	return fmt.Errorf("database not ready after %d attempts: %w", attempts, err)
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// lateConnector refuses the first failures connections, like a database
+// that is still starting.
+type lateConnector struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (l *lateConnector) Connect(context.Context) (driver.Conn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.attempts++; l.attempts <= l.failures {
+		return nil, errors.New("the database system is starting up")
+	}
+	return readyConn{}, nil
+}
+
+func (l *lateConnector) Driver() driver.Driver { return nil }
+
+type readyConn struct{}
+
+func (readyConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (readyConn) Close() error                        { return nil }
+func (readyConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func TestWaitForDBRetriesUntilTheDatabaseIsUp(t *testing.T) {
+	connector := &lateConnector{failures: 2}
+	conn := sqlx.NewDb(sql.OpenDB(connector), "postgres")
+	defer conn.Close()
+	t.Setenv("DB_STARTUP_ATTEMPTS", "5")
+
+	if err := waitForDB(conn); err != nil {
+		t.Fatal(err)
+	}
+	if connector.attempts != 3 {
+		t.Errorf("connected on attempt %d, want 3", connector.attempts)
+	}
+}
+
+func TestWaitForDBGivesUpAfterTheLastAttempt(t *testing.T) {
+	connector := &lateConnector{failures: 100}
+	conn := sqlx.NewDb(sql.OpenDB(connector), "postgres")
+	defer conn.Close()
+	t.Setenv("DB_STARTUP_ATTEMPTS", "2")
+
+	if err := waitForDB(conn); err == nil {
+		t.Fatal("connected to a database that never came up")
+	}
+	if connector.attempts != 2 {
+		t.Errorf("tried %d times, want 2", connector.attempts)
+	}
+}
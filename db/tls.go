@@ -0,0 +1,35 @@
+package db
+
+import (
+	"fmt"
+	"os"
+)
+
+// sslModes are the sslmode values lib/pq understands, mapped to whether
+// they encrypt the connection.
+var sslModes = map[string]bool{
+	"disable":     false,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// sslParams adds sslmode from DB_SSLMODE to the connection string, leaving
+// the driver default (require) when unset. With APP_ENV=production an
+// unencrypted mode is refused so the database is never reached in plaintext
+// by mistake.
+func sslParams() (string, error) {
+	mode := os.Getenv("DB_SSLMODE")
+	if len(mode) == 0 {
+		return "", nil
+	}
+
+	encrypted, ok := sslModes[mode]
+	if !ok {
+		return "", fmt.Errorf("unsupported DB_SSLMODE %q: use disable, require, verify-ca or verify-full", mode)
+	}
+	if !encrypted && os.Getenv("APP_ENV") == "production" {
+		return "", fmt.Errorf("DB_SSLMODE=%s is not allowed when APP_ENV=production: use at least require", mode)
+	}
+	return " sslmode=" + mode, nil
+}
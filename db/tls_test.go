@@ -0,0 +1,30 @@
+package db
+
+import "testing"
+
+func TestPlaintextIsRefusedInProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("DB_SSLMODE", "disable")
+	if _, err := sslParams(); err == nil {
+		t.Error("sslmode=disable was accepted in production")
+	}
+
+	t.Setenv("DB_SSLMODE", "verify-full")
+	if params, err := sslParams(); err != nil || params != " sslmode=verify-full" {
+		t.Errorf("verify-full in production: got %q, %v", params, err)
+	}
+}
+
+func TestSSLModeOutsideProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "development")
+	for mode, want := range map[string]string{"": "", "disable": " sslmode=disable", "require": " sslmode=require"} {
+		t.Setenv("DB_SSLMODE", mode)
+		if params, err := sslParams(); err != nil || params != want {
+			t.Errorf("DB_SSLMODE=%q: got %q, %v, want %q", mode, params, err, want)
+		}
+	}
+	t.Setenv("DB_SSLMODE", "prefer")
+	if _, err := sslParams(); err == nil {
+		t.Error("an unsupported sslmode was accepted")
+	}
+}
@@ -14,12 +14,58 @@ func main() {
 
 	a := service.GetApp(db)
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(service.Correlation, service.AccessLog(), gin.Recovery(), service.CORS())
+	r.Use(service.Timezone, service.JSONNaming, a.Bulkhead)
+
+	r.GET("/health", a.HealthHandler)
+	r.GET("/version", a.VersionHandler)
+	r.GET("/metrics", a.MetricsHandler)
 
 	r.POST("/customers", a.PostHandler)
+	r.POST("/customers/batch", service.StreamProgress, a.BatchPostHandler)
+	r.POST("/customers/import", service.StreamProgress, a.ImportHandler)
+	r.POST("/customers/batch-get", a.BatchGetHandler)
+	r.POST("/customers/reassign", a.ReassignHandler)
+	r.POST("/customers/sync", service.StreamProgress, a.SyncHandler)
+	r.POST("/customers/bulk-delete", a.BulkDeleteHandler)
+	r.POST("/customers/bulk-patch", a.BulkPatchHandler)
+	r.POST("/customers/bulk-restore", a.RequireAdmin, a.BulkRestoreHandler)
+	r.POST("/customers/transactions/:txId/undo", a.RequireAdmin, a.UndoHandler)
+	r.POST("/customers/exports", a.ExportPostHandler)
+	r.GET("/customers/exports/:jobId", a.ExportGetHandler)
+	r.GET("/customers/exports/:jobId/download", a.ExportDownloadHandler)
+	r.GET("/customers", a.ListHandler)
+	r.HEAD("/customers", a.ListHandler)
+	r.GET("/customers/schema", a.SchemaHandler)
+	r.GET("/customers/quality", a.QualityHandler)
+	r.GET("/customers/geo.json", a.GeoJSONHandler)
+	r.GET("/customers/events/log", a.EventsHandler)
+	r.GET("/customers/unsynced", a.UnsyncedHandler)
+	r.GET("/customers/trash", a.RequireAdmin, a.TrashHandler)
 	r.GET("/customers/:customerId", a.GetHandler)
-	r.PUT("/customers/:customerId", a.PutHandler)
-	r.DELETE("/customers/:customerId", a.DeleteHandler)
+	r.GET("/customers/:customerId/watch", a.WatchHandler)
+	r.PUT("/customers/ensure", a.EnsureHandler)
+	r.PUT("/customers/:customerId", a.SerializeCustomer, a.PutHandler)
+	r.DELETE("/customers/:customerId", a.SerializeCustomer, a.DeleteHandler)
+	r.POST("/customers/:customerId/tags", a.SerializeCustomer, a.TagsHandler)
+	r.POST("/customers/:customerId/compare", a.CompareHandler)
+	r.PUT("/customers/:customerId/parent", a.SerializeCustomer, a.ParentHandler)
+	r.GET("/customers/:customerId/children", a.ChildrenHandler)
+	r.POST("/customers/:customerId/geocode", a.SerializeCustomer, a.GeocodeHandler)
+	r.POST("/customers/:customerId/synced", a.SyncedHandler)
+
+	r.POST("/queries", a.QueryPostHandler)
+	r.GET("/queries/:queryId", a.QueryGetHandler)
+
+	admin := r.Group("/admin", a.RequireAdmin)
+	admin.POST("/customers/dedup", a.DedupHandler)
+	admin.POST("/customers/snapshot", a.SnapshotHandler)
+	admin.POST("/customers/restore", a.RestoreHandler)
+	admin.GET("/explain", a.ExplainHandler)
+	admin.POST("/maintenance/vacuum", a.VacuumHandler)
+	admin.POST("/webhooks/replay", a.ReplayHandler)
+	admin.GET("/maintenance/bloat", a.BloatHandler)
 
 	r.Run("localhost:8080")
 }
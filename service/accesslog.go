@@ -0,0 +1,55 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultSlowRequest = time.Second
+
+// AccessLog logs requests in gin's format, sampling successes. Set
+// LOG_SAMPLE_RATE=N to log one in N 2xx responses; non-2xx responses and
+// requests slower than LOG_SLOW_THRESHOLD (default 1s) are always logged.
+func AccessLog() gin.HandlerFunc {
+	rate, err := strconv.ParseUint(os.Getenv("LOG_SAMPLE_RATE"), 10, 64)
+	if err != nil || rate == 0 {
+		rate = 1
+	}
+	slow, err := time.ParseDuration(os.Getenv("LOG_SLOW_THRESHOLD"))
+	if err != nil || slow <= 0 {
+		slow = defaultSlowRequest
+	}
+
+	var successes uint64
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		if raw := c.Request.URL.RawQuery; len(raw) != 0 {
+			path += "?" + raw
+		}
+
+		c.Next()
+
+		latency := time.Since(start)
+		status := c.Writer.Status()
+		ok := status >= 200 && status < 300
+		if ok && latency < slow && atomic.AddUint64(&successes, 1)%rate != 0 {
+			return
+		}
+
+		fmt.Fprintf(gin.DefaultWriter, "[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			start.Format("2006/01/02 - 15:04:05"),
+			status,
+			latency,
+			c.ClientIP(),
+			c.Request.Method,
+			path,
+			c.Errors.ByType(gin.ErrorTypePrivate).String(),
+		)
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAccessLogSamplesSuccessesButNotErrors(t *testing.T) {
+	var logged bytes.Buffer
+	writer := gin.DefaultWriter
+	gin.DefaultWriter = &logged
+	t.Cleanup(func() { gin.DefaultWriter = writer })
+	t.Setenv("LOG_SAMPLE_RATE", "3")
+	t.Setenv("LOG_SLOW_THRESHOLD", "50ms")
+
+	r := gin.New()
+	r.Use(AccessLog())
+	r.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/fail", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+	r.GET("/slow", func(c *gin.Context) {
+		time.Sleep(60 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+
+	for i := 0; i < 6; i++ {
+		request(r, http.MethodGet, "/ok", "")
+	}
+	for i := 0; i < 4; i++ {
+		request(r, http.MethodGet, "/fail", "")
+	}
+	request(r, http.MethodGet, "/slow", "")
+
+	lines := strings.Split(strings.TrimSpace(logged.String()), "\n")
+	count := func(path string) int {
+		n := 0
+		for _, line := range lines {
+			if strings.Contains(line, `"`+path+`"`) {
+				n++
+			}
+		}
+		return n
+	}
+	if n := count("/ok"); n != 2 {
+		t.Errorf("logged %d of 6 successes, want 1 in 3", n)
+	}
+	if n := count("/fail"); n != 4 {
+		t.Errorf("logged %d of 4 errors, want all of them", n)
+	}
+	if n := count("/slow"); n != 1 {
+		t.Errorf("the slow request was logged %d times, want once", n)
+	}
+}
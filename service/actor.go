@@ -0,0 +1,74 @@
+package service
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// systemActor attributes changes with no identifiable caller, such as
+// background jobs.
+const systemActor = "system"
+
+const defaultActorChain = "admin,header,system"
+
+// actorResolvers name the ways a caller can be identified. Each reports the
+// actor and whether it applied to the request.
+var actorResolvers = map[string]func(c *gin.Context) (string, bool){
+	"admin":  adminActor,
+	"header": headerActor,
+	"system": func(*gin.Context) (string, bool) { return systemActor, true },
+}
+
+func adminActor(c *gin.Context) (string, bool) {
+	return "admin", isAdmin(c)
+}
+
+// headerActor takes X-Actor from callers connecting directly from one of
+// the ACTOR_TRUSTED_NETWORKS CIDRs. The peer address is used, never a
+// forwarded one, so the header cannot be spoofed from outside.
+func headerActor(c *gin.Context) (string, bool) {
+	actor := strings.TrimSpace(c.GetHeader("X-Actor"))
+	if len(actor) == 0 {
+		return "", false
+	}
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return "", false
+	}
+	for _, cidr := range strings.Split(os.Getenv("ACTOR_TRUSTED_NETWORKS"), ",") {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err == nil && network.Contains(ip) {
+			return actor, true
+		}
+	}
+	return "", false
+}
+
+// resolveActor walks ACTOR_CHAIN, a comma separated list of resolver names
+// (default "admin,header,system"), and returns the first actor found. It
+// returns systemActor when nothing matches or there is no request.
+func resolveActor(c *gin.Context) string {
+	if c == nil {
+		return systemActor
+	}
+
+	chain := os.Getenv("ACTOR_CHAIN")
+	if len(chain) == 0 {
+		chain = defaultActorChain
+	}
+	for _, name := range strings.Split(chain, ",") {
+		resolve, ok := actorResolvers[strings.TrimSpace(name)]
+		if !ok {
+			log.Printf("unknown actor resolver %q in ACTOR_CHAIN", name)
+			continue
+		}
+		if actor, ok := resolve(c); ok {
+			return actor
+		}
+	}
+	return systemActor
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestActorChainPicksTheFirstResolverThatApplies(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	r := gin.New()
+	r.GET("/actor", func(c *gin.Context) { c.String(http.StatusOK, resolveActor(c)) })
+	// httptest requests come from 192.0.2.1.
+	admin := []string{"Authorization", "Bearer secret"}
+	header := []string{"X-Actor", "ops-bot"}
+	both := append(append([]string{}, admin...), header...)
+
+	for _, tc := range []struct {
+		name, chain, trusted string
+		headers              []string
+		want                 string
+	}{
+		{"anonymous", "", "192.0.2.0/24", nil, systemActor},
+		{"admin token", "", "", admin, "admin"},
+		{"header from a trusted network", "", "10.0.0.0/8, 192.0.2.0/24", header, "ops-bot"},
+		{"header from elsewhere", "", "10.0.0.0/8", header, systemActor},
+		{"admin before header", "", "192.0.2.0/24", both, "admin"},
+		{"header before admin", "header,admin", "192.0.2.0/24", both, "ops-bot"},
+		{"unknown resolvers are skipped", "jwt,header", "192.0.2.0/24", header, "ops-bot"},
+	} {
+		t.Setenv("ACTOR_CHAIN", tc.chain)
+		t.Setenv("ACTOR_TRUSTED_NETWORKS", tc.trusted)
+		if got := request(r, http.MethodGet, "/actor", "", tc.headers...).Body.String(); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	if got := resolveActor(nil); got != systemActor {
+		t.Errorf("without a request: got %q, want %q", got, systemActor)
+	}
+}
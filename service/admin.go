@@ -0,0 +1,36 @@
+package service
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin guards admin routes with the bearer token configured in
+// ADMIN_TOKEN. Admin routes are disabled when no token is configured.
+func (a *App) RequireAdmin(c *gin.Context) {
+	if len(os.Getenv("ADMIN_TOKEN")) == 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin endpoints are disabled"})
+		return
+	}
+
+	if !isAdmin(c) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+		return
+	}
+
+	c.Next()
+}
+
+// isAdmin reports whether the request carries the ADMIN_TOKEN bearer token.
+func isAdmin(c *gin.Context) bool {
+	token := os.Getenv("ADMIN_TOKEN")
+	if len(token) == 0 {
+		return false
+	}
+	given := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
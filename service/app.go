@@ -2,60 +2,721 @@ package service
 
 import (
 	"customer-service/db"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 )
 
 type App struct {
-	db *db.PostgresDB
+	db      *db.PostgresDB
+	purger  Purger
+	exports *exportStore
+	changes *changeNotifier
+	locks   *keyedMutex
+
+	createHook CreateHook
+	geocoder   Geocoder
+	bulkheads  map[string]*bulkhead
+	vacuum     vacuumGate
+	replaying  sync.Mutex
 }
 
 func GetApp(db *db.PostgresDB) *App {
-	return &App{
-		db: db,
+	a := &App{
+		db:      db,
+		purger:  newPurger(),
+		exports: newExportStore(),
+		changes: newChangeNotifier(),
+		locks:   newKeyedMutex(),
+
+		createHook: newCreateHook(),
+		geocoder:   noopGeocoder{},
+		bulkheads:  newBulkheads(),
 	}
+	go a.runExports()
+	requiredPutFields()
+
+	return a
 }
 
 func (a *App) PostHandler(c *gin.Context) {
 
 	status, customer, err := createCustomer(a.db, c)
 	if err != nil {
-		c.JSON(status, gin.H{"error": err.Error()})
+		renderError(c, status, err)
+		return
+	}
+
+	a.purge(collectionKey)
+	a.afterCreate(correlationID(c), *customer)
+	localize(c, customer)
+	renderCustomer(c, status, customer)
+
+}
+
+func (a *App) BatchPostHandler(c *gin.Context) {
+	status, result, err := createCustomers(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
 		return
 	}
 
-	c.JSON(status, customer)
+	if result.Inserted > 0 {
+		a.purge(collectionKey)
+		a.afterCreate(correlationID(c), result.created...)
+	}
+	render(c, status, result)
+}
 
+func (a *App) ImportHandler(c *gin.Context) {
+	status, result, err := importCustomers(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	if result.Inserted > 0 {
+		a.purge(collectionKey)
+		a.afterCreate(correlationID(c), result.created...)
+	}
+	render(c, status, result)
+}
+
+func (a *App) ListHandler(c *gin.Context) {
+	status, list, err := listCustomers(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	keys := []string{collectionKey}
+	for i := range list.Data {
+		keys = append(keys, customerKeys(&list.Data[i])...)
+	}
+	setSurrogateKeys(c, keys...)
+	for i := range list.Data {
+		localize(c, &list.Data[i])
+	}
+	etag := collectionETag(c, list)
+	c.Header("ETag", etag)
+	c.Header("X-Total-Count", strconv.Itoa(list.Total))
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if c.Request.Method == http.MethodHead {
+		c.Status(status)
+		return
+	}
+	render(c, status, list)
+}
+
+func (a *App) GeoJSONHandler(c *gin.Context) {
+	status, collection, err := listGeoJSON(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	keys := []string{collectionKey}
+	for _, feature := range collection.Features {
+		keys = append(keys, customerKeys(feature.Properties)...)
+		localize(c, feature.Properties)
+	}
+	setSurrogateKeys(c, keys...)
+	c.Header("X-Total-Count", strconv.Itoa(collection.Total))
+	c.Header("Content-Type", "application/geo+json; charset=utf-8")
+	render(c, status, collection)
+}
+
+func (a *App) BatchGetHandler(c *gin.Context) {
+	status, result, err := getCustomersByIDs(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	keys := []string{}
+	for i := range result.Data {
+		keys = append(keys, customerKeys(&result.Data[i])...)
+		localize(c, &result.Data[i])
+	}
+	setSurrogateKeys(c, keys...)
+	render(c, status, result)
+}
+
+func (a *App) EventsHandler(c *gin.Context) {
+	status, page, err := listEvents(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	render(c, status, page)
+}
+
+func (a *App) QueryPostHandler(c *gin.Context) {
+	status, query, err := saveQuery(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/queries/%d", query.ID))
+	render(c, status, query)
+}
+
+func (a *App) QueryGetHandler(c *gin.Context) {
+	status, query, err := getQuery(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	render(c, status, query)
+}
+
+func (a *App) QualityHandler(c *gin.Context) {
+	status, report, err := customerQuality(a.db)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	render(c, status, report)
+}
+
+func (a *App) UnsyncedHandler(c *gin.Context) {
+	status, list, err := listUnsynced(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(list.Total))
+	for i := range list.Data {
+		localize(c, &list.Data[i])
+	}
+	render(c, status, list)
+}
+
+func (a *App) TrashHandler(c *gin.Context) {
+	status, list, err := listTrash(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.Itoa(list.Total))
+	for i := range list.Data {
+		localize(c, &list.Data[i])
+	}
+	render(c, status, list)
+}
+
+func (a *App) SyncedHandler(c *gin.Context) {
+	status, mark, err := markSynced(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	render(c, status, mark)
+}
+
+func (a *App) SchemaHandler(c *gin.Context) {
+	render(c, http.StatusOK, customerSchema())
 }
 
 func (a *App) GetHandler(c *gin.Context) {
 	status, customer, err := getCustomer(a.db, c)
 	if err != nil {
-		c.JSON(status, gin.H{"error": err.Error()})
+		renderError(c, status, err)
 		return
 	}
 
-	c.JSON(status, customer)
+	setSurrogateKeys(c, customerKeys(customer)...)
+	localize(c, customer)
+	setAge(c, customer)
+	renderCustomer(c, status, customer)
+
+}
+
+func (a *App) WatchHandler(c *gin.Context) {
+	status, customer, err := a.watchCustomer(c)
+	if c.Request.Context().Err() != nil {
+		return
+	}
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+	if status == http.StatusNotModified {
+		c.Status(status)
+		return
+	}
+
+	setSurrogateKeys(c, customerKeys(customer)...)
+	localize(c, customer)
+	renderCustomer(c, status, customer)
+}
+
+func (a *App) CompareHandler(c *gin.Context) {
+	status, result, err := compareCustomer(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
 
+	render(c, status, result)
 }
 
 func (a *App) PutHandler(c *gin.Context) {
 	status, customer, err := updateCustomer(a.db, c)
 	if err != nil {
-		c.JSON(status, gin.H{"error": err.Error()})
+		renderError(c, status, err)
+		return
+	}
+
+	if status == http.StatusOK {
+		a.purge(collectionKey, customerKey(customer.ID))
+		a.changes.notify(customer.ID)
+	}
+	localize(c, customer)
+	renderCustomer(c, status, customer)
+
+}
+
+func (a *App) EnsureHandler(c *gin.Context) {
+	status, outcome, customer, err := ensureCustomer(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	c.Header("Ensure-Result", outcome)
+	switch outcome {
+	case ensureCreated:
+		a.purge(collectionKey)
+		a.afterCreate(correlationID(c), *customer)
+	case ensureUpdated:
+		a.purge(collectionKey, customerKey(customer.ID))
+		a.changes.notify(customer.ID)
+	case ensureUnchanged:
+		c.Status(status)
+		return
+	}
+	localize(c, customer)
+	renderCustomer(c, status, customer)
+}
+
+func (a *App) TagsHandler(c *gin.Context) {
+	status, customer, tag, changed, err := editTags(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
 		return
 	}
 
-	c.JSON(status, customer)
+	if changed {
+		a.purge(collectionKey, customerKey(customer.ID), tagKey(tag))
+		a.changes.notify(customer.ID)
+	}
+	localize(c, customer)
+	renderCustomer(c, status, customer)
+}
+
+func (a *App) ParentHandler(c *gin.Context) {
+	status, customer, err := setParent(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	if status == http.StatusOK {
+		a.purge(collectionKey, customerKey(customer.ID))
+		a.changes.notify(customer.ID)
+	}
+	localize(c, customer)
+	renderCustomer(c, status, customer)
+}
+
+func (a *App) GeocodeHandler(c *gin.Context) {
+	status, customer, err := a.geocodeCustomer(c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	if status == http.StatusOK {
+		a.purge(collectionKey, customerKey(customer.ID))
+		a.changes.notify(customer.ID)
+	}
+	localize(c, customer)
+	renderCustomer(c, status, customer)
+}
+
+func (a *App) ChildrenHandler(c *gin.Context) {
+	status, children, err := listChildren(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
 
+	keys := []string{}
+	for i := range children {
+		keys = append(keys, customerKeys(&children[i])...)
+		localize(c, &children[i])
+	}
+	setSurrogateKeys(c, keys...)
+	render(c, status, gin.H{"data": children})
 }
 
 func (a *App) DeleteHandler(c *gin.Context) {
 	status, err := deleteCustomer(a.db, c)
 	if err != nil {
-		c.JSON(status, gin.H{"error": err.Error()})
+		renderError(c, status, err)
+		return
+	}
+
+	id, _ := paramID(c)
+	a.purge(collectionKey, customerKey(id))
+	a.changes.notify(id)
+	render(c, status, nil)
+}
+
+func (a *App) ReassignHandler(c *gin.Context) {
+	status, result, err := reassignCustomers(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	if len(result.IDs) > 0 {
+		keys := []string{collectionKey}
+		for _, id := range result.IDs {
+			keys = append(keys, customerKey(id))
+		}
+		a.purge(keys...)
+		a.changes.notify(result.IDs...)
+	}
+	render(c, status, result)
+}
+
+func (a *App) BulkDeleteHandler(c *gin.Context) {
+	status, result, err := bulkDeleteCustomers(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
 		return
 	}
 
-	c.JSON(status, nil)
+	if !result.Preview && len(result.IDs) > 0 {
+		keys := []string{collectionKey}
+		for _, id := range result.IDs {
+			keys = append(keys, customerKey(id))
+		}
+		a.purge(keys...)
+		a.changes.notify(result.IDs...)
+	}
+	render(c, status, result)
+}
+
+func (a *App) BulkRestoreHandler(c *gin.Context) {
+	status, result, err := bulkRestoreCustomers(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	if len(result.IDs) > 0 {
+		keys := []string{collectionKey}
+		for _, id := range result.IDs {
+			keys = append(keys, customerKey(id))
+		}
+		a.purge(keys...)
+		a.changes.notify(result.IDs...)
+	}
+	render(c, status, result)
+}
+
+func (a *App) BulkPatchHandler(c *gin.Context) {
+	status, result, err := bulkPatchCustomers(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	if len(result.IDs) > 0 {
+		keys := []string{collectionKey}
+		for _, id := range result.IDs {
+			keys = append(keys, customerKey(id))
+		}
+		a.purge(keys...)
+		a.changes.notify(result.IDs...)
+	}
+	render(c, status, result)
+}
+
+func (a *App) UndoHandler(c *gin.Context) {
+	status, result, err := undoTransaction(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	keys := []string{collectionKey}
+	for _, id := range result.IDs {
+		keys = append(keys, customerKey(id))
+	}
+	a.purge(keys...)
+	a.changes.notify(result.IDs...)
+	render(c, status, result)
+}
+
+func (a *App) DedupHandler(c *gin.Context) {
+	status, report, err := findDuplicates(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	if len(report.changed) > 0 {
+		keys := []string{collectionKey}
+		for _, id := range report.changed {
+			keys = append(keys, customerKey(id))
+		}
+		a.purge(keys...)
+		a.changes.notify(report.changed...)
+	}
+	render(c, status, report)
+}
+
+func (a *App) ReplayHandler(c *gin.Context) {
+	status, result, err := a.replayWebhooks(c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	render(c, status, result)
+}
+
+func (a *App) VacuumHandler(c *gin.Context) {
+	status, result, err := a.vacuumTables(c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	render(c, status, result)
+}
+
+func (a *App) BloatHandler(c *gin.Context) {
+	status, report, err := reportBloat(a.db)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	render(c, status, report)
+}
+
+func (a *App) ExplainHandler(c *gin.Context) {
+	status, result, err := explainQuery(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	render(c, status, result)
+}
+
+func (a *App) SnapshotHandler(c *gin.Context) {
+	status, job, err := a.exports.snapshotCustomers()
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	c.Header("Location", "/customers/exports/"+job.ID)
+	render(c, status, job)
+}
+
+func (a *App) RestoreHandler(c *gin.Context) {
+	status, result, err := restoreCustomers(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	// Restored customers are not new and were provisioned before the
+	// snapshot, so the create hook does not run for them.
+	a.purge(collectionKey)
+	render(c, status, result)
+}
+
+func (a *App) SyncHandler(c *gin.Context) {
+	status, result, err := syncCustomers(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	if len(result.changed) > 0 {
+		keys := []string{collectionKey}
+		for _, id := range result.changed {
+			keys = append(keys, customerKey(id))
+		}
+		a.purge(keys...)
+		a.changes.notify(result.changed...)
+	}
+	a.afterCreate(correlationID(c), result.created...)
+	render(c, status, result)
+}
+
+func (a *App) ExportPostHandler(c *gin.Context) {
+	status, job, err := a.exports.enqueue(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	c.Header("Location", "/customers/exports/"+job.ID)
+	render(c, status, job)
+}
+
+func (a *App) ExportGetHandler(c *gin.Context) {
+	job, ok := a.exports.snapshot(c.Param("jobId"))
+	if !ok {
+		render(c, http.StatusNotFound, gin.H{"error": "export not found"})
+		return
+	}
+
+	render(c, http.StatusOK, job)
+}
+
+func (a *App) ExportDownloadHandler(c *gin.Context) {
+	job, ok := a.exports.snapshot(c.Param("jobId"))
+	if !ok {
+		render(c, http.StatusNotFound, gin.H{"error": "export not found"})
+		return
+	}
+	if job.Status != exportDone {
+		render(c, http.StatusConflict, gin.H{"error": "export is " + job.Status})
+		return
+	}
+
+	c.Header("Content-Type", exportFormats[job.Format])
+	c.FileAttachment(job.path, "customers-"+job.ID+"."+job.Format)
+}
+
+func (a *App) HealthHandler(c *gin.Context) {
+	status, health := checkHealth(a.db, c)
+	render(c, status, health)
+}
+
+func (a *App) VersionHandler(c *gin.Context) {
+	status, info, err := getVersion(a.db, c)
+	if err != nil {
+		renderError(c, status, err)
+		return
+	}
+
+	render(c, status, info)
+}
+
+// MetricsHandler publishes the expvar counters, including validation_failures.
+func (a *App) MetricsHandler(c *gin.Context) {
+	expvar.Handler().ServeHTTP(c.Writer, c.Request)
+}
+
+// renderError writes err as {"error": ...}. Failures caused by an
+// unreachable or dropped database connection are reported as 503 rather
+// than 500, since retrying later may succeed, and queries killed by the
+// server's statement_timeout as 504. Every 429 and 503 carries Retry-After.
+func renderError(c *gin.Context, status int, err error) {
+	if status == http.StatusInternalServerError {
+		switch {
+		case db.IsUnavailable(err):
+			status = http.StatusServiceUnavailable
+		case db.IsStatementTimeout(err):
+			render(c, http.StatusGatewayTimeout, gin.H{"error": "the database query exceeded its statement timeout"})
+			return
+		}
+	}
+	if status == http.StatusServiceUnavailable || status == http.StatusTooManyRequests {
+		setRetryAfter(c, retryAfterFor(err))
+	}
+	var re *retryableError
+	if errors.As(err, &re) {
+		c.Set(backpressureKey, true)
+	}
+	// Parameter names are reported as sent, so they skip the camelCase
+	// renaming render applies.
+	var ue *unknownParamsError
+	if errors.As(err, &ue) {
+		c.JSON(status, gin.H{"error": err.Error(), "unknown": ue.Unknown, "suggestions": ue.Suggestions})
+		return
+	}
+	render(c, status, gin.H{"error": err.Error()})
+}
+
+// responsesTooLarge counts responses refused for exceeding
+// MAX_RESPONSE_BYTES.
+var responsesTooLarge = expvar.NewInt("responses_too_large")
+
+// maxResponseBytes reads MAX_RESPONSE_BYTES. Zero, the default, means no
+// limit.
+func maxResponseBytes() int {
+	v, err := strconv.Atoi(os.Getenv("MAX_RESPONSE_BYTES"))
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
+
+// render writes obj as JSON, indented when the caller asks for ?pretty=true.
+// A malformed pretty value just falls back to compact output. Field names
+// are converted to camelCase when the client or config asks for it.
+//
+// With MAX_RESPONSE_BYTES set the body is encoded up front and a success
+// response larger than the limit is replaced by a 400 telling the client
+// to page; exports are the way to fetch more.
+func render(c *gin.Context, status int, obj interface{}) {
+	if obj != nil && camelCase(c) {
+		obj = camelTree(obj)
+	}
+	pretty, _ := queryBool(c, "pretty", false)
+
+	if limit := maxResponseBytes(); limit > 0 && status < http.StatusBadRequest {
+		var body []byte
+		var err error
+		if pretty {
+			body, err = json.MarshalIndent(obj, "", "    ")
+		} else {
+			body, err = json.Marshal(obj)
+		}
+		if err == nil && len(body) > limit {
+			responsesTooLarge.Add(1)
+			render(c, http.StatusBadRequest, gin.H{"error": fmt.Sprintf(
+				"the response would be %d bytes, over the %d byte limit; request a smaller page with limit, or use an export", len(body), limit)})
+			return
+		}
+		if err == nil {
+			c.Data(status, "application/json; charset=utf-8", body)
+			return
+		}
+	}
+
+	if pretty {
+		c.IndentedJSON(status, obj)
+		return
+	}
+	c.JSON(status, obj)
 }
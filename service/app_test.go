@@ -0,0 +1,85 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+func TestRenderIndentsWhenPretty(t *testing.T) {
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) { render(c, http.StatusOK, gin.H{"name": "Ada"}) })
+
+	for target, want := range map[string]string{
+		"/":              `{"name":"Ada"}`,
+		"/?pretty=true":  "{\n    \"name\": \"Ada\"\n}",
+		"/?pretty=false": `{"name":"Ada"}`,
+		"/?pretty=maybe": `{"name":"Ada"}`,
+	} {
+		if got := request(r, http.MethodGet, target, "").Body.String(); got != want {
+			t.Errorf("%s: got %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestStatementTimeoutIs504(t *testing.T) {
+	pg := postgresDB(t)
+	r := gin.New()
+	r.GET("/slow", func(c *gin.Context) {
+		tx := pg.DB.MustBegin()
+		defer tx.Rollback()
+		tx.MustExec(`SET LOCAL statement_timeout = 50`)
+		_, err := tx.Exec(`SELECT pg_sleep(1)`)
+		renderError(c, http.StatusInternalServerError, err)
+	})
+
+	if w := request(r, http.MethodGet, "/slow", ""); w.Code != http.StatusGatewayTimeout {
+		t.Errorf("got %d, want 504: %s", w.Code, w.Body)
+	}
+}
+
+func TestOnlyTheStatementTimeoutIs504(t *testing.T) {
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) {
+		err := &pq.Error{Code: "57014", Message: "canceling statement due to " + c.Query("reason")}
+		renderError(c, http.StatusInternalServerError, err)
+	})
+
+	for target, want := range map[string]int{
+		"/?reason=statement+timeout": http.StatusGatewayTimeout,
+		"/?reason=user+request":      http.StatusInternalServerError,
+	} {
+		if w := request(r, http.MethodGet, target, ""); w.Code != want {
+			t.Errorf("%s: got %d, want %d", target, w.Code, want)
+		}
+	}
+}
+
+func TestOversizedResponseIsRefused(t *testing.T) {
+	t.Setenv("MAX_RESPONSE_BYTES", "40")
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) {
+		render(c, http.StatusOK, gin.H{"name": c.Query("name")})
+	})
+	r.GET("/error", func(c *gin.Context) {
+		render(c, http.StatusNotFound, gin.H{"error": "this error message is longer than the response limit"})
+	})
+
+	refused := responsesTooLarge.Value()
+	if w := request(r, http.MethodGet, "/?name=Ada", ""); w.Code != http.StatusOK || w.Body.String() != `{"name":"Ada"}` {
+		t.Errorf("a small response: got %d %s", w.Code, w.Body)
+	}
+	w := request(r, http.MethodGet, "/?name=Ada+Augusta+King+Countess+of+Lovelace", "")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "over the 40 byte limit") {
+		t.Errorf("a large response: got %d %s, want 400 naming the limit", w.Code, w.Body)
+	}
+	if got := responsesTooLarge.Value() - refused; got != 1 {
+		t.Errorf("counted %d refused responses, want 1", got)
+	}
+	if w := request(r, http.MethodGet, "/error", ""); w.Code != http.StatusNotFound {
+		t.Errorf("a large error response: got %d, want it sent as is", w.Code)
+	}
+}
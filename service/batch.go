@@ -0,0 +1,141 @@
+package service
+
+import (
+	"customer-service/db"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultBatchChunkSize = 500
+
+type batchChunk struct {
+	Index    int    `json:"index"`
+	Offset   int    `json:"offset"`
+	Size     int    `json:"size"`
+	Inserted int    `json:"inserted"`
+	IDs      []int  `json:"ids,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type batchResult struct {
+	TransactionID string       `json:"transaction_id"`
+	Total         int          `json:"total"`
+	Inserted      int          `json:"inserted"`
+	ChunkSize     int          `json:"chunk_size"`
+	Chunks        []batchChunk `json:"chunks"`
+	FailedChunk   *int         `json:"failed_chunk,omitempty"`
+
+	created []Customer
+}
+
+func batchChunkSize() int {
+	size, err := strconv.Atoi(os.Getenv("BATCH_CHUNK_SIZE"))
+	if err != nil || size <= 0 {
+		return defaultBatchChunkSize
+	}
+	return size
+}
+
+func createCustomers(db *db.PostgresDB, c *gin.Context) (int, *batchResult, error) {
+	var customers []Customer
+	if err := bindJSON(c, &customers); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	if status, err := validateBatch(customers); err != nil {
+		return status, nil, err
+	}
+
+	result, err := insertBatch(db, c, customers, batchChunkSize(), progressReporter(c))
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if result.FailedChunk != nil {
+		return http.StatusMultiStatus, result, nil
+	}
+	return http.StatusCreated, result, nil
+}
+
+func validateBatch(customers []Customer) (int, error) {
+	if len(customers) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("batch cannot be empty")
+	}
+	for i := range customers {
+		if err := validateCustomer(&customers[i]); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("customer %d: %w", i, err)
+		}
+		if err := validateFields(&customers[i]); err != nil {
+			return http.StatusUnprocessableEntity, fmt.Errorf("customer %d: %w", i, err)
+		}
+	}
+	return 0, nil
+}
+
+// insertBatch inserts customers in transactions of at most chunkSize rows,
+// so a very large batch never holds its locks for the whole import. It stops
+// at the first chunk that fails; chunks before it stay committed. Progress
+// is reported after each committed chunk.
+func insertBatch(db *db.PostgresDB, c *gin.Context, customers []Customer, chunkSize int, progress progressFunc) (*batchResult, error) {
+	txID, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	result := &batchResult{TransactionID: txID, Total: len(customers), ChunkSize: chunkSize, Chunks: make([]batchChunk, 0)}
+
+	for offset := 0; offset < len(customers); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(customers) {
+			end = len(customers)
+		}
+
+		chunk := batchChunk{Index: len(result.Chunks), Offset: offset, Size: end - offset}
+		created, err := insertChunk(db, c, txID, customers[offset:end])
+		if err != nil {
+			chunk.Error = err.Error()
+			result.Chunks = append(result.Chunks, chunk)
+			result.FailedChunk = &chunk.Index
+			return result, nil
+		}
+
+		chunk.Inserted = len(created)
+		for _, customer := range created {
+			chunk.IDs = append(chunk.IDs, customer.ID)
+		}
+		result.Inserted += len(created)
+		result.Chunks = append(result.Chunks, chunk)
+		result.created = append(result.created, created...)
+		progress(end, len(customers))
+	}
+
+	return result, nil
+}
+
+func insertChunk(db *db.PostgresDB, c *gin.Context, txID string, customers []Customer) ([]Customer, error) {
+	tx, err := beginRequest(db, c)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := tagTransaction(tx, txID); err != nil {
+		return nil, err
+	}
+
+	created := make([]Customer, 0, len(customers))
+	stmt := `INSERT INTO customers (name, email, address, owner) VALUES ($1, $2, $3, $4) RETURNING ` + customerColumns
+	for _, customer := range customers {
+		var row Customer
+		if err := tx.QueryRowx(stmt, customer.Name, customer.Email, customer.Address, customer.Owner).StructScan(&row); err != nil {
+			return nil, err
+		}
+		created = append(created, row)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"customer-service/db"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type batchGetRequest struct {
+	IDs []int `json:"ids"`
+}
+
+type batchGetResult struct {
+	Data    []Customer `json:"data"`
+	Missing []int      `json:"missing"`
+}
+
+// getCustomersByIDs returns the requested customers in the order their ids
+// were given, listing ids that matched nothing under missing.
+func getCustomersByIDs(db *db.PostgresDB, c *gin.Context) (int, *batchGetResult, error) {
+	var req batchGetRequest
+	if err := bindJSON(c, &req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if len(req.IDs) == 0 {
+		return http.StatusBadRequest, nil, fmt.Errorf("ids cannot be empty")
+	}
+	if len(req.IDs) > maxListLimit {
+		return http.StatusBadRequest, nil, fmt.Errorf("at most %d ids can be fetched at once", maxListLimit)
+	}
+
+	result := &batchGetResult{Data: make([]Customer, 0, len(req.IDs)), Missing: make([]int, 0)}
+	stmt := `SELECT ` + customerColumns + ` FROM customers
+	WHERE id = ANY($1::int[]) AND ` + notDeleted + ` ORDER BY array_position($1::int[], id)`
+	if err := db.DB.Select(&result.Data, stmt, pq.Array(req.IDs)); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	found := make(map[int]bool, len(result.Data))
+	for _, customer := range result.Data {
+		found[customer.ID] = true
+	}
+	for _, id := range req.IDs {
+		if !found[id] {
+			result.Missing = append(result.Missing, id)
+			found[id] = true
+		}
+	}
+
+	return http.StatusOK, result, nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func batchGetRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.POST("/customers/batch-get", a.BatchGetHandler)
+	return r
+}
+
+func TestBatchGetRejectsEmptyAndOversizedRequests(t *testing.T) {
+	r := batchGetRouter(GetApp(nil))
+	ids := make([]int, maxListLimit+1)
+	tooMany, _ := json.Marshal(map[string][]int{"ids": ids})
+	for _, body := range []string{`{"ids": []}`, string(tooMany)} {
+		if w := request(r, http.MethodPost, "/customers/batch-get", body); w.Code != http.StatusBadRequest {
+			t.Errorf("got %d, want 400", w.Code)
+		}
+	}
+}
+
+func TestBatchGetKeepsTheRequestedOrder(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	ids := seedCustomers(t, a, 4, "alice")
+	shuffled := []int{ids[2], ids[0], 999999, ids[3], ids[1]}
+	body := fmt.Sprintf(`{"ids": [%d, %d, %d, %d, %d]}`, shuffled[0], shuffled[1], shuffled[2], shuffled[3], shuffled[4])
+
+	w := request(batchGetRouter(a), http.MethodPost, "/customers/batch-get", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var result batchGetResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]int, 0, len(result.Data))
+	for _, customer := range result.Data {
+		got = append(got, customer.ID)
+	}
+	if want := []int{ids[2], ids[0], ids[3], ids[1]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("returned %v, want the requested order %v", got, want)
+	}
+	if !reflect.DeepEqual(result.Missing, []int{999999}) {
+		t.Errorf("missing %v, want [999999]", result.Missing)
+	}
+}
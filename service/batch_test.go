@@ -0,0 +1,79 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func batchRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.POST("/customers/batch", StreamProgress, a.BatchPostHandler)
+	return r
+}
+
+// batchBody is a batch of n customers whose emails start at c<from>.
+func batchBody(from, n int) string {
+	customers := make([]string, 0, n)
+	for i := from; i < from+n; i++ {
+		customers = append(customers, fmt.Sprintf(`{"name": "Customer %d", "email": "c%d@example.com"}`, i, i))
+	}
+	return "[" + strings.Join(customers, ", ") + "]"
+}
+
+func TestBatchIsInsertedInChunks(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	t.Setenv("BATCH_CHUNK_SIZE", "2")
+
+	w := request(batchRouter(a), http.MethodPost, "/customers/batch", batchBody(0, 5))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var result batchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 5 || result.Inserted != 5 || result.ChunkSize != 2 || len(result.Chunks) != 3 {
+		t.Fatalf("result %+v, want 5 inserted in 3 chunks of 2", result)
+	}
+	for i, want := range []batchChunk{{Index: 0, Offset: 0, Size: 2}, {Index: 1, Offset: 2, Size: 2}, {Index: 2, Offset: 4, Size: 1}} {
+		got := result.Chunks[i]
+		if got.Index != want.Index || got.Offset != want.Offset || got.Size != want.Size || got.Inserted != want.Size || len(got.IDs) != want.Size {
+			t.Errorf("chunk %d: %+v, want %+v with every row inserted", i, got, want)
+		}
+	}
+}
+
+func TestBatchStopsAtTheFailingChunk(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	t.Setenv("BATCH_CHUNK_SIZE", "2")
+	a.db.DB.MustExec(`INSERT INTO customers (name, email) VALUES ('Taken', 'c3@example.com')`)
+
+	w := request(batchRouter(a), http.MethodPost, "/customers/batch", batchBody(0, 6))
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("got %d, want 207: %s", w.Code, w.Body)
+	}
+	var result batchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.FailedChunk == nil || *result.FailedChunk != 1 || result.Inserted != 2 || len(result.Chunks) != 2 {
+		t.Fatalf("result %+v, want chunk 0 committed and chunk 1 failed", result)
+	}
+	if len(result.Chunks[1].Error) == 0 {
+		t.Errorf("the failed chunk carries no error")
+	}
+	if got := len(owners(t, a)); got != 3 {
+		t.Errorf("%d customers stored, want the taken one and the first chunk", got)
+	}
+}
+
+func TestEmptyBatchIsRejected(t *testing.T) {
+	if w := request(batchRouter(GetApp(nil)), http.MethodPost, "/customers/batch", `[]`); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want 400: %s", w.Code, w.Body)
+	}
+}
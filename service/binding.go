@@ -0,0 +1,99 @@
+package service
+
+import (
+	"encoding"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+var (
+	jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// bindJSON binds the request body into obj like ShouldBindJSON. With
+// LENIENT_BINDING=true, numeric strings are first accepted for number
+// fields and "true"/"false" for boolean ones; anything else that does not
+// fit still fails to bind.
+func bindJSON(c *gin.Context, obj interface{}) error {
+	if os.Getenv("LENIENT_BINDING") != "true" {
+		return c.ShouldBindJSON(obj)
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	v, err := decodeJSON(body)
+	if err != nil {
+		return err
+	}
+	if body, err = json.Marshal(coerce(v, reflect.TypeOf(obj))); err != nil {
+		return err
+	}
+	return binding.JSON.BindBody(body, obj)
+}
+
+// coerce converts the string values in v that t expects as numbers or
+// booleans. Types with their own JSON decoding, such as time.Time, are left
+// alone.
+func coerce(v interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshaler) || reflect.PtrTo(t).Implements(textUnmarshaler) {
+		return v
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+			if len(name) == 0 {
+				name = f.Name
+			}
+			if val, ok := m[name]; ok {
+				m[name] = coerce(val, f.Type)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if s, ok := v.([]interface{}); ok {
+			for i := range s {
+				s[i] = coerce(s[i], t.Elem())
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if s, ok := v.(string); ok {
+			if _, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+				return json.Number(strings.TrimSpace(s))
+			}
+		}
+	case reflect.Bool:
+		if s, ok := v.(string); ok {
+			switch strings.TrimSpace(s) {
+			case "true":
+				return true
+			case "false":
+				return false
+			}
+		}
+	}
+	return v
+}
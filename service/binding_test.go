@@ -0,0 +1,41 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLenientBindingCoercesStringNumbersAndBooleans(t *testing.T) {
+	r := gin.New()
+	r.POST("/bind", func(c *gin.Context) {
+		var req struct {
+			IDs      []int `json:"ids"`
+			ParentID *int  `json:"parent_id"`
+			Merge    bool  `json:"merge"`
+		}
+		if err := bindJSON(c, &req); err != nil {
+			renderError(c, http.StatusBadRequest, err)
+			return
+		}
+		render(c, http.StatusOK, gin.H{"ids": req.IDs, "parent_id": req.ParentID, "merge": req.Merge})
+	})
+	body := `{"ids": ["1", 2, " 3 "], "parent_id": "7", "merge": "true"}`
+
+	t.Setenv("LENIENT_BINDING", "")
+	if w := request(r, http.MethodPost, "/bind", body); w.Code != http.StatusBadRequest {
+		t.Errorf("strict binding: got %d, want 400: %s", w.Code, w.Body)
+	}
+
+	t.Setenv("LENIENT_BINDING", "true")
+	w := request(r, http.MethodPost, "/bind", body)
+	if want := `{"ids":[1,2,3],"merge":true,"parent_id":7}`; w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("lenient binding: got %d %s, want %s", w.Code, w.Body, want)
+	}
+	for _, body := range []string{`{"ids": ["one"]}`, `{"merge": "yes"}`} {
+		if w := request(r, http.MethodPost, "/bind", body); w.Code != http.StatusBadRequest {
+			t.Errorf("lenient binding of %s: got %d, want 400", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"customer-service/db"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// maxBulkIDs bounds the customers one bulk request can name.
+const maxBulkIDs = 1000
+
+type bulkDeleteRequest struct {
+	IDs []int `json:"ids"`
+}
+
+type bulkPatchRequest struct {
+	IDs []int    `json:"ids"`
+	Set Customer `json:"set"`
+}
+
+type bulkPatchResult struct {
+	TransactionID string `json:"transaction_id"`
+	Updated       int    `json:"updated"`
+	IDs           []int  `json:"ids"`
+}
+
+type bulkDeleteResult struct {
+	TransactionID string `json:"transaction_id,omitempty"`
+	Deleted       int    `json:"deleted"`
+	IDs           []int  `json:"ids"`
+
+	// A preview reports what a bulk delete would do without doing it, and
+	// the token that confirms it.
+	Preview             bool       `json:"preview,omitempty"`
+	ConfirmationToken   string     `json:"confirmation_token,omitempty"`
+	ConfirmationExpires *time.Time `json:"confirmation_expires_at,omitempty"`
+}
+
+type bulkRestoreRequest struct {
+	IDs []int `json:"ids"`
+}
+
+type bulkRestoreResult struct {
+	TransactionID string `json:"transaction_id"`
+	Restored      int    `json:"restored"`
+	IDs           []int  `json:"ids"`
+
+	// Skipped lists the requested ids that were active or do not exist.
+	Skipped []int `json:"skipped"`
+}
+
+func checkBulkIDs(ids []int) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("ids cannot be empty")
+	}
+	if len(ids) > maxBulkIDs {
+		return fmt.Errorf("at most %d ids can be changed at once", maxBulkIDs)
+	}
+	return nil
+}
+
+// bulkDeleteCustomers deletes the listed customers in one transaction
+// tagged with the returned transaction_id. Like a sync with delete it
+// needs confirmation: without ?confirm= it only reports the customers it
+// would delete, with a token to repeat the request with and
+// ?expectedCount=, and a count that changed since aborts with 409.
+func bulkDeleteCustomers(db *db.PostgresDB, c *gin.Context) (int, *bulkDeleteResult, error) {
+	var p confirmParams
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	confirm := confirmationRequired()
+	var hash string
+	expected := -1
+	if confirm {
+		var err error
+		if hash, err = bodyHash(c); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		if p.Confirm != nil {
+			status, n, err := checkConfirmation(p, "bulk-delete", "customers", hash)
+			if err != nil {
+				return status, nil, err
+			}
+			expected = n
+		}
+	}
+
+	var req bulkDeleteRequest
+	if err := bindJSON(c, &req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if err := checkBulkIDs(req.IDs); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	if confirm && expected < 0 {
+		result := &bulkDeleteResult{IDs: make([]int, 0), Preview: true}
+		stmt := `SELECT id FROM customers WHERE id = ANY($1) AND ` + notDeleted + ` ORDER BY id`
+		if err := db.DB.Select(&result.IDs, stmt, pq.Array(req.IDs)); err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+		token, expires, err := issueConfirmation("bulk-delete", "customers", hash, len(result.IDs))
+		if err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+		result.Deleted, result.ConfirmationToken, result.ConfirmationExpires = len(result.IDs), token, &expires
+		return http.StatusOK, result, nil
+	}
+
+	txID, err := newRandomID()
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	tx, err := beginRequest(db, c)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	defer tx.Rollback()
+	if err := tagTransaction(tx, txID); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	result := &bulkDeleteResult{TransactionID: txID, IDs: make([]int, 0)}
+	if err := tx.Select(&result.IDs, deleteStmt(`id = ANY($1) AND `+notDeleted, "id"), pq.Array(req.IDs)); err != nil {
+		status, err := deleteFailed(err)
+		return status, nil, err
+	}
+	result.Deleted = len(result.IDs)
+	if confirm && result.Deleted != expected {
+		return http.StatusConflict, nil, fmt.Errorf("bulk delete would now delete %d customers, not the %d confirmed; preview it again", result.Deleted, expected)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, result, nil
+}
+
+// bulkRestoreCustomers brings the listed soft-deleted customers back in one
+// transaction tagged with the returned transaction_id, dropping their
+// tombstones. Active and unknown ids are reported as skipped.
+func bulkRestoreCustomers(db *db.PostgresDB, c *gin.Context) (int, *bulkRestoreResult, error) {
+	var req bulkRestoreRequest
+	if err := bindJSON(c, &req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if err := checkBulkIDs(req.IDs); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	txID, err := newRandomID()
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	tx, err := beginRequest(db, c)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	defer tx.Rollback()
+	if err := tagTransaction(tx, txID); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	result := &bulkRestoreResult{TransactionID: txID, IDs: make([]int, 0), Skipped: make([]int, 0)}
+	stmt := `WITH restored AS (
+	    UPDATE customers SET deleted_at = NULL, updated_at = now()
+	    WHERE id = ANY($1) AND deleted_at IS NOT NULL RETURNING id
+	),
+	untombstoned AS (DELETE FROM customer_tombstones WHERE customer_id IN (SELECT id FROM restored))
+	SELECT id FROM restored ORDER BY id`
+	if err := tx.Select(&result.IDs, stmt, pq.Array(req.IDs)); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	seen := make(map[int]bool, len(req.IDs))
+	for _, id := range result.IDs {
+		seen[id] = true
+	}
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			result.Skipped = append(result.Skipped, id)
+		}
+	}
+	result.Restored = len(result.IDs)
+	return http.StatusOK, result, nil
+}
+
+// bulkPatchCustomers sets the name, address or owner given in set on every
+// listed customer, in one transaction tagged with the returned
+// transaction_id. Empty fields are left alone, and customers that already
+// hold the values are not touched.
+func bulkPatchCustomers(db *db.PostgresDB, c *gin.Context) (int, *bulkPatchResult, error) {
+	var req bulkPatchRequest
+	if err := bindJSON(c, &req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if err := checkBulkIDs(req.IDs); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if len(req.Set.Email) != 0 {
+		return http.StatusBadRequest, nil, fmt.Errorf("email is unique and cannot be set in bulk")
+	}
+	if err := validateFields(&req.Set); err != nil {
+		return http.StatusUnprocessableEntity, nil, err
+	}
+
+	args := make([]interface{}, 0)
+	sets := make([]string, 0)
+	changes := make([]string, 0)
+	for _, f := range []struct{ column, value string }{
+		{"name", req.Set.Name}, {"address", req.Set.Address}, {"owner", req.Set.Owner},
+	} {
+		if len(f.value) == 0 {
+			continue
+		}
+		args = append(args, f.value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", f.column, len(args)))
+		changes = append(changes, fmt.Sprintf("%s IS DISTINCT FROM $%d", f.column, len(args)))
+	}
+	if len(sets) == 0 {
+		return http.StatusBadRequest, nil, fmt.Errorf("set must carry at least one of name, address or owner")
+	}
+	args = append(args, pq.Array(req.IDs))
+	stmt := `UPDATE customers SET updated_at = now(), ` + strings.Join(sets, ", ") +
+		fmt.Sprintf(` WHERE id = ANY($%d) AND `, len(args)) + notDeleted + ` AND (` + strings.Join(changes, " OR ") + `) RETURNING id`
+
+	txID, err := newRandomID()
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	tx, err := beginRequest(db, c)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	defer tx.Rollback()
+	if err := tagTransaction(tx, txID); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	result := &bulkPatchResult{TransactionID: txID, IDs: make([]int, 0)}
+	if err := tx.Select(&result.IDs, stmt, args...); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	result.Updated = len(result.IDs)
+
+	if err := tx.Commit(); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, result, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func bulkRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.POST("/customers/bulk-delete", a.BulkDeleteHandler)
+	r.POST("/customers/bulk-patch", a.BulkPatchHandler)
+	r.POST("/customers/transactions/:txId/undo", a.RequireAdmin, a.UndoHandler)
+	return r
+}
+
+func TestUndoNeedsTheAdminToken(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	r := bulkRouter(GetApp(nil))
+
+	for _, auth := range []string{"", "Bearer wrong"} {
+		if w := request(r, http.MethodPost, "/customers/transactions/abc/undo", "", "Authorization", auth); w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: got %d, want 401", auth, w.Code)
+		}
+	}
+}
+
+func TestBulkPatchThenUndoTheBatch(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	t.Setenv("ADMIN_TOKEN", "secret")
+	r := bulkRouter(a)
+	ids := seedCustomers(t, a, 3, "alice")
+
+	w := request(r, http.MethodPost, "/customers/bulk-patch", fmt.Sprintf(`{"ids": [%d, %d], "set": {"owner": "bob"}}`, ids[0], ids[1]))
+	if w.Code != http.StatusOK {
+		t.Fatalf("bulk patch: %d %s", w.Code, w.Body)
+	}
+	var patched bulkPatchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &patched); err != nil {
+		t.Fatal(err)
+	}
+	if patched.Updated != 2 || len(patched.TransactionID) == 0 {
+		t.Fatalf("bulk patch: %+v, want 2 updated under a transaction id", patched)
+	}
+	if got := owners(t, a); got[ids[0]] != "bob" || got[ids[1]] != "bob" || got[ids[2]] != "alice" {
+		t.Fatalf("owners after the patch: %v", got)
+	}
+
+	w = request(r, http.MethodPost, "/customers/transactions/"+patched.TransactionID+"/undo", "", "Authorization", "Bearer secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("undo: %d %s", w.Code, w.Body)
+	}
+	var undone undoResult
+	if err := json.Unmarshal(w.Body.Bytes(), &undone); err != nil {
+		t.Fatal(err)
+	}
+	if undone.Undone != 2 {
+		t.Errorf("undid %d changes, want 2", undone.Undone)
+	}
+	for id, owner := range owners(t, a) {
+		if owner != "alice" {
+			t.Errorf("customer %d is owned by %q after the undo, want alice", id, owner)
+		}
+	}
+}
+
+func TestBulkDeleteIsPreviewedThenConfirmedAndUndone(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	t.Setenv("ADMIN_TOKEN", "secret")
+	r := bulkRouter(a)
+	ids := seedCustomers(t, a, 3, "alice")
+	body := fmt.Sprintf(`{"ids": [%d, %d]}`, ids[0], ids[1])
+
+	w := request(r, http.MethodPost, "/customers/bulk-delete", body)
+	var preview bulkDeleteResult
+	if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("preview: %d %s", w.Code, w.Body)
+	}
+	if !preview.Preview || preview.Deleted != 2 || len(owners(t, a)) != 3 {
+		t.Fatalf("preview: %+v, want 2 deletions previewed and nothing deleted", preview)
+	}
+
+	confirm := "/customers/bulk-delete?confirm=" + url.QueryEscape(preview.ConfirmationToken)
+	if w := request(r, http.MethodPost, confirm+"&expectedCount=3", body); w.Code != http.StatusConflict {
+		t.Errorf("confirming the wrong count: got %d, want 409: %s", w.Code, w.Body)
+	}
+	w = request(r, http.MethodPost, confirm+"&expectedCount=2", body)
+	var deleted bulkDeleteResult
+	if err := json.Unmarshal(w.Body.Bytes(), &deleted); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("confirming: %d %s", w.Code, w.Body)
+	}
+	if got := owners(t, a); len(got) != 1 {
+		t.Fatalf("%d customers left, want 1", len(got))
+	}
+
+	w = request(r, http.MethodPost, "/customers/transactions/"+deleted.TransactionID+"/undo", "", "Authorization", "Bearer secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("undo: %d %s", w.Code, w.Body)
+	}
+	if got := owners(t, a); len(got) != 3 {
+		t.Errorf("%d customers after the undo, want all 3 back", len(got))
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Endpoint classes, each with its own bulkhead and breaker so a flood of
+// one kind of request cannot starve the others.
+const (
+	classRead   = "read"
+	classWrite  = "write"
+	classExport = "export"
+)
+
+const (
+	defaultBreakerCooldown = 30 * time.Second
+	bulkheadRetryAfter     = time.Second
+)
+
+// routeClasses overrides the class a route gets from its method, GET and
+// HEAD being reads and everything else writes. An empty class exempts the
+// route, as for probes and long polls that would otherwise hold a slot.
+var routeClasses = map[string]string{
+	"GET /health":                            "",
+	"GET /version":                           "",
+	"GET /metrics":                           "",
+	"GET /customers/:customerId/watch":       "",
+	"POST /customers/import":                 classExport,
+	"POST /customers/exports":                classExport,
+	"GET /customers/exports/:jobId":          classExport,
+	"GET /customers/exports/:jobId/download": classExport,
+	"POST /admin/customers/snapshot":         classExport,
+	"POST /admin/customers/restore":          classExport,
+	"POST /admin/maintenance/vacuum":         classExport,
+}
+
+// bulkheadRejections counts requests turned away, by "class.reason".
+var bulkheadRejections = expvar.NewMap("bulkhead_rejections")
+
+// bulkhead bounds the concurrent requests of a class and trips a breaker
+// after a run of server errors, shedding the class until the cooldown ends.
+type bulkhead struct {
+	slots chan struct{}
+
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// newBulkhead reads BULKHEAD_<CLASS> for the concurrency limit, zero or
+// unset meaning unlimited, BREAKER_FAILURES for the consecutive 5xx that
+// trip the breaker, zero or unset disabling it, and BREAKER_COOLDOWN.
+func newBulkhead(class string) *bulkhead {
+	b := &bulkhead{cooldown: defaultBreakerCooldown}
+	if n, err := strconv.Atoi(os.Getenv("BULKHEAD_" + strings.ToUpper(class))); err == nil && n > 0 {
+		b.slots = make(chan struct{}, n)
+	}
+	if n, err := strconv.Atoi(os.Getenv("BREAKER_FAILURES")); err == nil && n > 0 {
+		b.threshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("BREAKER_COOLDOWN")); err == nil && d > 0 {
+		b.cooldown = d
+	}
+	return b
+}
+
+func newBulkheads() map[string]*bulkhead {
+	return map[string]*bulkhead{
+		classRead:   newBulkhead(classRead),
+		classWrite:  newBulkhead(classWrite),
+		classExport: newBulkhead(classExport),
+	}
+}
+
+// open reports whether the breaker is shedding requests and until when.
+func (b *bulkhead) open() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return true, wait
+	}
+	return false, 0
+}
+
+// record counts a finished request towards the breaker. Backpressure
+// responses, such as a busy customer lock, say nothing about the health of
+// the class and are ignored.
+func (b *bulkhead) record(c *gin.Context) {
+	if b.threshold == 0 || c.GetBool(backpressureKey) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c.Writer.Status() < http.StatusInternalServerError {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.failures = 0
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+func routeClass(c *gin.Context) string {
+	if class, ok := routeClasses[c.Request.Method+" "+c.FullPath()]; ok {
+		return class
+	}
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		return classRead
+	}
+	return classWrite
+}
+
+// Bulkhead admits a request only while its class has a free slot and a
+// closed breaker, answering 503 with Retry-After otherwise. Requests do not
+// queue for a slot: waiting would hold the connection the limit protects.
+func (a *App) Bulkhead(c *gin.Context) {
+	class := routeClass(c)
+	b := a.bulkheads[class]
+	if b == nil || len(c.FullPath()) == 0 {
+		c.Next()
+		return
+	}
+
+	if open, wait := b.open(); open {
+		bulkheadRejections.Add(class+".breaker", 1)
+		renderError(c, http.StatusServiceUnavailable, retryLater(fmt.Errorf("%s requests are failing and temporarily refused", class), wait))
+		c.Abort()
+		return
+	}
+	if b.slots != nil {
+		select {
+		case b.slots <- struct{}{}:
+			defer func() { <-b.slots }()
+		default:
+			bulkheadRejections.Add(class+".full", 1)
+			renderError(c, http.StatusServiceUnavailable, retryLater(fmt.Errorf("too many concurrent %s requests", class), bulkheadRetryAfter))
+			c.Abort()
+			return
+		}
+	}
+
+	c.Next()
+	b.record(c)
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSaturatedExportsLeaveReadsAvailable(t *testing.T) {
+	t.Setenv("BULKHEAD_EXPORT", "1")
+	a := GetApp(nil)
+	r := gin.New()
+	r.Use(a.Bulkhead)
+	started, release := make(chan struct{}), make(chan struct{})
+	r.POST("/customers/exports", func(c *gin.Context) {
+		started <- struct{}{}
+		<-release
+		c.Status(http.StatusAccepted)
+	})
+	r.GET("/customers", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	done := make(chan int)
+	go func() { done <- request(r, http.MethodPost, "/customers/exports", "").Code }()
+	<-started
+
+	if w := request(r, http.MethodPost, "/customers/exports", ""); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("a second export: got %d with Retry-After %q, want 503 with 1", w.Code, w.Header().Get("Retry-After"))
+	}
+	for i := 0; i < 3; i++ {
+		if w := request(r, http.MethodGet, "/customers", ""); w.Code != http.StatusNoContent {
+			t.Errorf("a read while exports are saturated: got %d", w.Code)
+		}
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusAccepted {
+		t.Errorf("the running export: got %d", code)
+	}
+	go func() { <-started }()
+	if w := request(r, http.MethodPost, "/customers/exports", ""); w.Code != http.StatusAccepted {
+		t.Errorf("an export after the slot was freed: got %d", w.Code)
+	}
+}
+
+func TestBreakerShedsOnlyTheFailingClass(t *testing.T) {
+	t.Setenv("BREAKER_FAILURES", "2")
+	t.Setenv("BREAKER_COOLDOWN", "1m")
+	a := GetApp(nil)
+	r := gin.New()
+	r.Use(a.Bulkhead)
+	r.PUT("/customers/:customerId", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+	r.GET("/customers/:customerId", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 2; i++ {
+		if w := request(r, http.MethodPut, "/customers/1", ""); w.Code != http.StatusInternalServerError {
+			t.Fatalf("write %d: got %d", i, w.Code)
+		}
+	}
+	if w := request(r, http.MethodPut, "/customers/1", ""); w.Code != http.StatusServiceUnavailable || len(w.Header().Get("Retry-After")) == 0 {
+		t.Errorf("a write with the breaker open: got %d, want 503 with Retry-After", w.Code)
+	}
+	if w := request(r, http.MethodGet, "/customers/1", ""); w.Code != http.StatusOK {
+		t.Errorf("a read with the write breaker open: got %d", w.Code)
+	}
+}
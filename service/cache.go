@@ -0,0 +1,100 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// collectionKey tags every response that lists customers, so any change to
+// the set of customers can purge all cached listings at once.
+const collectionKey = "customers"
+
+func customerKey(id int) string {
+	return fmt.Sprintf("customer-%d", id)
+}
+
+// tagKey escapes the tag, since the keys in a Surrogate-Key header are
+// separated by spaces and tags stored before validation may hold them.
+func tagKey(tag string) string {
+	return "tag-" + url.PathEscape(tag)
+}
+
+// customerKeys tags a customer response with the customer and each of its
+// tags, so purging a tag invalidates every customer carrying it.
+func customerKeys(customer *Customer) []string {
+	keys := []string{customerKey(customer.ID)}
+	for _, tag := range customer.Tags {
+		keys = append(keys, tagKey(tag))
+	}
+	return keys
+}
+
+func setSurrogateKeys(c *gin.Context, keys ...string) {
+	c.Header("Surrogate-Key", strings.Join(keys, " "))
+}
+
+// Purger invalidates edge-cached responses tagged with the given surrogate keys.
+type Purger interface {
+	Purge(keys []string) error
+}
+
+type noopPurger struct{}
+
+func (noopPurger) Purge(keys []string) error {
+	return nil
+}
+
+// httpPurger posts the keys to a CDN purge endpoint as {"surrogate_keys": [...]}.
+type httpPurger struct {
+	url    string
+	client *http.Client
+}
+
+func (p *httpPurger) Purge(keys []string) error {
+	body, err := json.Marshal(map[string][]string{"surrogate_keys": keys})
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Post(p.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("purge returned %s", resp.Status)
+	}
+	return nil
+}
+
+// newPurger purges through CDN_PURGE_URL when it is set and does nothing otherwise.
+func newPurger() Purger {
+	url := os.Getenv("CDN_PURGE_URL")
+	if len(url) == 0 {
+		return noopPurger{}
+	}
+	return &httpPurger{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (a *App) SetPurger(p Purger) {
+	a.purger = p
+}
+
+// purge runs in the background so a slow CDN never delays the response.
+func (a *App) purge(keys ...string) {
+	go func() {
+		if err := a.purger.Purge(keys); err != nil {
+			log.Printf("purging surrogate keys %v: %v", keys, err)
+		}
+	}()
+}
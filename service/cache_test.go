@@ -0,0 +1,81 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordingPurger hands every purge to the test.
+type recordingPurger chan []string
+
+func (p recordingPurger) Purge(keys []string) error {
+	p <- keys
+	return nil
+}
+
+func TestHTTPPurgerPostsTheKeys(t *testing.T) {
+	bodies := make(chan map[string][]string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string][]string
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	p := &httpPurger{url: server.URL, client: server.Client()}
+	if err := p.Purge([]string{"customers", "customer-7"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-bodies, map[string][]string{"surrogate_keys": {"customers", "customer-7"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("posted %v, want %v", got, want)
+	}
+}
+
+func TestCustomerResponsesCarryAndPurgeSurrogateKeys(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	purges := make(recordingPurger, 1)
+	a.SetPurger(purges)
+	r := gin.New()
+	r.GET("/customers/:customerId", a.GetHandler)
+	r.PUT("/customers/:customerId", a.SerializeCustomer, a.PutHandler)
+	id := seedCustomers(t, a, 1, "alice")[0]
+	a.db.DB.MustExec(`UPDATE customers SET tags = '{vip}' WHERE id = $1`, id)
+	target := fmt.Sprintf("/customers/%d", id)
+
+	w := request(r, http.MethodGet, target, "")
+	keys := strings.Fields(w.Header().Get("Surrogate-Key"))
+	if want := []string{customerKey(id), "tag-vip"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Surrogate-Key %v, want %v", keys, want)
+	}
+
+	if w := request(r, http.MethodPut, target, `{"name": "Ada", "email": "ada@example.com"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT: %d %s", w.Code, w.Body)
+	}
+	select {
+	case got := <-purges:
+		if want := []string{collectionKey, customerKey(id)}; !reflect.DeepEqual(got, want) {
+			t.Errorf("purged %v, want %v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the update purged nothing")
+	}
+}
+
+func TestTagKeysNeverSplit(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	setSurrogateKeys(c, customerKeys(&Customer{ID: 7, Tags: []string{"vip", "a b", "x\ty"}})...)
+
+	keys := strings.Fields(w.Header().Get("Surrogate-Key"))
+	if want := []string{customerKey(7), "tag-vip", "tag-a%20b", "tag-x%09y"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("Surrogate-Key %v, want %v", keys, want)
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"customer-service/db"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	compareSame       = "same"
+	compareDifferent  = "different"
+	compareOnlyOurs   = "only_ours"
+	compareOnlyTheirs = "only_theirs"
+)
+
+type fieldDiff struct {
+	Status string      `json:"status"`
+	Ours   interface{} `json:"ours"`
+	Theirs interface{} `json:"theirs"`
+}
+
+type comparison struct {
+	ID     int                  `json:"id"`
+	Match  bool                 `json:"match"`
+	Fields map[string]fieldDiff `json:"fields"`
+}
+
+// compareCustomer diffs the stored customer against a customer-shaped
+// payload from another system, field by field in their JSON form. Fields
+// that are empty on our side are absent from our JSON, so they compare as
+// only_theirs. Nothing is written.
+func compareCustomer(db *db.PostgresDB, c *gin.Context) (int, *comparison, error) {
+	var theirs map[string]interface{}
+	if err := bindJSON(c, &theirs); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	status, customer, err := getCustomer(db, c)
+	if err != nil {
+		return status, nil, err
+	}
+	b, err := json.Marshal(customer)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	var ours map[string]interface{}
+	if err := json.Unmarshal(b, &ours); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	fields := make([]string, 0, len(ours)+len(theirs))
+	for f := range ours {
+		fields = append(fields, f)
+	}
+	for f := range theirs {
+		if _, ok := ours[f]; !ok {
+			fields = append(fields, f)
+		}
+	}
+	sort.Strings(fields)
+
+	result := &comparison{ID: customer.ID, Match: true, Fields: make(map[string]fieldDiff, len(fields))}
+	for _, f := range fields {
+		o, inOurs := ours[f]
+		t, inTheirs := theirs[f]
+		diff := fieldDiff{Ours: o, Theirs: t}
+		switch {
+		case !inTheirs:
+			diff.Status = compareOnlyOurs
+		case !inOurs:
+			diff.Status = compareOnlyTheirs
+		case reflect.DeepEqual(o, t):
+			diff.Status = compareSame
+		default:
+			diff.Status = compareDifferent
+		}
+		if diff.Status != compareSame {
+			result.Match = false
+		}
+		result.Fields[f] = diff
+	}
+
+	return http.StatusOK, result, nil
+}
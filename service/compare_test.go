@@ -0,0 +1,54 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCompareReportsEachFieldsStatus(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.POST("/customers/:customerId/compare", a.CompareHandler)
+	var id int
+	if err := a.db.DB.Get(&id, `INSERT INTO customers (name, email, owner) VALUES ('Ada', 'ada@example.com', 'alice') RETURNING id`); err != nil {
+		t.Fatal(err)
+	}
+
+	target := fmt.Sprintf("/customers/%d/compare", id)
+	w := request(r, http.MethodPost, target, `{"name": "Ada", "email": "ada@other.example", "address": "1 Main St"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var result comparison
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Match || result.ID != id {
+		t.Errorf("comparison of %d matched %v, want a mismatch of %d", result.ID, result.Match, id)
+	}
+	for field, want := range map[string]string{
+		"name":    compareSame,
+		"email":   compareDifferent,
+		"address": compareOnlyTheirs,
+		"owner":   compareOnlyOurs,
+	} {
+		if got := result.Fields[field].Status; got != want {
+			t.Errorf("%s is %q, want %q", field, got, want)
+		}
+	}
+	if diff := result.Fields["email"]; diff.Ours != "ada@example.com" || diff.Theirs != "ada@other.example" {
+		t.Errorf("email diff %+v, want both values", diff)
+	}
+
+	var email string
+	if err := a.db.DB.Get(&email, `SELECT email FROM customers WHERE id = $1`, id); err != nil || email != "ada@example.com" {
+		t.Errorf("the compare changed the email to %q", email)
+	}
+	if w := request(r, http.MethodPost, fmt.Sprintf("/customers/%d/compare", id+1), `{}`); w.Code != http.StatusNotFound {
+		t.Errorf("comparing an unknown customer: got %d, want 404", w.Code)
+	}
+}
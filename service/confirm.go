@@ -0,0 +1,82 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultConfirmTTL = 5 * time.Minute
+
+// confirmation is what a confirmation token vouches for: the operation,
+// the exact request it was previewed for and how many customers it was
+// going to remove.
+type confirmation struct {
+	Op        string `json:"op"`
+	Scope     string `json:"scope"`
+	BodyHash  string `json:"body"`
+	Count     int    `json:"count"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// confirmationRequired reports whether destructive bulk operations need a
+// preview and confirm round trip. REQUIRE_CONFIRMATION=false turns it off
+// for automation that cannot do two calls.
+func confirmationRequired() bool {
+	return os.Getenv("REQUIRE_CONFIRMATION") != "false"
+}
+
+// bodyHash hashes the request body and puts it back for binding, so a
+// token only confirms the payload that was previewed.
+func bodyHash(c *gin.Context) (string, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func issueConfirmation(op, scope, hash string, count int) (string, time.Time, error) {
+	expires := time.Now().Add(envDuration("CONFIRM_TTL", defaultConfirmTTL))
+	token, err := signToken("confirm", &confirmation{Op: op, Scope: scope, BodyHash: hash, Count: count, ExpiresAt: expires.Unix()})
+	return token, expires, err
+}
+
+// confirmParams carry the token a preview returned and the count the
+// caller expects it to act on.
+type confirmParams struct {
+	Confirm       *string `form:"confirm"`
+	ExpectedCount *int    `form:"expectedCount"`
+}
+
+// checkConfirmation validates ?confirm= and ?expectedCount= against the
+// request and returns the count the caller agreed to.
+func checkConfirmation(p confirmParams, op, scope, hash string) (int, int, error) {
+	var conf confirmation
+	if !openToken("confirm", *p.Confirm, &conf) {
+		return http.StatusBadRequest, 0, fmt.Errorf("invalid confirmation token")
+	}
+	if time.Now().Unix() > conf.ExpiresAt {
+		return http.StatusBadRequest, 0, fmt.Errorf("confirmation token has expired; preview the operation again")
+	}
+	if conf.Op != op || conf.Scope != scope || conf.BodyHash != hash {
+		return http.StatusBadRequest, 0, fmt.Errorf("confirmation token was issued for a different request")
+	}
+	if p.ExpectedCount == nil {
+		return http.StatusBadRequest, 0, fmt.Errorf("expectedCount is required with confirm")
+	}
+	expected := *p.ExpectedCount
+	if expected != conf.Count {
+		return http.StatusConflict, 0, fmt.Errorf("expectedCount %d does not match the %d customers previewed", expected, conf.Count)
+	}
+	return http.StatusOK, expected, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"customer-service/db"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const correlationKey = "correlationID"
+
+// correlationPattern bounds what a client may send as its id, so it is
+// safe to log and repeat in headers.
+var correlationPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// Correlation gives every request a correlation id: the client's
+// X-Correlation-ID or X-Request-ID when it is well formed, or a fresh one.
+// It is echoed in the X-Correlation-ID response header, recorded on the
+// events the request causes and sent with the webhook deliveries for them.
+func Correlation(c *gin.Context) {
+	id := c.GetHeader("X-Correlation-ID")
+	if !correlationPattern.MatchString(id) {
+		id = c.GetHeader("X-Request-ID")
+	}
+	if !correlationPattern.MatchString(id) {
+		var err error
+		if id, err = newRandomID(); err != nil {
+			id = ""
+		}
+	}
+	c.Set(correlationKey, id)
+	c.Header("X-Correlation-ID", id)
+	c.Next()
+}
+
+// correlationID is the request's id from Correlation, or "" without it.
+func correlationID(c *gin.Context) string {
+	if c == nil {
+		return ""
+	}
+	return c.GetString(correlationKey)
+}
+
+// correlate makes the event log record id on every change made in tx.
+func correlate(tx *sqlx.Tx, id string) error {
+	if len(id) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(`SELECT set_config('app.correlation_id', $1, true)`, id)
+	return err
+}
+
+// beginRequest starts a transaction whose changes are correlated with c.
+func beginRequest(db *db.PostgresDB, c *gin.Context) (*sqlx.Tx, error) {
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	if err := correlate(tx, correlationID(c)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// inRequest runs a single write in a transaction correlated with c and
+// commits it when fn succeeds.
+func inRequest(db *db.PostgresDB, c *gin.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := beginRequest(db, c)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type correlationContextKey struct{}
+
+// withCorrelation carries a correlation id to a webhook delivery.
+func withCorrelation(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationContextKey{}, id)
+}
+
+func correlationFrom(ctx context.Context) string {
+	id, _ := ctx.Value(correlationContextKey{}).(string)
+	return id
+}
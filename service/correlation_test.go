@@ -0,0 +1,97 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCorrelationIDIsEchoedOrGenerated(t *testing.T) {
+	r := gin.New()
+	r.Use(Correlation)
+	r.GET("/", func(c *gin.Context) { c.String(http.StatusOK, correlationID(c)) })
+
+	for _, tc := range []struct {
+		headers []string
+		want    string
+	}{
+		{[]string{"X-Correlation-ID", "req-123"}, "req-123"},
+		{[]string{"X-Request-ID", "abc.42"}, "abc.42"},
+		{[]string{"X-Correlation-ID", "not valid", "X-Request-ID", "fallback"}, "fallback"},
+		{[]string{"X-Correlation-ID", "not valid"}, ""},
+		{nil, ""},
+	} {
+		w := request(r, http.MethodGet, "/", "", tc.headers...)
+		got := w.Header().Get("X-Correlation-ID")
+		if got != w.Body.String() {
+			t.Errorf("%v: the header says %q, the handler saw %q", tc.headers, got, w.Body)
+		}
+		if len(tc.want) != 0 && got != tc.want {
+			t.Errorf("%v: got %q, want %q", tc.headers, got, tc.want)
+		}
+		if len(tc.want) == 0 && !correlationPattern.MatchString(got) {
+			t.Errorf("%v: generated %q, want a well formed id", tc.headers, got)
+		}
+	}
+}
+
+func TestCorrelationIDReachesTheEventAndTheHookDeliveries(t *testing.T) {
+	pg := postgresDB(t)
+	t.Setenv("WEBHOOK_REPLAY_RATE", "1000")
+	delivered := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- r.Header.Get("X-Correlation-ID")
+	}))
+	defer server.Close()
+	next := func() string {
+		t.Helper()
+		select {
+		case id := <-delivered:
+			return id
+		case <-time.After(5 * time.Second):
+			t.Fatal("the create hook was not delivered")
+			return ""
+		}
+	}
+
+	a := GetApp(pg)
+	a.SetCreateHook(&httpCreateHook{url: server.URL, client: server.Client(), version: eventSchemaV1})
+	r := gin.New()
+	r.Use(Correlation)
+	r.POST("/customers", a.PostHandler)
+	r.POST("/admin/webhooks/replay", a.ReplayHandler)
+
+	from := time.Now().Add(-time.Minute)
+	w := request(r, http.MethodPost, "/customers", `{"name": "Ada", "email": "ada@example.com"}`, "X-Correlation-ID", "req-123")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	var created Customer
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(); got != "req-123" {
+		t.Errorf("the delivery carried X-Correlation-ID %q, want req-123", got)
+	}
+
+	var logged string
+	if err := pg.DB.Get(&logged, `SELECT COALESCE(correlation_id, '') FROM customer_events WHERE customer_id = $1 AND type = 'customer.created'`, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	if logged != "req-123" {
+		t.Errorf("the event recorded correlation id %q, want req-123", logged)
+	}
+
+	target := "/admin/webhooks/replay?from=" + url.QueryEscape(from.Format(time.RFC3339))
+	if w := request(r, http.MethodPost, target, "", "X-Correlation-ID", "replay-1"); w.Code != http.StatusAccepted {
+		t.Fatalf("replay: %d %s", w.Code, w.Body)
+	}
+	if got := next(); got != "req-123" {
+		t.Errorf("the replay carried X-Correlation-ID %q, want the original req-123", got)
+	}
+}
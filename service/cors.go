@@ -0,0 +1,48 @@
+package service
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exposedHeaders are the response headers browser clients may read besides
+// the CORS-safelisted ones.
+var exposedHeaders = []string{"X-Total-Count", "ETag", "Location", "Retry-After", "Ensure-Result", "X-Correlation-ID", "Warning"}
+
+// CORS lets browsers on the origins in the comma separated
+// CORS_ALLOWED_ORIGINS call the API, "*" allowing any. Without it no CORS
+// headers are sent. Preflight requests are answered here.
+func CORS() gin.HandlerFunc {
+	allowed := map[string]bool{}
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); len(origin) != 0 {
+			allowed[origin] = true
+		}
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if len(origin) == 0 || !(allowed["*"] || allowed[origin]) {
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Vary", "Origin")
+		c.Header("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+
+		if c.Request.Method == http.MethodOptions && len(c.GetHeader("Access-Control-Request-Method")) != 0 {
+			c.Header("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, DELETE")
+			if headers := c.GetHeader("Access-Control-Request-Headers"); len(headers) != 0 {
+				c.Header("Access-Control-Allow-Headers", headers)
+			}
+			c.Header("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
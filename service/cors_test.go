@@ -0,0 +1,30 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORSExposesTheTotalCountToAllowedOrigins(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example, https://admin.example")
+	r := gin.New()
+	r.Use(CORS())
+	r.GET("/customers", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := request(r, http.MethodGet, "/customers", "", "Origin", "https://app.example")
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example" ||
+		!strings.Contains(w.Header().Get("Access-Control-Expose-Headers"), "X-Total-Count") {
+		t.Errorf("allowed origin got headers %v, want X-Total-Count exposed", w.Header())
+	}
+	if w := request(r, http.MethodGet, "/customers", "", "Origin", "https://evil.example"); len(w.Header().Get("Access-Control-Allow-Origin")) != 0 {
+		t.Errorf("another origin was allowed: %v", w.Header())
+	}
+
+	w = request(r, http.MethodOptions, "/customers", "", "Origin", "https://admin.example", "Access-Control-Request-Method", "GET")
+	if w.Code != http.StatusNoContent || len(w.Header().Get("Access-Control-Allow-Methods")) == 0 {
+		t.Errorf("preflight: got %d %v, want 204 with the allowed methods", w.Code, w.Header())
+	}
+}
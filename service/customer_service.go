@@ -4,49 +4,165 @@ import (
 	"customer-service/db"
 	"database/sql"
 	"fmt"
+	"log"
 	"net/http"
-	"strconv"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type Customer struct {
-	ID      int    `json:"id"`
-	Name    string `json:"name,omitempty"`
-	Email   string `json:"email"`
-	Address string `json:"address,omitempty"`
+	ID        int            `json:"id"`
+	Name      string         `json:"name,omitempty"`
+	Email     string         `json:"email"`
+	Address   string         `json:"address,omitempty"`
+	Owner     string         `json:"owner,omitempty"`
+	Partner   string         `json:"partner,omitempty"`
+	Reference string         `json:"client_reference_id,omitempty" db:"client_reference_id"`
+	Tags      pq.StringArray `json:"tags"`
+	ParentID  *int           `json:"parent_id,omitempty" db:"parent_id"`
+	Lat       *float64       `json:"lat,omitempty"`
+	Lng       *float64       `json:"lng,omitempty"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at" db:"updated_at"`
+	// DeletedAt is set on customers a sync soft-deleted, which only
+	// snapshots include.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+
+	// Warnings is only set on create and update responses.
+	Warnings []fieldWarning `json:"warnings,omitempty" db:"-"`
+	// AgeDays is only set on single-customer GET responses.
+	AgeDays *int `json:"age_days,omitempty" db:"-"`
+}
+
+// customerColumns selects a customer row in a shape sqlx can scan into
+// Customer even when the nullable columns are NULL.
+const customerColumns = `id, COALESCE(name, '') AS name, email, COALESCE(address, '') AS address, owner,
+	partner, COALESCE(client_reference_id, '') AS client_reference_id, tags, parent_id, lat, lng, created_at, updated_at, deleted_at`
+
+// notDeleted matches the customers that have not been soft-deleted. Every
+// read and write of a customer is limited to them.
+const notDeleted = `deleted_at IS NULL`
+
+// putFields reads the fields a PUT replaces, by name.
+var putFields = map[string]func(*Customer) string{
+	"name":    func(c *Customer) string { return c.Name },
+	"email":   func(c *Customer) string { return c.Email },
+	"address": func(c *Customer) string { return c.Address },
+	"owner":   func(c *Customer) string { return c.Owner },
+}
+
+var (
+	putRequiredOnce sync.Once
+	putRequired     []string
+)
+
+// requiredPutFields lists the fields a PUT must carry, from the comma
+// separated PUT_REQUIRED_FIELDS. It defaults to name and email so a
+// replacement cannot silently drop them. GetApp reads it at startup.
+func requiredPutFields() []string {
+	putRequiredOnce.Do(func() {
+		putRequired = []string{"name", "email"}
+		if raw, ok := os.LookupEnv("PUT_REQUIRED_FIELDS"); ok {
+			putRequired = parseRequiredFields(raw)
+		}
+	})
+	return putRequired
+}
+
+// parseRequiredFields splits a PUT_REQUIRED_FIELDS value. Names that are not
+// PUT fields are logged and dropped; left in, they could never be present
+// and every PUT would fail.
+func parseRequiredFields(raw string) []string {
+	fields := make([]string, 0)
+	for _, f := range strings.Split(raw, ",") {
+		if f = strings.TrimSpace(f); len(f) == 0 {
+			continue
+		}
+		if _, ok := putFields[f]; !ok {
+			log.Printf("ignoring unknown field %q in PUT_REQUIRED_FIELDS; PUT fields are address, email, name and owner", f)
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func missingFields(customer *Customer, required []string) []string {
+	missing := make([]string, 0)
+	for _, f := range required {
+		if len(putFields[f](customer)) == 0 {
+			validationFailures.Add(f+"."+codeRequired, 1)
+			missing = append(missing, f)
+		}
+	}
+	return missing
 }
 
 func createCustomer(db *db.PostgresDB, c *gin.Context) (int, *Customer, error) {
 	var customer Customer
-	if err := c.ShouldBindJSON(&customer); err != nil {
+	if err := bindJSON(c, &customer); err != nil {
 		return http.StatusBadRequest, nil, err
 	}
 
-	if len(customer.Email) == 0 {
-		return http.StatusBadRequest, nil, fmt.Errorf("email cannot be empty")
+	if err := validateCustomer(&customer); err != nil {
+		return http.StatusBadRequest, nil, err
 	}
-	stmt := `INSERT INTO customers (name, email, address) VALUES ($1, $2, $3) RETURNING id`
-	err := db.DB.QueryRow(stmt, customer.Name, customer.Email, customer.Address).Scan(&customer.ID)
+	if err := validateFields(&customer); err != nil {
+		return http.StatusUnprocessableEntity, nil, err
+	}
+	warnings, err := checkWarnings(&customer)
 	if err != nil {
-		return http.StatusInternalServerError, nil, err
+		return http.StatusUnprocessableEntity, nil, err
+	}
+	stmt := `INSERT INTO customers (name, email, address, owner) VALUES ($1, $2, $3, $4) RETURNING ` + customerColumns
+	err = inRequest(db, c, func(tx *sqlx.Tx) error {
+		return tx.QueryRowx(stmt, customer.Name, customer.Email, customer.Address, customer.Owner).StructScan(&customer)
+	})
+	if err != nil {
+		status, err := writeFailed(err, customer.Email)
+		return status, nil, err
 	}
 
+	customer.Warnings = warnings
 	return http.StatusCreated, &customer, nil
 }
 
+// writeFailed maps a failed insert or update to a response status.
+// Soft-deleted customers keep their email, so the customer holding it may
+// not be visible to the caller.
+func writeFailed(err error, email string) (int, error) {
+	if db.IsUniqueViolation(err) {
+		return http.StatusConflict, fmt.Errorf("email %q belongs to another customer, possibly a deleted one", email)
+	}
+	return http.StatusInternalServerError, err
+}
+
 func getCustomer(db *db.PostgresDB, c *gin.Context) (int, *Customer, error) {
-	customerID := c.Param("customerId")
-	id, err := strconv.Atoi(customerID)
+	id, err := paramID(c)
 	if err != nil {
 		return http.StatusBadRequest, nil, err
 	}
 
 	var customer Customer
-	stmt := `SELECT id, name, email, address FROM customers WHERE id = $1`
-	err = db.DB.QueryRow(stmt, id).Scan(&customer.ID, &customer.Name, &customer.Email, &customer.Address)
+	stmt := `SELECT ` + customerColumns + ` FROM customers WHERE id = $1 AND ` + notDeleted
+	err = db.DB.Get(&customer, stmt, id)
 
 	if err == sql.ErrNoRows {
+		if tombstonesEnabled() {
+			gone, err := isTombstoned(db, id)
+			if err != nil {
+				return http.StatusInternalServerError, nil, err
+			}
+			if gone {
+				return http.StatusGone, nil, fmt.Errorf("customer %d has been deleted", id)
+			}
+		}
 		return http.StatusNotFound, nil, err
 	}
 
@@ -58,57 +174,138 @@ func getCustomer(db *db.PostgresDB, c *gin.Context) (int, *Customer, error) {
 }
 
 func updateCustomer(db *db.PostgresDB, c *gin.Context) (int, *Customer, error) {
-	customerID := c.Param("customerId")
-	id, err := strconv.Atoi(customerID)
+	id, err := paramID(c)
 	if err != nil {
 		return http.StatusBadRequest, nil, err
 	}
 
 	var customer Customer
-	if err := c.ShouldBindJSON(&customer); err != nil {
+	if err := bindJSON(c, &customer); err != nil {
 		return http.StatusBadRequest, nil, err
 	}
 
+	if missing := missingFields(&customer, requiredPutFields()); len(missing) != 0 {
+		return http.StatusUnprocessableEntity, nil, fmt.Errorf("missing required fields: %s", strings.Join(missing, ", "))
+	}
+	if err := validateFields(&customer); err != nil {
+		return http.StatusUnprocessableEntity, nil, err
+	}
+	warnings, err := checkWarnings(&customer)
+	if err != nil {
+		return http.StatusUnprocessableEntity, nil, err
+	}
+	customer.Warnings = warnings
+
 	fieldsNum := 0
 	fields := make([]interface{}, 0)
-	stmt := `UPDATE customers SET `
+	sets := make([]string, 0)
+	changes := make([]string, 0)
 	if len(customer.Address) != 0 {
 		fieldsNum += 1
-		stmt += fmt.Sprintf("address = $%d ", fieldsNum)
+		sets = append(sets, fmt.Sprintf("address = $%d", fieldsNum))
+		changes = append(changes, fmt.Sprintf("address IS DISTINCT FROM $%d", fieldsNum))
 		fields = append(fields, customer.Address)
 	}
 	if len(customer.Name) != 0 {
 		fieldsNum += 1
-		stmt += fmt.Sprintf("name = $%d ", fieldsNum)
+		sets = append(sets, fmt.Sprintf("name = $%d", fieldsNum))
+		changes = append(changes, fmt.Sprintf("name IS DISTINCT FROM $%d", fieldsNum))
 		fields = append(fields, customer.Name)
 	}
+	if len(customer.Email) != 0 {
+		fieldsNum += 1
+		sets = append(sets, fmt.Sprintf("email = $%d", fieldsNum))
+		changes = append(changes, fmt.Sprintf("email IS DISTINCT FROM $%d", fieldsNum))
+		fields = append(fields, customer.Email)
+	}
+	if len(customer.Owner) != 0 {
+		fieldsNum += 1
+		sets = append(sets, fmt.Sprintf("owner = $%d", fieldsNum))
+		changes = append(changes, fmt.Sprintf("owner IS DISTINCT FROM $%d", fieldsNum))
+		fields = append(fields, customer.Owner)
+	}
 	if fieldsNum == 0 {
 		return http.StatusNotModified, &customer, nil
 	}
 	fieldsNum += 1
-	stmt += fmt.Sprintf("WHERE id = $%d RETURNING id, name, email, address", fieldsNum)
+	stmt := `UPDATE customers SET updated_at = now(), ` + strings.Join(sets, ", ")
+	// Only touch the row when at least one value actually differs, so
+	// re-PUTting the stored values is a no-op.
+	stmt += fmt.Sprintf(" WHERE id = $%d AND %s AND (%s)", fieldsNum, notDeleted, strings.Join(changes, " OR "))
+	stmt += " RETURNING " + customerColumns
 	fields = append(fields, id)
 
-	err = db.DB.QueryRow(stmt, fields...).Scan(&customer.ID, &customer.Name, &customer.Email, &customer.Address)
+	err = inRequest(db, c, func(tx *sqlx.Tx) error {
+		return tx.QueryRowx(stmt, fields...).StructScan(&customer)
+	})
+	if err == sql.ErrNoRows {
+		return unchangedOrMissing(db, id, &customer)
+	}
 	if err != nil {
-		return http.StatusInternalServerError, nil, err
+		status, err := writeFailed(err, customer.Email)
+		return status, nil, err
 	}
 
 	customer.ID = id
+	customer.Warnings = warnings
 	return http.StatusOK, &customer, nil
 }
 
+func fetchCustomer(db *db.PostgresDB, id int) (*Customer, error) {
+	var customer Customer
+	if err := db.DB.Get(&customer, `SELECT `+customerColumns+` FROM customers WHERE id = $1 AND `+notDeleted, id); err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// unchangedOrMissing resolves an UPDATE that matched no row: either the
+// customer does not exist or the update would not have changed it.
+func unchangedOrMissing(db *db.PostgresDB, id int, customer *Customer) (int, *Customer, error) {
+	var exists bool
+	err := db.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1 AND `+notDeleted+`)`, id).Scan(&exists)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if !exists {
+		return http.StatusNotFound, nil, sql.ErrNoRows
+	}
+
+	return http.StatusNotModified, customer, nil
+}
+
 func deleteCustomer(db *db.PostgresDB, c *gin.Context) (int, error) {
-	customerID := c.Param("customerId")
-	id, err := strconv.Atoi(customerID)
+	id, err := paramID(c)
 	if err != nil {
 		return http.StatusBadRequest, err
 	}
 
-	stmt := `DELETE FROM customers WHERE id = $1`
-	_, err = db.DB.Exec(stmt, id)
+	where := `id = $1 AND ` + notDeleted
+	args := []interface{}{id}
+	// HTTP dates have second precision, so compare against updated_at
+	// truncated to the second. An unparsable date is ignored per RFC 9110.
+	if since, err := http.ParseTime(c.GetHeader("If-Unmodified-Since")); err == nil {
+		where += ` AND date_trunc('second', updated_at) <= $2`
+		args = append(args, since)
+	}
+
+	deleted := make([]int, 0)
+	err = inRequest(db, c, func(tx *sqlx.Tx) error {
+		return tx.Select(&deleted, deleteStmt(where, "id"), args...)
+	})
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return deleteFailed(err)
+	}
+
+	if len(deleted) == 0 && len(args) > 1 {
+		var exists bool
+		err := db.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1 AND `+notDeleted+`)`, id).Scan(&exists)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if exists {
+			return http.StatusPreconditionFailed, fmt.Errorf("customer %d was modified after the If-Unmodified-Since date", id)
+		}
 	}
 
 	return http.StatusNoContent, nil
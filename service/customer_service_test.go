@@ -0,0 +1,128 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPutWithoutEmailIsRejected(t *testing.T) {
+	a := GetApp(nil)
+	r := gin.New()
+	r.PUT("/customers/:customerId", a.SerializeCustomer, a.PutHandler)
+
+	w := request(r, http.MethodPut, "/customers/1", `{"name": "Ada", "address": "1 Main St"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d, want 422: %s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "missing required fields: email") {
+		t.Errorf("body does not list email as missing: %s", w.Body)
+	}
+}
+
+func TestPutOfTheStoredValuesIsNotModified(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.PUT("/customers/:customerId", a.SerializeCustomer, a.PutHandler)
+	id := seedCustomers(t, a, 1, "alice")[0]
+	target := fmt.Sprintf("/customers/%d", id)
+	body := `{"name": "Ada", "email": "ada@example.com", "address": "1 Main St"}`
+
+	if w := request(r, http.MethodPut, target, body); w.Code != http.StatusOK {
+		t.Fatalf("first PUT: %d %s", w.Code, w.Body)
+	}
+	var updatedAt time.Time
+	a.db.DB.Get(&updatedAt, `SELECT updated_at FROM customers WHERE id = $1`, id)
+
+	if w := request(r, http.MethodPut, target, body); w.Code != http.StatusNotModified {
+		t.Fatalf("second PUT: got %d, want 304: %s", w.Code, w.Body)
+	}
+	var after time.Time
+	a.db.DB.Get(&after, `SELECT updated_at FROM customers WHERE id = $1`, id)
+	if !after.Equal(updatedAt) {
+		t.Errorf("the no-op PUT moved updated_at from %v to %v", updatedAt, after)
+	}
+	if w := request(r, http.MethodPut, "/customers/999999", body); w.Code != http.StatusNotFound {
+		t.Errorf("PUT of an unknown id: got %d, want 404", w.Code)
+	}
+}
+
+func TestDeleteHonoursIfUnmodifiedSince(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.DELETE("/customers/:customerId", a.SerializeCustomer, a.DeleteHandler)
+	id := seedCustomers(t, a, 1, "alice")[0]
+	a.db.DB.MustExec(`UPDATE customers SET updated_at = '2024-03-01T12:00:00Z' WHERE id = $1`, id)
+	target := fmt.Sprintf("/customers/%d", id)
+
+	stale := time.Date(2024, time.March, 1, 11, 59, 59, 0, time.UTC).Format(http.TimeFormat)
+	if w := request(r, http.MethodDelete, target, "", "If-Unmodified-Since", stale); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale If-Unmodified-Since: got %d, want 412: %s", w.Code, w.Body)
+	}
+	if got := len(owners(t, a)); got != 1 {
+		t.Fatalf("the refused delete removed the customer")
+	}
+	current := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	if w := request(r, http.MethodDelete, target, "", "If-Unmodified-Since", current); w.Code != http.StatusNoContent {
+		t.Errorf("current If-Unmodified-Since: got %d, want 204: %s", w.Code, w.Body)
+	}
+}
+
+func TestDeleteLeavesSoftDeletedCustomersAlone(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.DELETE("/customers/:customerId", a.SerializeCustomer, a.DeleteHandler)
+	var id int
+	if err := a.db.DB.Get(&id, `INSERT INTO customers (name, email, owner, updated_at, deleted_at)
+	VALUES ('Ada', 'ada@example.com', 'alice', '2024-03-01T12:00:00Z', now()) RETURNING id`); err != nil {
+		t.Fatal(err)
+	}
+	target := fmt.Sprintf("/customers/%d", id)
+
+	stale := time.Date(2024, time.March, 1, 11, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	if w := request(r, http.MethodDelete, target, "", "If-Unmodified-Since", stale); w.Code != http.StatusNoContent {
+		t.Errorf("stale If-Unmodified-Since on a deleted customer: got %d, want 204: %s", w.Code, w.Body)
+	}
+	if w := request(r, http.MethodDelete, target, ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE of a deleted customer: got %d, want 204: %s", w.Code, w.Body)
+	}
+	var kept int
+	if err := a.db.DB.Get(&kept, `SELECT COUNT(*) FROM customers WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+	if kept != 1 {
+		t.Errorf("DELETE hard-deleted the soft-deleted customer")
+	}
+}
+
+func TestReusingASoftDeletedEmailConflicts(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.POST("/customers", a.PostHandler)
+	r.PUT("/customers/:customerId", a.SerializeCustomer, a.PutHandler)
+	id := seedCustomers(t, a, 1, "alice")[0]
+	a.db.DB.MustExec(`INSERT INTO customers (name, email, owner, deleted_at) VALUES ('Ada', 'ada@example.com', 'alice', now())`)
+
+	if w := request(r, http.MethodPost, "/customers", `{"name": "Ada", "email": "ada@example.com", "owner": "alice"}`); w.Code != http.StatusConflict {
+		t.Errorf("POST with a soft-deleted email: got %d, want 409: %s", w.Code, w.Body)
+	}
+	body := `{"name": "Ada", "email": "ada@example.com"}`
+	if w := request(r, http.MethodPut, fmt.Sprintf("/customers/%d", id), body); w.Code != http.StatusConflict {
+		t.Errorf("PUT with a soft-deleted email: got %d, want 409: %s", w.Code, w.Body)
+	}
+}
+
+func TestParseRequiredFieldsDropsUnknownNames(t *testing.T) {
+	got := parseRequiredFields(" name, phone ,,email")
+	if want := []string{"name", "email"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if missing := missingFields(&Customer{Name: "Ada", Email: "ada@example.com"}, got); len(missing) != 0 {
+		t.Errorf("a PUT with every known field was missing %v", missing)
+	}
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"customer-service/db"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultDedupThreshold = 0.8
+
+type dedupGroup struct {
+	Reasons   []string   `json:"reasons"`
+	Customers []Customer `json:"customers"`
+
+	// Status is set in auto-merge mode: merged or review.
+	Status string `json:"status,omitempty"`
+
+	// A merged group reports what the merge did to the survivor: the
+	// fields it took from the merged customers and the children that
+	// moved to it.
+	Survivor      int      `json:"survivor_id,omitempty"`
+	Filled        []string `json:"filled_fields,omitempty"`
+	MovedChildren []int    `json:"moved_children,omitempty"`
+}
+
+type dedupReport struct {
+	Scanned   int          `json:"scanned"`
+	Threshold float64      `json:"threshold"`
+	Groups    []dedupGroup `json:"groups"`
+
+	// TransactionID undoes the merges; set when any were made.
+	TransactionID string `json:"transaction_id,omitempty"`
+
+	// Preview is set when the merges were worked out and rolled back.
+	Preview bool `json:"preview,omitempty"`
+
+	// changed lists the survivors and merged customers, for purging.
+	changed []int
+}
+
+// dedupThreshold is the ?threshold= default, read from DEDUP_THRESHOLD.
+func dedupThreshold() float64 {
+	if v, err := strconv.ParseFloat(os.Getenv("DEDUP_THRESHOLD"), 64); err == nil {
+		return v
+	}
+	return defaultDedupThreshold
+}
+
+// findDuplicates reports groups of likely duplicates. With ?merge=true,
+// groups that pass the safety rules of safeToMerge are merged in one
+// transaction that POST /customers/transactions/{txId}/undo reverses, and
+// the rest are marked for review. Adding ?preview=true makes the same
+// merges and rolls them back, reporting what they would do.
+func findDuplicates(db *db.PostgresDB, c *gin.Context) (int, *dedupReport, error) {
+	p := struct {
+		Threshold float64 `form:"threshold"`
+		Owner     string  `form:"owner"`
+		Merge     bool    `form:"merge"`
+		Preview   bool    `form:"preview"`
+	}{Threshold: dedupThreshold()}
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	threshold, merge, preview := p.Threshold, p.Merge, p.Preview
+	if threshold <= 0 || threshold > 1 {
+		return http.StatusBadRequest, nil, fmt.Errorf("threshold must be in (0, 1]")
+	}
+	if preview && !merge {
+		return http.StatusBadRequest, nil, fmt.Errorf("preview needs merge=true")
+	}
+
+	var report *dedupReport
+	ran, err := db.RunExclusive(c.Request.Context(), "customer-dedup", func() error {
+		customers, err := scanDedupScope(db, p.Owner)
+		if err != nil {
+			return err
+		}
+		report = groupDuplicates(customers, threshold)
+		if merge {
+			return mergeDuplicates(db, c, report, preview)
+		}
+		return nil
+	})
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if !ran {
+		return http.StatusConflict, nil, fmt.Errorf("a dedup job is already running")
+	}
+
+	return http.StatusOK, report, nil
+}
+
+// scanDedupScope loads the customers the job compares, optionally limited to
+// a single owner's book.
+func scanDedupScope(db *db.PostgresDB, owner string) ([]Customer, error) {
+	stmt := `SELECT ` + customerColumns + ` FROM customers WHERE ` + notDeleted
+	args := make([]interface{}, 0)
+	if len(owner) != 0 {
+		stmt += ` AND owner = $1`
+		args = append(args, owner)
+	}
+	stmt += ` ORDER BY id`
+
+	customers := make([]Customer, 0)
+	if err := db.DB.Select(&customers, stmt, args...); err != nil {
+		return nil, err
+	}
+	return customers, nil
+}
+
+// groupDuplicates links customers sharing an email (case-insensitively) or
+// whose name and address are both at least threshold similar, and returns
+// the connected groups. Nothing is merged.
+func groupDuplicates(customers []Customer, threshold float64) *dedupReport {
+	parent := make([]int, len(customers))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	reasons := make(map[int]map[string]bool)
+	link := func(i, j int, reason string) {
+		ri, rj := find(i), find(j)
+		if ri != rj {
+			parent[rj] = ri
+			for r := range reasons[rj] {
+				if reasons[ri] == nil {
+					reasons[ri] = make(map[string]bool)
+				}
+				reasons[ri][r] = true
+			}
+			delete(reasons, rj)
+		}
+		if reasons[ri] == nil {
+			reasons[ri] = make(map[string]bool)
+		}
+		reasons[ri][reason] = true
+	}
+
+	emails := make([]string, len(customers))
+	first := make(map[string]int)
+	for i, customer := range customers {
+		emails[i] = strings.ToLower(strings.TrimSpace(customer.Email))
+		if j, ok := first[emails[i]]; ok {
+			link(j, i, "email")
+		} else {
+			first[emails[i]] = i
+		}
+	}
+
+	// Each customer's trigrams are worked out once, and only customers
+	// whose names could be threshold similar are compared.
+	names := make([]map[string]struct{}, len(customers))
+	addresses := make([]map[string]struct{}, len(customers))
+	for i, customer := range customers {
+		if len(customer.Name) != 0 && len(customer.Address) != 0 {
+			names[i], addresses[i] = trigrams(customer.Name), trigrams(customer.Address)
+		}
+	}
+	for _, pair := range similarPairs(names, threshold) {
+		i, j := pair[0], pair[1]
+		if emails[i] == emails[j] {
+			continue
+		}
+		if trigramSimilarity(names[i], names[j]) >= threshold && trigramSimilarity(addresses[i], addresses[j]) >= threshold {
+			link(i, j, "name_address")
+		}
+	}
+
+	members := make(map[int][]Customer)
+	roots := make([]int, 0)
+	for i, customer := range customers {
+		root := find(i)
+		if _, ok := members[root]; !ok {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], customer)
+	}
+
+	report := &dedupReport{Scanned: len(customers), Threshold: threshold, Groups: make([]dedupGroup, 0)}
+	for _, root := range roots {
+		if len(members[root]) < 2 {
+			continue
+		}
+		group := dedupGroup{Customers: members[root]}
+		for _, r := range []string{"email", "name_address"} {
+			if reasons[root][r] {
+				group.Reasons = append(group.Reasons, r)
+			}
+		}
+		report.Groups = append(report.Groups, group)
+	}
+	return report
+}
+
+// mergeDuplicates auto-merges the report's safe groups and sets every
+// group's status. A preview rolls the merges back.
+func mergeDuplicates(db *db.PostgresDB, c *gin.Context, report *dedupReport, preview bool) error {
+	txID, err := newRandomID()
+	if err != nil {
+		return err
+	}
+	tx, err := beginRequest(db, c)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := tagTransaction(tx, txID); err != nil {
+		return err
+	}
+
+	threshold := mergeThreshold()
+	for i := range report.Groups {
+		group := &report.Groups[i]
+		changed, err := mergeGroup(tx, c, group, threshold)
+		if err != nil {
+			return err
+		}
+		group.Status = groupReview
+		if len(changed) != 0 {
+			group.Status = groupMerged
+			report.changed = append(report.changed, changed...)
+		}
+	}
+
+	if preview {
+		report.Preview, report.changed = true, nil
+		return nil
+	}
+	if len(report.changed) == 0 {
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	report.TransactionID = txID
+	return nil
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func dedupRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.POST("/admin/customers/dedup", a.DedupHandler)
+	return r
+}
+
+func groupIDs(report *dedupReport) [][]int {
+	groups := make([][]int, 0, len(report.Groups))
+	for _, group := range report.Groups {
+		ids := make([]int, 0, len(group.Customers))
+		for _, customer := range group.Customers {
+			ids = append(ids, customer.ID)
+		}
+		groups = append(groups, ids)
+	}
+	return groups
+}
+
+func TestGroupDuplicatesLinksEmailsAndSimilarNamesAtAddresses(t *testing.T) {
+	customers := []Customer{
+		{ID: 1, Name: "Ada Lovelace", Email: "ada@example.com"},
+		{ID: 2, Name: "Bob Stone", Email: "bob@example.com", Address: "12 High Street"},
+		{ID: 3, Name: "A. Lovelace", Email: " ADA@example.com"},
+		{ID: 4, Name: "Bob Stone", Email: "robert@example.com", Address: "12 High Street."},
+		{ID: 5, Name: "Carol King", Email: "carol@example.com", Address: "12 High Street"},
+	}
+	report := groupDuplicates(customers, 0.8)
+
+	if want := [][]int{{1, 3}, {2, 4}}; !reflect.DeepEqual(groupIDs(report), want) {
+		t.Fatalf("groups %v, want %v", groupIDs(report), want)
+	}
+	if got := report.Groups[0].Reasons; !reflect.DeepEqual(got, []string{"email"}) {
+		t.Errorf("first group reasons %v, want email", got)
+	}
+	if got := report.Groups[1].Reasons; !reflect.DeepEqual(got, []string{"name_address"}) {
+		t.Errorf("second group reasons %v, want name_address", got)
+	}
+	if report.Scanned != 5 {
+		t.Errorf("scanned %d, want 5", report.Scanned)
+	}
+}
+
+func TestDedupReportsSeededDuplicates(t *testing.T) {
+	pg := postgresDB(t)
+	r := dedupRouter(GetApp(pg))
+	pg.DB.MustExec(`INSERT INTO customers (name, email, owner) VALUES
+	    ('Ada Lovelace', 'ada@example.com', 'alice'), ('Bob Stone', 'bob@example.com', 'alice'),
+	    ('Ada Lovelace', 'ADA@example.com', 'alice'), ('Ada Lovelace', 'ada@other.example', 'bob')`)
+
+	w := request(r, http.MethodPost, "/admin/customers/dedup?owner=alice", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var report dedupReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{{1, 3}}; report.Scanned != 3 || !reflect.DeepEqual(groupIDs(&report), want) {
+		t.Errorf("scanned %d into groups %v, want 3 into %v", report.Scanned, groupIDs(&report), want)
+	}
+	if report.Groups[0].Status != "" || len(owners(t, GetApp(pg))) != 4 {
+		t.Errorf("a report without merge=true merged customers")
+	}
+}
+
+func TestDedupPreviewNeedsMerge(t *testing.T) {
+	r := dedupRouter(GetApp(nil))
+	if w := request(r, http.MethodPost, "/admin/customers/dedup?preview=true", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want 400: %s", w.Code, w.Body)
+	}
+}
+
+func TestDedupMergePreviewChangesNothing(t *testing.T) {
+	pg := postgresDB(t)
+	a := GetApp(pg)
+	r := dedupRouter(a)
+
+	var survivor, dup, child int
+	pg.DB.QueryRow(`INSERT INTO customers (name, email) VALUES ('Ada Lovelace', 'ada@example.com') RETURNING id`).Scan(&survivor)
+	pg.DB.QueryRow(`INSERT INTO customers (name, email, address, tags) VALUES ('Ada Lovelace', 'ADA@example.com', '1 Main St', '{vip}') RETURNING id`).Scan(&dup)
+	pg.DB.QueryRow(`INSERT INTO customers (name, email, parent_id) VALUES ('Ada Jr', 'jr@example.com', $1) RETURNING id`, dup).Scan(&child)
+	var before []Customer
+	if err := pg.DB.Select(&before, `SELECT `+customerColumns+` FROM customers ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+
+	w := request(r, http.MethodPost, "/admin/customers/dedup?merge=true&preview=true", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var report dedupReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Preview || len(report.TransactionID) != 0 || len(report.Groups) != 1 {
+		t.Fatalf("report: %s, want one previewed group and no transaction", w.Body)
+	}
+	group := report.Groups[0]
+	if group.Status != groupMerged || group.Survivor != survivor {
+		t.Errorf("group %s into %d, want merged into %d", group.Status, group.Survivor, survivor)
+	}
+	if want := []string{"address", "tags"}; !reflect.DeepEqual(group.Filled, want) {
+		t.Errorf("filled fields %v, want %v", group.Filled, want)
+	}
+	if want := []int{child}; !reflect.DeepEqual(group.MovedChildren, want) {
+		t.Errorf("moved children %v, want %v", group.MovedChildren, want)
+	}
+
+	var after []Customer
+	if err := pg.DB.Select(&after, `SELECT `+customerColumns+` FROM customers ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("the preview changed the customers:\n%+v\nwant\n%+v", after, before)
+	}
+	var audited bool
+	if err := pg.DB.Get(&audited, `SELECT EXISTS (SELECT 1 FROM customer_audit WHERE action = 'merge')`); err != nil || audited {
+		t.Errorf("the preview audited a merge")
+	}
+}
+
+func TestSafeToMergeNeedsTheSameEmailCloseNamesAndNoConflicts(t *testing.T) {
+	ada := Customer{ID: 1, Name: "Ada Lovelace", Email: "ada@example.com", Address: "1 Main St"}
+	for name, c := range map[string]struct {
+		other Customer
+		want  bool
+	}{
+		"clear cut":          {Customer{ID: 2, Name: "Ada Lovelace", Email: " ADA@example.com"}, true},
+		"another email":      {Customer{ID: 2, Name: "Ada Lovelace", Email: "ada@other.example"}, false},
+		"a distant name":     {Customer{ID: 2, Name: "A. Lovelace", Email: "ada@example.com"}, false},
+		"another address":    {Customer{ID: 2, Name: "Ada Lovelace", Email: "ada@example.com", Address: "9 Elm St"}, false},
+		"the same address":   {Customer{ID: 2, Name: "Ada Lovelace", Email: "ada@example.com", Address: "1 main st"}, true},
+		"a child of the one": {Customer{ID: 2, Name: "Ada Lovelace", Email: "ada@example.com", ParentID: &ada.ID}, false},
+	} {
+		if got := safeToMerge(&ada, &c.other, defaultMergeThreshold); got != c.want {
+			t.Errorf("%s: safe to merge %v, want %v", name, got, c.want)
+		}
+	}
+}
+
+func TestDedupMergesClearCutGroupsAndFlagsAmbiguousOnes(t *testing.T) {
+	pg := postgresDB(t)
+	a := GetApp(pg)
+	var ada, adaDup, bob, bobDup int
+	pg.DB.QueryRow(`INSERT INTO customers (name, email) VALUES ('Ada Lovelace', 'ada@example.com') RETURNING id`).Scan(&ada)
+	pg.DB.QueryRow(`INSERT INTO customers (name, email, address) VALUES ('Ada Lovelace', 'ADA@example.com', '1 Main St') RETURNING id`).Scan(&adaDup)
+	pg.DB.QueryRow(`INSERT INTO customers (name, email, address) VALUES ('Bob Stone', 'bob@example.com', '1 Main St') RETURNING id`).Scan(&bob)
+	pg.DB.QueryRow(`INSERT INTO customers (name, email, address) VALUES ('Bob Stone', 'BOB@example.com', '9 Elm St') RETURNING id`).Scan(&bobDup)
+
+	w := request(dedupRouter(a), http.MethodPost, "/admin/customers/dedup?merge=true", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var report dedupReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{{ada, adaDup}, {bob, bobDup}}; !reflect.DeepEqual(groupIDs(&report), want) {
+		t.Fatalf("groups %v, want %v", groupIDs(&report), want)
+	}
+	if group := report.Groups[0]; group.Status != groupMerged || group.Survivor != ada {
+		t.Errorf("clear-cut group %s into %d, want merged into %d", group.Status, group.Survivor, ada)
+	}
+	if group := report.Groups[1]; group.Status != groupReview || group.Survivor != 0 {
+		t.Errorf("ambiguous group %s into %d, want flagged for review", group.Status, group.Survivor)
+	}
+	if len(report.TransactionID) == 0 {
+		t.Errorf("the merge has no transaction to undo it with")
+	}
+
+	got := owners(t, a)
+	if _, ok := got[adaDup]; ok || len(got) != 3 {
+		t.Errorf("customers left %v, want the duplicate of ada gone and both bobs kept", got)
+	}
+	var address string
+	pg.DB.Get(&address, `SELECT address FROM customers WHERE id = $1`, ada)
+	var audited int
+	pg.DB.Get(&audited, `SELECT count(*) FROM customer_audit WHERE action = 'merge'`)
+	if address != "1 Main St" || audited == 0 {
+		t.Errorf("survivor address %q and %d merge audit entries, want the duplicate's address and an entry", address, audited)
+	}
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"customer-service/db"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	ensureCreated   = "created"
+	ensureUpdated   = "updated"
+	ensureUnchanged = "unchanged"
+)
+
+// ensureCustomer converges one customer to the posted state. The customer is
+// found by partner and client_reference_id when a reference is given, by
+// email otherwise, then created, updated to match, or left alone. Every
+// field is replaced, so an omitted one is cleared. The branch taken is
+// returned.
+func ensureCustomer(db *db.PostgresDB, c *gin.Context) (int, string, *Customer, error) {
+	var customer Customer
+	if err := bindJSON(c, &customer); err != nil {
+		return http.StatusBadRequest, "", nil, err
+	}
+	if err := validateCustomer(&customer); err != nil {
+		return http.StatusBadRequest, "", nil, err
+	}
+	if err := validateFields(&customer); err != nil {
+		return http.StatusUnprocessableEntity, "", nil, err
+	}
+	warnings, err := checkWarnings(&customer)
+	if err != nil {
+		return http.StatusUnprocessableEntity, "", nil, err
+	}
+
+	tx, err := beginRequest(db, c)
+	if err != nil {
+		return http.StatusInternalServerError, "", nil, err
+	}
+	defer tx.Rollback()
+
+	status, outcome, err := ensureInTx(tx, &customer)
+	if err != nil {
+		return status, "", nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return http.StatusInternalServerError, "", nil, err
+	}
+	customer.Warnings = warnings
+	return status, outcome, &customer, nil
+}
+
+func ensureInTx(tx *sqlx.Tx, customer *Customer) (int, string, error) {
+	find := `SELECT id FROM customers WHERE email = $1 AND ` + notDeleted + ` FOR UPDATE`
+	args := []interface{}{customer.Email}
+	if len(customer.Reference) != 0 {
+		find = `SELECT id FROM customers WHERE partner = $1 AND client_reference_id = $2 AND ` + notDeleted + ` FOR UPDATE`
+		args = []interface{}{customer.Partner, customer.Reference}
+	}
+
+	var id int
+	err := tx.Get(&id, find, args...)
+	if err == sql.ErrNoRows {
+		stmt := `INSERT INTO customers (name, email, address, owner, partner, client_reference_id)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')) RETURNING ` + customerColumns
+		err := tx.QueryRowx(stmt, customer.Name, customer.Email, customer.Address, customer.Owner,
+			customer.Partner, customer.Reference).StructScan(customer)
+		if db.IsUniqueViolation(err) {
+			return http.StatusConflict, "", fmt.Errorf("customer conflicts with an existing one: %w", err)
+		}
+		if err != nil {
+			return http.StatusInternalServerError, "", err
+		}
+		return http.StatusCreated, ensureCreated, nil
+	}
+	if err != nil {
+		return http.StatusInternalServerError, "", err
+	}
+
+	stmt := `UPDATE customers SET name = $1, email = $2, address = $3, owner = $4, updated_at = now()
+	WHERE id = $5 AND (COALESCE(name, ''), email, COALESCE(address, ''), owner) IS DISTINCT FROM ($1, $2, $3, $4)
+	RETURNING ` + customerColumns
+	err = tx.QueryRowx(stmt, customer.Name, customer.Email, customer.Address, customer.Owner, id).StructScan(customer)
+	if err == sql.ErrNoRows {
+		customer.ID = id
+		return http.StatusNotModified, ensureUnchanged, nil
+	}
+	if db.IsUniqueViolation(err) {
+		return http.StatusConflict, "", fmt.Errorf("email %q belongs to another customer", customer.Email)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, "", err
+	}
+	return http.StatusOK, ensureUpdated, nil
+}
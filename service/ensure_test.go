@@ -0,0 +1,45 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEnsureCreatesUpdatesThenLeavesAlone(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.PUT("/customers/ensure", a.EnsureHandler)
+
+	for _, step := range []struct {
+		name, body string
+		status     int
+		outcome    string
+	}{
+		{"create", `{"name": "Ada", "email": "ada@example.com"}`, http.StatusCreated, ensureCreated},
+		{"update", `{"name": "Ada King", "email": "ada@example.com"}`, http.StatusOK, ensureUpdated},
+		{"repeat", `{"name": "Ada King", "email": "ada@example.com"}`, http.StatusNotModified, ensureUnchanged},
+	} {
+		w := request(r, http.MethodPut, "/customers/ensure", step.body)
+		if w.Code != step.status || w.Header().Get("Ensure-Result") != step.outcome {
+			t.Errorf("%s: got %d %q, want %d %q: %s", step.name, w.Code, w.Header().Get("Ensure-Result"), step.status, step.outcome, w.Body)
+		}
+	}
+
+	var name string
+	var count int
+	a.db.DB.Get(&count, `SELECT count(*) FROM customers`)
+	a.db.DB.Get(&name, `SELECT name FROM customers WHERE email = 'ada@example.com'`)
+	if count != 1 || name != "Ada King" {
+		t.Errorf("%d customers, named %q, want one updated Ada", count, name)
+	}
+}
+
+func TestEnsureNeedsAnEmail(t *testing.T) {
+	r := gin.New()
+	r.PUT("/customers/ensure", GetApp(nil).EnsureHandler)
+	if w := request(r, http.MethodPut, "/customers/ensure", `{"name": "Ada"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want 400: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"mime"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wrapSingle decides whether a single customer is rendered bare or as
+// {"data": {...}} like list responses. A request can choose with an Accept
+// parameter such as "application/json; envelope=wrapped"; otherwise
+// RESPONSE_ENVELOPE applies, defaulting to bare.
+func wrapSingle(c *gin.Context) bool {
+	for _, accept := range strings.Split(c.GetHeader("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch params["envelope"] {
+		case "wrapped":
+			return true
+		case "bare":
+			return false
+		}
+	}
+
+	return os.Getenv("RESPONSE_ENVELOPE") == "wrapped"
+}
+
+func renderCustomer(c *gin.Context, status int, customer *Customer) {
+	if wrapSingle(c) {
+		render(c, status, gin.H{"data": customer})
+		return
+	}
+	render(c, status, customer)
+}
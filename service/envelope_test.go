@@ -0,0 +1,31 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSingleCustomerEnvelope(t *testing.T) {
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) { renderCustomer(c, http.StatusOK, &Customer{ID: 7}) })
+	const bare, wrapped = `{"id":7,`, `{"data":{"id":7,`
+
+	for _, tc := range []struct {
+		setting, accept, want string
+	}{
+		{"", "", bare},
+		{"wrapped", "", wrapped},
+		{"bare", "", bare},
+		{"", "application/json; envelope=wrapped", wrapped},
+		{"wrapped", "application/json; envelope=bare", bare},
+		{"", "text/html, application/json;envelope=wrapped", wrapped},
+	} {
+		t.Setenv("RESPONSE_ENVELOPE", tc.setting)
+		if got := request(r, http.MethodGet, "/", "", "Accept", tc.accept).Body.String(); !strings.HasPrefix(got, tc.want) {
+			t.Errorf("RESPONSE_ENVELOPE=%q, Accept %q: got %s, want %s", tc.setting, tc.accept, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"customer-service/db"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultEventLimit = 100
+	maxEventLimit     = 1000
+)
+
+// Event payload schema versions. Each version is a fixed struct that rows
+// and customers are mapped into, so its shape changes with neither the
+// table nor the API. Consumers pin a version and keep getting that shape
+// when a newer one is added.
+const (
+	eventSchemaV1 = 1
+	eventSchemaV2 = 2
+
+	latestEventSchema = eventSchemaV2
+)
+
+func checkEventSchema(version int) error {
+	if version < eventSchemaV1 || version > latestEventSchema {
+		return fmt.Errorf("schema version must be between %d and %d", eventSchemaV1, latestEventSchema)
+	}
+	return nil
+}
+
+// customerV1 is schema version 1, the row as the log stored it when the
+// versions were introduced: every column, with NULL kept as null.
+type customerV1 struct {
+	ID        int       `json:"id"`
+	Name      *string   `json:"name"`
+	Email     *string   `json:"email"`
+	Address   *string   `json:"address"`
+	Owner     string    `json:"owner"`
+	Partner   string    `json:"partner"`
+	Reference *string   `json:"client_reference_id"`
+	Tags      []string  `json:"tags"`
+	ParentID  *int      `json:"parent_id"`
+	Lat       *float64  `json:"lat"`
+	Lng       *float64  `json:"lng"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// customerV2 is schema version 2, the customer as the API rendered it then.
+type customerV2 struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Email     string    `json:"email"`
+	Address   string    `json:"address,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	Partner   string    `json:"partner,omitempty"`
+	Reference string    `json:"client_reference_id,omitempty"`
+	Tags      []string  `json:"tags"`
+	ParentID  *int      `json:"parent_id,omitempty"`
+	Lat       *float64  `json:"lat,omitempty"`
+	Lng       *float64  `json:"lng,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func nullString(s string) *string {
+	if len(s) == 0 {
+		return nil
+	}
+	return &s
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// customerPayload maps a customer into version 1, from which every other
+// version is derived.
+func customerPayload(c *Customer) customerV1 {
+	tags := []string(c.Tags)
+	if tags == nil {
+		tags = []string{}
+	}
+	return customerV1{
+		ID: c.ID, Name: nullString(c.Name), Email: nullString(c.Email), Address: nullString(c.Address),
+		Owner: c.Owner, Partner: c.Partner, Reference: nullString(c.Reference), Tags: tags,
+		ParentID: c.ParentID, Lat: c.Lat, Lng: c.Lng, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt,
+	}
+}
+
+// versioned renders p in the given schema version.
+func (p customerV1) versioned(version int) interface{} {
+	if version == eventSchemaV1 {
+		return p
+	}
+	if p.Tags == nil {
+		p.Tags = []string{}
+	}
+	return customerV2{
+		ID: p.ID, Name: derefString(p.Name), Email: derefString(p.Email), Address: derefString(p.Address),
+		Owner: p.Owner, Partner: p.Partner, Reference: derefString(p.Reference), Tags: p.Tags,
+		ParentID: p.ParentID, Lat: p.Lat, Lng: p.Lng, CreatedAt: p.CreatedAt, UpdatedAt: p.UpdatedAt,
+	}
+}
+
+// eventPayload renders a logged customer row in the given schema version.
+// Columns the version does not know are dropped.
+func eventPayload(row json.RawMessage, version int) (json.RawMessage, error) {
+	var p customerV1
+	if err := json.Unmarshal(row, &p); err != nil {
+		return nil, err
+	}
+	return json.Marshal(p.versioned(version))
+}
+
+type customerEvent struct {
+	Seq           int64           `json:"seq"`
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schema_version" db:"-"`
+	CustomerID    int             `json:"customer_id" db:"customer_id"`
+	Payload       json.RawMessage `json:"payload"`
+	TxID          string          `json:"transaction_id,omitempty" db:"tx_id"`
+	CorrelationID string          `json:"correlation_id,omitempty" db:"correlation_id"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+}
+
+type eventPage struct {
+	Data    []customerEvent `json:"data"`
+	LastSeq int64           `json:"last_seq"`
+}
+
+// eventsAfter selects the settled part of the log, events of transactions
+// older than any still running, after the event with seq $1 (or from the
+// start for 0). Seqs are handed out before commit, so a running
+// transaction can still add events below the highest visible seq; ordering
+// by transaction first means it can only add them after everything
+// settled so far, which never changes.
+const eventsAfter = `SELECT seq, type, customer_id, payload, COALESCE(tx_id, '') AS tx_id,
+	COALESCE(correlation_id, '') AS correlation_id, created_at FROM customer_events
+	WHERE xid < pg_snapshot_xmin(pg_current_snapshot())
+	AND ($1 = 0 OR (xid, seq) > (SELECT xid, seq FROM customer_events WHERE seq = $1))
+	ORDER BY xid, seq LIMIT $2`
+
+// listEvents pages through the change log. Following last_seq with
+// afterSeq visits every mutation exactly once, however many share a
+// timestamp. A long-running write delays the events after it, but never
+// reorders them.
+func listEvents(db *db.PostgresDB, c *gin.Context) (int, *eventPage, error) {
+	p := struct {
+		AfterSeq      int `form:"afterSeq"`
+		Limit         int `form:"limit"`
+		SchemaVersion int `form:"schemaVersion"`
+	}{Limit: defaultEventLimit, SchemaVersion: eventSchemaV1}
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	afterSeq, limit, version := p.AfterSeq, p.Limit, p.SchemaVersion
+	if afterSeq < 0 {
+		return http.StatusBadRequest, nil, fmt.Errorf("afterSeq cannot be negative")
+	}
+	if limit < 1 || limit > maxEventLimit {
+		return http.StatusBadRequest, nil, fmt.Errorf("limit must be between 1 and %d", maxEventLimit)
+	}
+	if err := checkEventSchema(version); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	if afterSeq > 0 {
+		var known bool
+		if err := db.DB.Get(&known, `SELECT EXISTS (SELECT 1 FROM customer_events WHERE seq = $1)`, afterSeq); err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+		if !known {
+			return http.StatusBadRequest, nil, fmt.Errorf("afterSeq %d is not the seq of a logged event", afterSeq)
+		}
+	}
+
+	page := &eventPage{Data: make([]customerEvent, 0), LastSeq: int64(afterSeq)}
+	if err := db.DB.Select(&page.Data, eventsAfter, afterSeq, limit); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	for i := range page.Data {
+		event := &page.Data[i]
+		var err error
+		if event.Payload, err = eventPayload(event.Payload, version); err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+		event.SchemaVersion = version
+	}
+	if n := len(page.Data); n > 0 {
+		page.LastSeq = page.Data[n-1].Seq
+	}
+
+	return http.StatusOK, page, nil
+}
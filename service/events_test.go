@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readFeed follows last_seq from afterSeq in pages of two until a page
+// comes back empty.
+func readFeed(t *testing.T, r http.Handler, afterSeq int64) ([]customerEvent, int64) {
+	t.Helper()
+	var events []customerEvent
+	for {
+		w := request(r, http.MethodGet, fmt.Sprintf("/customers/events/log?afterSeq=%d&limit=2", afterSeq), "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("feed returned %d: %s", w.Code, w.Body)
+		}
+		var page eventPage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Data) == 0 {
+			return events, afterSeq
+		}
+		events = append(events, page.Data...)
+		afterSeq = page.LastSeq
+	}
+}
+
+func TestEventFeedMissesNothingAcrossOverlappingWrites(t *testing.T) {
+	pg := postgresDB(t)
+	a := GetApp(pg)
+	r := gin.New()
+	r.GET("/customers/events/log", a.EventsHandler)
+
+	// first writes on both sides of second, so their seqs interleave and
+	// first commits a higher seq while second is still running.
+	first := pg.DB.MustBegin()
+	defer first.Rollback()
+	first.MustExec(`INSERT INTO customers (name, email) VALUES ('a', 'a@example.com')`)
+	second := pg.DB.MustBegin()
+	defer second.Rollback()
+	second.MustExec(`INSERT INTO customers (name, email) VALUES ('b', 'b@example.com')`)
+	first.MustExec(`INSERT INTO customers (name, email) VALUES ('c', 'c@example.com')`)
+	if err := first.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	seen, last := readFeed(t, r, 0)
+	if len(seen) != 2 {
+		t.Fatalf("got %d events while second is running, want first's 2", len(seen))
+	}
+
+	// Three updates in one statement share a timestamp.
+	second.MustExec(`UPDATE customers SET owner = 'same'`)
+	if err := second.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	more, _ := readFeed(t, r, last)
+	seen = append(seen, more...)
+
+	var logged []int64
+	if err := pg.DB.Select(&logged, `SELECT seq FROM customer_events ORDER BY seq`); err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 6 {
+		t.Fatalf("logged %d events, want 6", len(logged))
+	}
+	counts := make(map[int64]int)
+	for _, e := range seen {
+		counts[e.Seq]++
+	}
+	for _, seq := range logged {
+		if counts[seq] != 1 {
+			t.Errorf("event %d was read %d times, want once", seq, counts[seq])
+		}
+	}
+	if len(seen) != len(logged) {
+		t.Errorf("read %d events, want %d", len(seen), len(logged))
+	}
+
+	updated := seen[len(seen)-3:]
+	for _, e := range updated {
+		if e.Type != "customer.updated" || !e.CreatedAt.Equal(updated[0].CreatedAt) {
+			t.Errorf("want three customer.updated events sharing a timestamp, got %s at %s", e.Type, e.CreatedAt)
+		}
+	}
+}
+
+func TestEventSeqsFollowTheMutationOrder(t *testing.T) {
+	pg := postgresDB(t)
+	r := gin.New()
+	r.GET("/customers/events/log", GetApp(pg).EventsHandler)
+
+	var id int
+	if err := pg.DB.Get(&id, `INSERT INTO customers (name, email) VALUES ('Ada', 'ada@example.com') RETURNING id`); err != nil {
+		t.Fatal(err)
+	}
+	pg.DB.MustExec(`UPDATE customers SET owner = 'alice' WHERE id = $1`, id)
+	pg.DB.MustExec(`UPDATE customers SET owner = 'bob' WHERE id = $1`, id)
+	pg.DB.MustExec(`DELETE FROM customers WHERE id = $1`, id)
+
+	events, _ := readFeed(t, r, 0)
+	want := []string{"customer.created", "customer.updated", "customer.updated", "customer.deleted"}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, e := range events {
+		if e.Type != want[i] || e.CustomerID != id {
+			t.Errorf("event %d is %s of %d, want %s of %d", i, e.Type, e.CustomerID, want[i], id)
+		}
+		if i > 0 && e.Seq != events[i-1].Seq+1 {
+			t.Errorf("event %d has seq %d after %d, want consecutive seqs", i, e.Seq, events[i-1].Seq)
+		}
+	}
+}
+
+func TestEventFeedRejectsUnknownCursor(t *testing.T) {
+	pg := postgresDB(t)
+	r := gin.New()
+	r.GET("/customers/events/log", GetApp(pg).EventsHandler)
+
+	if w := request(r, http.MethodGet, "/customers/events/log?afterSeq=42", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d for an unknown afterSeq, want 400", w.Code)
+	}
+}
+
+// keys returns the sorted top-level keys of a JSON object.
+func keys(t *testing.T, body []byte) []string {
+	t.Helper()
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestEventPayloadVersionsIgnoreNewColumns(t *testing.T) {
+	// A row from after the schema advanced, with columns neither version has.
+	row := json.RawMessage(`{"id": 7, "name": null, "email": "ada@example.com", "address": null, "owner": "",
+	    "partner": "acme", "client_reference_id": "a-7", "tags": [], "parent_id": null, "lat": null, "lng": null,
+	    "created_at": "2026-01-02T03:04:05.123456+00:00", "updated_at": "2026-01-02T03:04:05.123456+00:00",
+	    "deleted_at": null, "loyalty_tier": "gold"}`)
+
+	v1, err := eventPayload(row, eventSchemaV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"address", "client_reference_id", "created_at", "email", "id", "lat", "lng", "name", "owner", "parent_id", "partner", "tags", "updated_at"}
+	if got := keys(t, v1); !reflect.DeepEqual(got, want) {
+		t.Errorf("v1 keys %v, want %v", got, want)
+	}
+
+	v2, err := eventPayload(row, eventSchemaV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"client_reference_id", "created_at", "email", "id", "partner", "tags", "updated_at"}
+	if got := keys(t, v2); !reflect.DeepEqual(got, want) {
+		t.Errorf("v2 keys %v, want %v", got, want)
+	}
+}
+
+// createHookV1Fixtures are create hook bodies captured from the hook before
+// its payload was versioned. Version 1 must keep sending them unchanged.
+var createHookV1Fixtures = []string{
+	`{"id":7,"email":"ada@example.com","partner":"acme","tags":["vip"],"created_at":"2026-01-02T03:04:05.123456Z","updated_at":"2026-01-02T03:04:05.123456Z","warnings":[{"field":"email","code":"free_email","message":"free"}]}`,
+	`{"id":7,"name":"Ada","email":"ada@example.com","address":"1 Main St","owner":"alice","partner":"acme","client_reference_id":"a-7","tags":["vip"],"parent_id":3,"lat":51.5,"lng":-0.12,"created_at":"2026-01-02T03:04:05.123456Z","updated_at":"2026-01-02T03:04:05.123456Z","warnings":[{"field":"email","code":"free_email","message":"free"}]}`,
+}
+
+func TestCreateHookV1SendsThePreVersioningBody(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	created := time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	warnings := []fieldWarning{{Field: "email", Code: codeFreeEmail, Message: "free"}}
+	parent, lat, lng := 3, 51.5, -0.12
+	customers := []Customer{
+		{ID: 7, Email: "ada@example.com", Partner: "acme", Tags: []string{"vip"}, CreatedAt: created, UpdatedAt: created, Warnings: warnings},
+		{ID: 7, Name: "Ada", Email: "ada@example.com", Address: "1 Main St", Owner: "alice", Partner: "acme", Reference: "a-7",
+			Tags: []string{"vip"}, ParentID: &parent, Lat: &lat, Lng: &lng, CreatedAt: created, UpdatedAt: created, Warnings: warnings},
+	}
+	hook := &httpCreateHook{url: server.URL, client: server.Client(), version: eventSchemaV1}
+	for i, customer := range customers {
+		if err := hook.CustomerCreated(context.Background(), customer); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(<-bodies); got != createHookV1Fixtures[i] {
+			t.Errorf("customer %d: hook sent\n%s\nwant\n%s", i, got, createHookV1Fixtures[i])
+		}
+	}
+}
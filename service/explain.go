@@ -0,0 +1,54 @@
+package service
+
+import (
+	"customer-service/db"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type explainResult struct {
+	Endpoint string `json:"endpoint"`
+	Query    string `json:"query"`
+	Plan     string `json:"plan"`
+}
+
+// explainQuery runs EXPLAIN (ANALYZE, BUFFERS) on the query the endpoint
+// named by ?endpoint= would execute for the same parameters. ANALYZE runs
+// the query, so it does so in a read-only transaction that is rolled back.
+func explainQuery(db *db.PostgresDB, c *gin.Context) (int, *explainResult, error) {
+	p := struct {
+		pageParams
+		Endpoint string `form:"endpoint"`
+	}{Endpoint: "list"}
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if p.Endpoint != "list" {
+		return http.StatusBadRequest, nil, fmt.Errorf("cannot explain endpoint %q: only list is supported", p.Endpoint)
+	}
+
+	status, q, err := parseListQuery(db, c, &p.pageParams)
+	if err != nil {
+		return status, nil, err
+	}
+	stmt, args := q.selectStmt()
+
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SET TRANSACTION READ ONLY`); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	lines := make([]string, 0)
+	if err := tx.Select(&lines, `EXPLAIN (ANALYZE, BUFFERS) `+stmt, args...); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, &explainResult{Endpoint: p.Endpoint, Query: stmt, Plan: strings.Join(lines, "\n")}, nil
+}
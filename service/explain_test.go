@@ -0,0 +1,42 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func explainRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.GET("/admin/explain", a.ExplainHandler)
+	return r
+}
+
+func TestExplainReturnsThePlanOfTheListQuery(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	seedCustomers(t, a, 3, "alice")
+
+	w := request(explainRouter(a), http.MethodGet, "/admin/explain?owner=alice&sort=-created_at", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var result explainResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Endpoint != "list" || !strings.Contains(result.Query, "FROM customers") {
+		t.Errorf("explained %s: %q, want the list query", result.Endpoint, result.Query)
+	}
+	if !strings.Contains(result.Plan, "actual time=") {
+		t.Errorf("plan %q has no ANALYZE timings", result.Plan)
+	}
+}
+
+func TestExplainOnlySupportsTheList(t *testing.T) {
+	if w := request(explainRouter(GetApp(nil)), http.MethodGet, "/admin/explain?endpoint=export", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want 400: %s", w.Code, w.Body)
+	}
+}
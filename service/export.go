@@ -0,0 +1,354 @@
+package service
+
+import (
+	"crypto/rand"
+	"customer-service/db"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultExportTTL = time.Hour
+	exportQueueSize  = 100
+)
+
+const (
+	exportQueued  = "queued"
+	exportRunning = "running"
+	exportDone    = "done"
+	exportFailed  = "failed"
+)
+
+var exportFormats = map[string]string{
+	"csv":    "text/csv",
+	"json":   "application/json",
+	"ndjson": "application/x-ndjson",
+}
+
+type exportRequest struct {
+	Format  string          `json:"format"`
+	Filters customerFilters `json:"filters"`
+
+	// withDeleted also exports soft-deleted customers, for snapshots.
+	withDeleted bool
+}
+
+type exportJob struct {
+	ID          string          `json:"id"`
+	Status      string          `json:"status"`
+	Format      string          `json:"format"`
+	Filters     customerFilters `json:"filters"`
+	Rows        int             `json:"rows"`
+	Error       string          `json:"error,omitempty"`
+	DownloadURL string          `json:"download_url,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+
+	path        string
+	withDeleted bool
+}
+
+// exportStore keeps export jobs in memory and feeds them to a single
+// background worker. Jobs and their files are dropped once they expire.
+type exportStore struct {
+	mu    sync.Mutex
+	jobs  map[string]*exportJob
+	queue chan *exportJob
+	ttl   time.Duration
+}
+
+func exportTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("EXPORT_TTL"))
+	if err != nil || ttl <= 0 {
+		return defaultExportTTL
+	}
+	return ttl
+}
+
+func newExportStore() *exportStore {
+	return &exportStore{
+		jobs:  make(map[string]*exportJob),
+		queue: make(chan *exportJob, exportQueueSize),
+		ttl:   exportTTL(),
+	}
+}
+
+// snapshot returns a copy of the job safe to serialize outside the lock.
+func (s *exportStore) snapshot(id string) (exportJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok || time.Now().After(job.ExpiresAt) {
+		return exportJob{}, false
+	}
+	return *job, true
+}
+
+func (s *exportStore) update(job *exportJob, fn func(*exportJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(job)
+}
+
+func (s *exportStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, job := range s.jobs {
+		if now.After(job.ExpiresAt) {
+			if len(job.path) != 0 {
+				os.Remove(job.path)
+			}
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func newRandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// enqueue queues the posted export. ?queryId= applies a saved query's
+// filters in place of any in the body.
+func (s *exportStore) enqueue(db *db.PostgresDB, c *gin.Context) (int, *exportJob, error) {
+	var p savedQueryParams
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	var req exportRequest
+	if err := bindJSON(c, &req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if status, filters, err := savedFilters(db, c, p); err != nil {
+		return status, nil, err
+	} else if filters != nil {
+		req.Filters = *filters
+	}
+
+	if len(req.Format) == 0 {
+		req.Format = "csv"
+	}
+	if _, ok := exportFormats[req.Format]; !ok {
+		return http.StatusBadRequest, nil, fmt.Errorf("unsupported export format %q", req.Format)
+	}
+
+	return s.add(req)
+}
+
+func (s *exportStore) add(req exportRequest) (int, *exportJob, error) {
+	id, err := newRandomID()
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	now := time.Now().UTC()
+	job := &exportJob{
+		ID:        id,
+		Status:    exportQueued,
+		Format:    req.Format,
+		Filters:   req.Filters,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+
+		withDeleted: req.withDeleted,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.queue <- job:
+	default:
+		return http.StatusServiceUnavailable, nil, retryLater(fmt.Errorf("export queue is full"), exportQueueRetryAfter)
+	}
+	s.jobs[id] = job
+
+	snapshot := *job
+	return http.StatusAccepted, &snapshot, nil
+}
+
+// runExports is the background worker. It also sweeps expired jobs.
+func (a *App) runExports() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case job := <-a.exports.queue:
+			a.runExport(job)
+		case <-ticker.C:
+			a.exports.sweep()
+		}
+	}
+}
+
+func (a *App) runExport(job *exportJob) {
+	a.exports.update(job, func(j *exportJob) { j.Status = exportRunning })
+
+	path, rows, err := writeExport(a.db, job.Format, job.Filters, job.withDeleted)
+	if err != nil {
+		log.Printf("export %s failed: %v", job.ID, err)
+	}
+
+	a.exports.update(job, func(j *exportJob) {
+		if err != nil {
+			j.Status = exportFailed
+			j.Error = err.Error()
+			return
+		}
+		j.Status = exportDone
+		j.Rows = rows
+		j.path = path
+		j.DownloadURL = fmt.Sprintf("/customers/exports/%s/download", j.ID)
+	})
+}
+
+func writeExport(db *db.PostgresDB, format string, filters customerFilters, withDeleted bool) (string, int, error) {
+	f, err := os.CreateTemp("", "customers-export-*."+format)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	rows, err := exportCustomers(db, filters, withDeleted, func(customers <-chan Customer) (int, error) {
+		switch format {
+		case "csv":
+			return writeCSV(f, customers)
+		case "ndjson":
+			return writeNDJSON(f, customers)
+		}
+		return writeJSON(f, customers)
+	})
+	if err != nil {
+		os.Remove(f.Name())
+		return "", 0, err
+	}
+
+	return f.Name(), rows, nil
+}
+
+// exportCustomers streams the customers matching filters to write, so an
+// export never holds the whole result set in memory. Soft-deleted customers
+// are left out unless withDeleted is set.
+func exportCustomers(db *db.PostgresDB, filters customerFilters, withDeleted bool, write func(<-chan Customer) (int, error)) (int, error) {
+	where, args := filters.where(make([]interface{}, 0))
+	base := ` WHERE ` + notDeleted
+	if withDeleted {
+		base = ` WHERE true`
+	}
+	stmt := `SELECT ` + customerColumns + ` FROM customers` + base + where + ` ORDER BY id`
+
+	rows, err := db.DB.Queryx(stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	customers := make(chan Customer)
+	written := make(chan struct{})
+	var n int
+	var writeErr error
+	go func() {
+		defer close(written)
+		n, writeErr = write(customers)
+		// Drain so the scanner below never blocks on a failed writer.
+		for range customers {
+		}
+	}()
+
+	var scanErr error
+	for rows.Next() {
+		var customer Customer
+		if scanErr = rows.StructScan(&customer); scanErr != nil {
+			break
+		}
+		customers <- customer
+	}
+	close(customers)
+	<-written
+
+	if scanErr != nil {
+		return 0, scanErr
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return n, writeErr
+}
+
+func writeCSV(w io.Writer, customers <-chan Customer) (int, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"id", "name", "email", "address", "owner", "created_at", "updated_at"}); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for customer := range customers {
+		record := []string{
+			strconv.Itoa(customer.ID), customer.Name, customer.Email, customer.Address, customer.Owner,
+			customer.CreatedAt.UTC().Format(time.RFC3339), customer.UpdatedAt.UTC().Format(time.RFC3339),
+		}
+		if err := cw.Write(record); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	cw.Flush()
+	return n, cw.Error()
+}
+
+func writeJSON(w io.Writer, customers <-chan Customer) (int, error) {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for customer := range customers {
+		if n > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return n, err
+			}
+		}
+		b, err := json.Marshal(customer)
+		if err != nil {
+			return n, err
+		}
+		if _, err := w.Write(b); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	_, err := io.WriteString(w, "]")
+	return n, err
+}
+
+func writeNDJSON(w io.Writer, customers <-chan Customer) (int, error) {
+	enc := json.NewEncoder(w)
+
+	n := 0
+	for customer := range customers {
+		if err := enc.Encode(customer); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
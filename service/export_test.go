@@ -0,0 +1,79 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func exportRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.POST("/customers/exports", a.ExportPostHandler)
+	r.GET("/customers/exports/:jobId", a.ExportGetHandler)
+	r.GET("/customers/exports/:jobId/download", a.ExportDownloadHandler)
+	return r
+}
+
+// awaitExport enqueues an export and polls it until it finishes.
+func awaitExport(t *testing.T, r *gin.Engine, target, body string, headers ...string) exportJob {
+	t.Helper()
+	w := request(r, http.MethodPost, target, body, headers...)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("enqueue: %d %s", w.Code, w.Body)
+	}
+	var job exportJob
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != exportQueued || w.Header().Get("Location") != "/customers/exports/"+job.ID {
+		t.Fatalf("enqueued %+v at %q, want a queued job at its status URL", job, w.Header().Get("Location"))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == exportQueued || job.Status == exportRunning {
+		if time.Now().After(deadline) {
+			t.Fatalf("export %s is still %s", job.ID, job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+		w := request(r, http.MethodGet, "/customers/exports/"+job.ID, "")
+		if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("poll: %d %s", w.Code, w.Body)
+		}
+	}
+	return job
+}
+
+func TestExportRejectsUnknownFormatsAndJobs(t *testing.T) {
+	r := exportRouter(GetApp(nil))
+	if w := request(r, http.MethodPost, "/customers/exports", `{"format": "xml"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("xml export: got %d, want 400", w.Code)
+	}
+	for _, target := range []string{"/customers/exports/nope", "/customers/exports/nope/download"} {
+		if w := request(r, http.MethodGet, target, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", target, w.Code)
+		}
+	}
+}
+
+func TestExportIsPolledToCompletionAndDownloaded(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := exportRouter(a)
+	seedCustomers(t, a, 3, "alice")
+
+	job := awaitExport(t, r, "/customers/exports", `{"format": "csv"}`)
+	if job.Status != exportDone || job.Rows != 3 {
+		t.Fatalf("export finished %s with %d rows (%s), want done with 3", job.Status, job.Rows, job.Error)
+	}
+
+	w := request(r, http.MethodGet, job.DownloadURL, "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("download: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n"); len(lines) != 4 || !strings.HasPrefix(lines[0], "id,name,email") {
+		t.Errorf("downloaded %q, want a header and 3 rows", w.Body)
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"customer-service/db"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type geoPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoFeature struct {
+	Type       string    `json:"type"`
+	ID         int       `json:"id"`
+	Geometry   *geoPoint `json:"geometry"`
+	Properties *Customer `json:"properties"`
+}
+
+// geoCollection is a GeoJSON FeatureCollection. total, limit and offset are
+// foreign members carrying the paging, which GeoJSON readers ignore.
+type geoCollection struct {
+	Type     string       `json:"type"`
+	Features []geoFeature `json:"features"`
+	Total    int          `json:"total"`
+	Limit    int          `json:"limit"`
+	Offset   int          `json:"offset"`
+}
+
+// listGeoJSON pages through customers like the list endpoint, as point
+// features. Customers without coordinates are left out unless
+// ?missing=null asks for them with a null geometry.
+func listGeoJSON(db *db.PostgresDB, c *gin.Context) (int, *geoCollection, error) {
+	p := struct {
+		pageParams
+		Missing string `form:"missing"`
+	}{Missing: "omit"}
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if p.Missing != "omit" && p.Missing != "null" {
+		return http.StatusBadRequest, nil, fmt.Errorf("missing must be omit or null")
+	}
+
+	status, q, err := parseListQuery(db, c, &p.pageParams)
+	if err != nil {
+		return status, nil, err
+	}
+	if p.Missing == "omit" {
+		q.where += " AND lat IS NOT NULL"
+	}
+
+	list := &customerList{Data: make([]Customer, 0)}
+	if err := db.DB.Get(&list.Total, `SELECT COUNT(*) FROM customers`+q.where, q.args...); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	stmt, args := q.selectStmt()
+	if err := db.DB.Select(&list.Data, stmt, args...); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	collection := &geoCollection{Type: "FeatureCollection", Features: make([]geoFeature, 0, len(list.Data)), Total: list.Total, Limit: q.limit, Offset: q.offset}
+	for i := range list.Data {
+		customer := &list.Data[i]
+		feature := geoFeature{Type: "Feature", ID: customer.ID, Properties: customer}
+		if customer.Lat != nil && customer.Lng != nil {
+			feature.Geometry = &geoPoint{Type: "Point", Coordinates: [2]float64{*customer.Lng, *customer.Lat}}
+		}
+		collection.Features = append(collection.Features, feature)
+	}
+	return http.StatusOK, collection, nil
+}
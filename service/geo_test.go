@@ -0,0 +1,57 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func geoRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.GET("/customers/geo.json", a.GeoJSONHandler)
+	return r
+}
+
+func TestGeoJSONIsAFeatureCollectionOfPoints(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := geoRouter(a)
+	a.db.DB.MustExec(`INSERT INTO customers (name, email, lat, lng) VALUES
+	    ('Ada', 'ada@example.com', 51.5, -0.12), ('Bob', 'bob@example.com', 40.7, -74.0), ('Cy', 'cy@example.com', NULL, NULL)`)
+	get := func(target string) geoCollection {
+		t.Helper()
+		w := request(r, http.MethodGet, target, "")
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/geo+json; charset=utf-8" {
+			t.Fatalf("%s: got %d %s", target, w.Code, w.Header().Get("Content-Type"))
+		}
+		var collection geoCollection
+		if err := json.Unmarshal(w.Body.Bytes(), &collection); err != nil {
+			t.Fatal(err)
+		}
+		return collection
+	}
+
+	collection := get("/customers/geo.json")
+	if collection.Type != "FeatureCollection" || collection.Total != 2 || len(collection.Features) != 2 {
+		t.Fatalf("got %+v, want a collection of the 2 located customers", collection)
+	}
+	ada := collection.Features[0]
+	if ada.Type != "Feature" || ada.Geometry == nil || ada.Geometry.Type != "Point" || ada.Geometry.Coordinates != [2]float64{-0.12, 51.5} {
+		t.Errorf("first feature %+v, want a point at longitude then latitude", ada)
+	}
+	if ada.Properties == nil || ada.Properties.Email != "ada@example.com" || ada.ID != ada.Properties.ID {
+		t.Errorf("first feature properties %+v, want ada", ada.Properties)
+	}
+
+	collection = get("/customers/geo.json?missing=null")
+	if collection.Total != 3 || len(collection.Features) != 3 || collection.Features[2].Geometry != nil {
+		t.Errorf("with missing=null: %+v, want 3 features, the last without geometry", collection)
+	}
+}
+
+func TestGeoJSONRejectsAnUnknownMissingMode(t *testing.T) {
+	if w := request(geoRouter(GetApp(nil)), http.MethodGet, "/customers/geo.json?missing=zero", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want 400: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const geocodeTimeout = 10 * time.Second
+
+// errNotGeocoded is returned by a Geocoder that cannot place an address.
+var errNotGeocoded = errors.New("address could not be geocoded")
+
+// Geocoder turns a postal address into coordinates, and coordinates back
+// into an address.
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (lat, lng float64, err error)
+	ReverseGeocode(ctx context.Context, lat, lng float64) (address string, err error)
+}
+
+// noopGeocoder places nothing; coordinates can still be set directly.
+type noopGeocoder struct{}
+
+func (noopGeocoder) Geocode(ctx context.Context, address string) (float64, float64, error) {
+	return 0, 0, errNotGeocoded
+}
+
+func (noopGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (string, error) {
+	return "", errNotGeocoded
+}
+
+func (a *App) SetGeocoder(g Geocoder) {
+	a.geocoder = g
+}
+
+type geocodeRequest struct {
+	Address string   `json:"address"`
+	Lat     *float64 `json:"lat"`
+	Lng     *float64 `json:"lng"`
+
+	// Reverse also replaces the customer's address with the one the
+	// geocoder finds at the posted coordinates.
+	Reverse bool `json:"reverse"`
+}
+
+// geocodeFailed maps a geocoder error to its status.
+func geocodeFailed(err error) (int, error) {
+	if errors.Is(err, errNotGeocoded) {
+		return http.StatusUnprocessableEntity, err
+	}
+	return http.StatusBadGateway, fmt.Errorf("geocoding failed: %w", err)
+}
+
+// checkCoordinates validates a directly set position.
+func checkCoordinates(lat, lng *float64) error {
+	if lat == nil || lng == nil {
+		return invalid("lat", codeRequired, "lat and lng must be set together")
+	}
+	if *lat < -90 || *lat > 90 {
+		return invalid("lat", codeRange, "lat must be between -90 and 90")
+	}
+	if *lng < -180 || *lng > 180 {
+		return invalid("lng", codeRange, "lng must be between -180 and 180")
+	}
+	return nil
+}
+
+// geocodeCustomer stores coordinates on the customer: the posted lat and
+// lng when given, else the geocoded posted address, else the geocoded
+// stored address. With reverse, posted coordinates are also reverse
+// geocoded and the address found there is stored too.
+func (a *App) geocodeCustomer(c *gin.Context) (int, *Customer, error) {
+	id, err := paramID(c)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	var req geocodeRequest
+	if err := bindJSON(c, &req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if req.Reverse && (req.Lat == nil || req.Lng == nil || len(req.Address) != 0) {
+		return http.StatusBadRequest, nil, fmt.Errorf("reverse needs lat and lng and no address")
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), geocodeTimeout)
+	defer cancel()
+	lat, lng := req.Lat, req.Lng
+	var reversed *string
+	if lat != nil || lng != nil {
+		if err := checkCoordinates(lat, lng); err != nil {
+			return http.StatusUnprocessableEntity, nil, err
+		}
+		if req.Reverse {
+			found, err := a.geocoder.ReverseGeocode(ctx, *lat, *lng)
+			if err != nil {
+				status, err := geocodeFailed(err)
+				return status, nil, err
+			}
+			found = strings.TrimSpace(found)
+			if len(found) == 0 {
+				return http.StatusBadGateway, nil, fmt.Errorf("geocoder returned an empty address")
+			}
+			if err := validateFields(&Customer{Address: found}); err != nil {
+				return http.StatusBadGateway, nil, fmt.Errorf("geocoder returned an invalid address: %w", err)
+			}
+			reversed = &found
+		}
+	} else {
+		address := strings.TrimSpace(req.Address)
+		if len(address) == 0 {
+			customer, err := fetchCustomer(a.db, id)
+			if err == sql.ErrNoRows {
+				return http.StatusNotFound, nil, err
+			}
+			if err != nil {
+				return http.StatusInternalServerError, nil, err
+			}
+			address = customer.Address
+		}
+		if len(address) == 0 {
+			return http.StatusUnprocessableEntity, nil, fmt.Errorf("customer has no address to geocode")
+		}
+
+		y, x, err := a.geocoder.Geocode(ctx, address)
+		if err != nil {
+			status, err := geocodeFailed(err)
+			return status, nil, err
+		}
+		if err := checkCoordinates(&y, &x); err != nil {
+			return http.StatusBadGateway, nil, fmt.Errorf("geocoder returned invalid coordinates: %w", err)
+		}
+		lat, lng = &y, &x
+	}
+
+	var customer Customer
+	stmt := `UPDATE customers SET lat = $1, lng = $2, address = COALESCE($4, address), updated_at = now()
+	WHERE id = $3 AND ` + notDeleted + ` AND (lat, lng, address) IS DISTINCT FROM ($1, $2, COALESCE($4, address)) RETURNING ` + customerColumns
+	err = inRequest(a.db, c, func(tx *sqlx.Tx) error {
+		return tx.QueryRowx(stmt, *lat, *lng, id, reversed).StructScan(&customer)
+	})
+	if err == sql.ErrNoRows {
+		return unchangedOrMissing(a.db, id, &customer)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, &customer, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubGeocoder places every address at one point and finds one address
+// at every point.
+type stubGeocoder struct {
+	lat, lng float64
+	address  string
+}
+
+func (g stubGeocoder) Geocode(ctx context.Context, address string) (float64, float64, error) {
+	return g.lat, g.lng, nil
+}
+
+func (g stubGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (string, error) {
+	return g.address, nil
+}
+
+func geocodeRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.POST("/customers/:customerId/geocode", a.GeocodeHandler)
+	return r
+}
+
+func TestReverseGeocodeNeedsCoordinates(t *testing.T) {
+	r := geocodeRouter(GetApp(nil))
+	for _, body := range []string{`{"reverse": true}`, `{"reverse": true, "lat": 1}`, `{"reverse": true, "lat": 1, "lng": 2, "address": "x"}`} {
+		if w := request(r, http.MethodPost, "/customers/1/geocode", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestGeocodeStoresCoordinatesAndReverseStoresTheAddress(t *testing.T) {
+	pg := postgresDB(t)
+	a := GetApp(pg)
+	a.SetGeocoder(stubGeocoder{lat: 52.52, lng: 13.405, address: "Unter den Linden 1, Berlin"})
+	r := geocodeRouter(a)
+	id := seedCustomers(t, a, 1, "alice")[0]
+	target := fmt.Sprintf("/customers/%d/geocode", id)
+
+	w := request(r, http.MethodPost, target, `{"address": "Pariser Platz, Berlin"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("geocode: %d %s", w.Code, w.Body)
+	}
+	stored, err := fetchCustomer(pg, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Lat == nil || *stored.Lat != 52.52 || stored.Lng == nil || *stored.Lng != 13.405 || len(stored.Address) != 0 {
+		t.Fatalf("stored %v, %v at %q, want 52.52, 13.405 and the address untouched", stored.Lat, stored.Lng, stored.Address)
+	}
+
+	w = request(r, http.MethodPost, target, `{"lat": 48.8584, "lng": 2.2945, "reverse": true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("reverse geocode: %d %s", w.Code, w.Body)
+	}
+	var got Customer
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Address != "Unter den Linden 1, Berlin" || *got.Lat != 48.8584 || *got.Lng != 2.2945 {
+		t.Errorf("got %v, %v at %q, want the posted coordinates and the geocoder's address", *got.Lat, *got.Lng, got.Address)
+	}
+	if w := request(r, http.MethodPost, target, `{"lat": 48.8584, "lng": 2.2945, "reverse": true}`); w.Code != http.StatusNotModified {
+		t.Errorf("repeating the reverse geocode: got %d, want 304", w.Code)
+	}
+}
+
+func TestReverseGeocodeWithoutAGeocoderIsUnprocessable(t *testing.T) {
+	pg := postgresDB(t)
+	a := GetApp(pg)
+	id := seedCustomers(t, a, 1, "alice")[0]
+
+	w := request(geocodeRouter(a), http.MethodPost, fmt.Sprintf("/customers/%d/geocode", id), `{"lat": 1, "lng": 2, "reverse": true}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got %d, want 422: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"customer-service/db"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const healthTimeout = 2 * time.Second
+
+type healthStatus struct {
+	Status     string `json:"status"`
+	WriteCheck bool   `json:"write_check"`
+	Error      string `json:"error,omitempty"`
+}
+
+// checkHealth pings the database and, when HEALTH_WRITE_CHECK is enabled,
+// also verifies the database accepts writes.
+func checkHealth(db *db.PostgresDB, c *gin.Context) (int, *healthStatus) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthTimeout)
+	defer cancel()
+
+	health := &healthStatus{Status: "ok", WriteCheck: os.Getenv("HEALTH_WRITE_CHECK") == "true"}
+	err := db.Ping(ctx)
+	if err == nil && health.WriteCheck {
+		err = db.CheckWritable(ctx)
+	}
+	if err != nil {
+		health.Status = "unavailable"
+		health.Error = err.Error()
+		return http.StatusServiceUnavailable, health
+	}
+
+	return http.StatusOK, health
+}
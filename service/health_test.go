@@ -0,0 +1,57 @@
+package service
+
+import (
+	"customer-service/db"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func healthRouter(pg *db.PostgresDB) *gin.Engine {
+	r := gin.New()
+	r.GET("/health", GetApp(pg).HealthHandler)
+	return r
+}
+
+func TestHealthIsUnavailableWithoutTheDatabase(t *testing.T) {
+	conn, err := sqlx.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w := request(healthRouter(&db.PostgresDB{DB: conn}), http.MethodGet, "/health", "")
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), `"status":"unavailable"`) {
+		t.Errorf("got %d %s, want 503 unavailable", w.Code, w.Body)
+	}
+}
+
+func TestHealthWriteCheckFailsOnAReadOnlyDatabase(t *testing.T) {
+	postgresDB(t)
+	// lib/pq passes unknown settings on as run-time parameters, so every
+	// transaction on this pool is read-only, as on a replica.
+	url := os.Getenv("TEST_DATABASE_URL")
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	conn, err := sqlx.Connect("postgres", url+sep+"default_transaction_read_only=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := healthRouter(&db.PostgresDB{DB: conn})
+
+	t.Setenv("HEALTH_WRITE_CHECK", "false")
+	if w := request(r, http.MethodGet, "/health", ""); w.Code != http.StatusOK {
+		t.Errorf("without the write check: got %d, want 200: %s", w.Code, w.Body)
+	}
+	t.Setenv("HEALTH_WRITE_CHECK", "true")
+	if w := request(r, http.MethodGet, "/health", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("with the write check: got %d, want 503: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"customer-service/db"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// postgresDB connects to the database in TEST_DATABASE_URL, applies the
+// migrations and empties the customer tables. Tests that depend on real
+// Postgres behaviour, such as locking and visibility, skip without it.
+func postgresDB(t *testing.T) *db.PostgresDB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if len(url) == 0 {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	conn, err := sqlx.Connect("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	pg := &db.PostgresDB{DB: conn}
+	if err := pg.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	conn.MustExec(`TRUNCATE customers, customer_events, customer_audit, customer_tombstones, saved_queries RESTART IDENTITY CASCADE`)
+	return pg
+}
+
+// request sends one request through h and returns the recorded response.
+// headers are name, value pairs.
+func request(h http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if len(body) != 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+// seedCustomers inserts n customers owned by owner and returns their ids.
+func seedCustomers(t *testing.T, a *App, n int, owner string) []int {
+	t.Helper()
+	ids := make([]int, n)
+	for i := range ids {
+		err := a.db.DB.Get(&ids[i], `INSERT INTO customers (name, email, owner) VALUES ($1, $2, $3) RETURNING id`,
+			fmt.Sprintf("Customer %d", i), fmt.Sprintf("c%d@example.com", i), owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ids
+}
+
+// owners maps every stored customer's id to its owner.
+func owners(t *testing.T, a *App) map[int]string {
+	t.Helper()
+	var rows []struct {
+		ID    int    `db:"id"`
+		Owner string `db:"owner"`
+	}
+	if err := a.db.DB.Select(&rows, `SELECT id, owner FROM customers`); err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[int]string, len(rows))
+	for _, row := range rows {
+		m[row.ID] = row.Owner
+	}
+	return m
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultCreateHookRetries = 3
+	createHookTimeout        = 10 * time.Second
+	createHookBackoff        = time.Second
+)
+
+// CreateHook is called after a customer has been committed, e.g. to
+// provision it in a downstream system. A failing hook is retried and logged
+// but never undoes the create.
+type CreateHook interface {
+	CustomerCreated(ctx context.Context, customer Customer) error
+}
+
+type noopCreateHook struct{}
+
+func (noopCreateHook) CustomerCreated(ctx context.Context, customer Customer) error {
+	return nil
+}
+
+// httpCreateHook posts the created customer as JSON to a provisioning URL.
+// Version 1 posts the body hooks have always received, createHookV1.
+// Version 2 and later wrap the event log's payload of that version as
+// {"type": "customer.created", "schema_version": 2, "data": {...}}.
+type httpCreateHook struct {
+	url     string
+	client  *http.Client
+	version int
+}
+
+// createHookV1 is version 1 of the create hook body: the customer as the
+// API rendered it before hook payloads were versioned. It is not the event
+// log's version 1, which is the stored row.
+type createHookV1 struct {
+	ID        int            `json:"id"`
+	Name      string         `json:"name,omitempty"`
+	Email     string         `json:"email"`
+	Address   string         `json:"address,omitempty"`
+	Owner     string         `json:"owner,omitempty"`
+	Partner   string         `json:"partner,omitempty"`
+	Reference string         `json:"client_reference_id,omitempty"`
+	Tags      []string       `json:"tags"`
+	ParentID  *int           `json:"parent_id,omitempty"`
+	Lat       *float64       `json:"lat,omitempty"`
+	Lng       *float64       `json:"lng,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Warnings  []fieldWarning `json:"warnings,omitempty"`
+	AgeDays   *int           `json:"age_days,omitempty"`
+}
+
+func createHookPayload(c *Customer, version int) interface{} {
+	if version >= eventSchemaV2 {
+		return gin.H{"type": "customer.created", "schema_version": version, "data": customerPayload(c).versioned(version)}
+	}
+	return createHookV1{
+		ID: c.ID, Name: c.Name, Email: c.Email, Address: c.Address, Owner: c.Owner, Partner: c.Partner,
+		Reference: c.Reference, Tags: c.Tags, ParentID: c.ParentID, Lat: c.Lat, Lng: c.Lng,
+		CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt, Warnings: c.Warnings, AgeDays: c.AgeDays,
+	}
+}
+
+func (h *httpCreateHook) CustomerCreated(ctx context.Context, customer Customer) error {
+	body, err := json.Marshal(createHookPayload(&customer, h.version))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Event-Type", "customer.created")
+	req.Header.Set("Event-Schema-Version", strconv.Itoa(h.version))
+	// Stable per customer, so a receiver can drop replayed deliveries.
+	req.Header.Set("Idempotency-Key", fmt.Sprintf("customer.created-%d", customer.ID))
+	// The id of the request that created the customer, also on replays.
+	if id := correlationFrom(ctx); len(id) != 0 {
+		req.Header.Set("X-Correlation-ID", id)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("create hook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// newCreateHook calls CREATE_HOOK_URL when it is set and does nothing
+// otherwise. CREATE_HOOK_SCHEMA_VERSION pins the body, defaulting to 1 so
+// existing receivers keep getting the body they always have.
+func newCreateHook() CreateHook {
+	url := os.Getenv("CREATE_HOOK_URL")
+	if len(url) == 0 {
+		return noopCreateHook{}
+	}
+
+	version := eventSchemaV1
+	if raw := os.Getenv("CREATE_HOOK_SCHEMA_VERSION"); len(raw) != 0 {
+		v, err := strconv.Atoi(raw)
+		if err == nil {
+			err = checkEventSchema(v)
+		}
+		if err != nil {
+			log.Printf("invalid CREATE_HOOK_SCHEMA_VERSION %q, using %d: %v", raw, eventSchemaV1, err)
+		} else {
+			version = v
+		}
+	}
+	return &httpCreateHook{url: url, client: &http.Client{}, version: version}
+}
+
+func createHookRetries() int {
+	retries, err := strconv.Atoi(os.Getenv("CREATE_HOOK_RETRIES"))
+	if err != nil || retries < 0 {
+		return defaultCreateHookRetries
+	}
+	return retries
+}
+
+func (a *App) SetCreateHook(h CreateHook) {
+	a.createHook = h
+}
+
+// afterCreate runs the create hook for each customer in the background.
+// Every path that creates customers calls it once committed: create, batch,
+// import, ensure and sync, including customers a sync brings back from a
+// soft delete. A restore does not, since it only reloads customers.
+// correlation is the id of the request that created them.
+func (a *App) afterCreate(correlation string, customers ...Customer) {
+	for _, customer := range customers {
+		go a.runCreateHook(correlation, customer)
+	}
+}
+
+func (a *App) runCreateHook(correlation string, customer Customer) {
+	retries := createHookRetries()
+	backoff := createHookBackoff
+
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(withCorrelation(context.Background(), correlation), createHookTimeout)
+		err := a.createHook.CustomerCreated(ctx, customer)
+		cancel()
+		if err == nil {
+			return
+		}
+
+		if attempt >= retries {
+			log.Printf("create hook for customer %d failed after %d attempts: %v", customer.ID, attempt+1, err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
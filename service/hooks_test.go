@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordingHook hands every customer it is called with to the test.
+type recordingHook chan Customer
+
+func (h recordingHook) CustomerCreated(ctx context.Context, customer Customer) error {
+	h <- customer
+	return nil
+}
+
+// nextCreated waits for the hook to fire.
+func (h recordingHook) nextCreated(t *testing.T) Customer {
+	t.Helper()
+	select {
+	case customer := <-h:
+		return customer
+	case <-time.After(5 * time.Second):
+		t.Fatal("the create hook did not fire")
+		return Customer{}
+	}
+}
+
+func TestCreateHookFiresAfterCreate(t *testing.T) {
+	pg := postgresDB(t)
+	a := GetApp(pg)
+	hook := make(recordingHook, 1)
+	a.SetCreateHook(hook)
+	r := gin.New()
+	r.POST("/customers", a.PostHandler)
+
+	w := request(r, http.MethodPost, "/customers", `{"name": "Ada", "email": "ada@example.com"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var created Customer
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	got := hook.nextCreated(t)
+	if got.ID != created.ID || got.Email != "ada@example.com" {
+		t.Errorf("hook got customer %d <%s>, want %d <ada@example.com>", got.ID, got.Email, created.ID)
+	}
+	var committed bool
+	if err := pg.DB.Get(&committed, `SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1)`, got.ID); err != nil || !committed {
+		t.Errorf("the hook fired for customer %d before it was committed", got.ID)
+	}
+}
+
+func TestCreateHookFiresForCustomersASyncInserts(t *testing.T) {
+	pg := postgresDB(t)
+	setPartnerTokens(t, "acme:acme-token")
+	a := GetApp(pg)
+	hook := make(recordingHook, 2)
+	a.SetCreateHook(hook)
+	r := syncRouter(a)
+
+	pg.DB.MustExec(`INSERT INTO customers (partner, client_reference_id, email) VALUES ('acme', 'a', 'a@example.com')`)
+	w := request(r, http.MethodPost, "/customers/sync", `[
+	    {"client_reference_id": "a", "name": "Ada", "email": "a@example.com"},
+	    {"client_reference_id": "b", "name": "Bob", "email": "b@example.com"}
+	]`, "Authorization", "Bearer acme-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+
+	if got := hook.nextCreated(t); got.Reference != "b" || got.Partner != "acme" {
+		t.Errorf("hook got %q of %q, want b of acme", got.Reference, got.Partner)
+	}
+	select {
+	case got := <-hook:
+		t.Errorf("hook also fired for the updated customer %q", got.Reference)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
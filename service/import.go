@@ -0,0 +1,135 @@
+package service
+
+import (
+	"customer-service/db"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// importFields are the customer fields a CSV column can map to.
+var importFields = map[string]func(*Customer, string){
+	"name":    func(c *Customer, v string) { c.Name = v },
+	"email":   func(c *Customer, v string) { c.Email = v },
+	"address": func(c *Customer, v string) { c.Address = v },
+	"owner":   func(c *Customer, v string) { c.Owner = v },
+}
+
+var requiredImportFields = []string{"email"}
+
+// importMapping resolves which column index feeds which field. The mapping
+// form field maps CSV headers to fields, e.g. {"E-mail": "email"}; without
+// it, headers must be the field names themselves.
+func importMapping(header []string, raw string) (map[int]string, error) {
+	mapping := make(map[string]string)
+	if len(raw) == 0 {
+		for _, h := range header {
+			mapping[strings.TrimSpace(h)] = strings.ToLower(strings.TrimSpace(h))
+		}
+	} else {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return nil, fmt.Errorf("invalid mapping: %w", err)
+		}
+		for column, field := range mapping {
+			if _, ok := importFields[field]; !ok {
+				return nil, fmt.Errorf("mapping for column %q targets unknown field %q", column, field)
+			}
+		}
+	}
+
+	columns := make(map[int]string)
+	mapped := make(map[string]bool)
+	for i, h := range header {
+		field, ok := mapping[strings.TrimSpace(h)]
+		if !ok {
+			continue
+		}
+		if _, known := importFields[field]; !known {
+			continue
+		}
+		columns[i] = field
+		mapped[field] = true
+	}
+
+	for _, field := range requiredImportFields {
+		if !mapped[field] {
+			return nil, fmt.Errorf("no column is mapped to required field %q", field)
+		}
+	}
+	return columns, nil
+}
+
+func parseImport(r io.Reader, rawMapping string) ([]Customer, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("csv file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	columns, err := importMapping(header, rawMapping)
+	if err != nil {
+		return nil, err
+	}
+
+	customers := make([]Customer, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var customer Customer
+		for i, field := range columns {
+			if i < len(record) {
+				importFields[field](&customer, strings.TrimSpace(record[i]))
+			}
+		}
+		customers = append(customers, customer)
+	}
+	return customers, nil
+}
+
+func importCustomers(db *db.PostgresDB, c *gin.Context) (int, *batchResult, error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return http.StatusBadRequest, nil, fmt.Errorf("file is required: %w", err)
+	}
+	f, err := file.Open()
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	defer f.Close()
+
+	customers, err := parseImport(f, c.PostForm("mapping"))
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if status, err := validateBatch(customers); err != nil {
+		return status, nil, err
+	}
+
+	result, err := insertBatch(db, c, customers, batchChunkSize(), progressReporter(c))
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if result.FailedChunk != nil {
+		return http.StatusMultiStatus, result, nil
+	}
+	return http.StatusCreated, result, nil
+}
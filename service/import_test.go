@@ -0,0 +1,85 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const mappedCSV = "\ufeffE-Mail Address,Full Name,Notes\nada@example.com,Ada Lovelace,first\nbob@example.com,Bob Stone,second\n"
+
+const headerMapping = `{"E-Mail Address": "email", "Full Name": "name"}`
+
+// postImport uploads csv as the file form field, with mapping when set.
+func postImport(r http.Handler, csv, mapping string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "customers.csv")
+	part.Write([]byte(csv))
+	if len(mapping) != 0 {
+		form.WriteField("mapping", mapping)
+	}
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/customers/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func importRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.POST("/customers/import", StreamProgress, a.ImportHandler)
+	return r
+}
+
+func TestParseImportAppliesTheMapping(t *testing.T) {
+	customers, err := parseImport(strings.NewReader(mappedCSV), headerMapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Customer{{Name: "Ada Lovelace", Email: "ada@example.com"}, {Name: "Bob Stone", Email: "bob@example.com"}}
+	if !reflect.DeepEqual(customers, want) {
+		t.Errorf("got %+v, want %+v", customers, want)
+	}
+
+	if _, err := parseImport(strings.NewReader(mappedCSV), ""); err == nil {
+		t.Error("nonstandard headers were accepted without a mapping")
+	}
+}
+
+func TestImportRejectsMappingsToUnknownFields(t *testing.T) {
+	w := postImport(importRouter(GetApp(nil)), mappedCSV, `{"E-Mail Address": "email", "Notes": "phone"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `unknown field \"phone\"`) {
+		t.Errorf("got %d %s, want 400 naming the field", w.Code, w.Body)
+	}
+}
+
+func TestImportCSVWithNonstandardHeaders(t *testing.T) {
+	a := GetApp(postgresDB(t))
+
+	w := postImport(importRouter(a), mappedCSV, headerMapping)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var result batchResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Inserted != 2 {
+		t.Fatalf("inserted %d, want 2", result.Inserted)
+	}
+	var names []string
+	a.db.DB.Select(&names, `SELECT name FROM customers ORDER BY email`)
+	if want := []string{"Ada Lovelace", "Bob Stone"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("imported %v, want %v", names, want)
+	}
+}
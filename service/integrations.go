@@ -0,0 +1,107 @@
+package service
+
+import (
+	"customer-service/db"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+var integrationPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+func checkIntegration(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("integration cannot be empty")
+	}
+	if !integrationPattern.MatchString(name) {
+		return fmt.Errorf("integration %q must be 1 to 64 lowercase letters, digits, '-' or '_'", name)
+	}
+	return nil
+}
+
+// listUnsynced pages through the customers changed since ?integration= last
+// synced them, including those it never synced, oldest change first so a
+// worker drains the backlog in order.
+func listUnsynced(db *db.PostgresDB, c *gin.Context) (int, *customerList, error) {
+	p := struct {
+		Integration string `form:"integration"`
+		Limit       int    `form:"limit"`
+		Offset      int    `form:"offset"`
+	}{Limit: defaultListLimit}
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	integration, limit, offset := p.Integration, p.Limit, p.Offset
+	if err := checkIntegration(integration); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if limit < 1 || limit > maxListLimit {
+		return http.StatusBadRequest, nil, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+	}
+	if offset < 0 {
+		return http.StatusBadRequest, nil, fmt.Errorf("offset cannot be negative")
+	}
+
+	where := ` WHERE ` + notDeleted + ` AND NOT EXISTS (SELECT 1 FROM customer_syncs s
+		WHERE s.integration = $1 AND s.customer_id = customers.id AND s.synced_at >= customers.updated_at)`
+
+	list := &customerList{Data: make([]Customer, 0), Limit: limit, Offset: offset}
+	if err := db.DB.Get(&list.Total, `SELECT COUNT(*) FROM customers`+where, integration); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	stmt := `SELECT ` + customerColumns + ` FROM customers` + where + ` ORDER BY updated_at ASC, id ASC LIMIT $2 OFFSET $3`
+	if err := db.DB.Select(&list.Data, stmt, integration, limit, offset); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, list, nil
+}
+
+type syncMark struct {
+	CustomerID  int       `json:"customer_id" db:"customer_id"`
+	Integration string    `json:"integration"`
+	SyncedAt    time.Time `json:"synced_at" db:"synced_at"`
+}
+
+// markSynced records that an integration has synced the customer. A worker
+// should send the updated_at of the version it synced as synced_at, so a
+// change made while it was working still shows as unsynced; without it the
+// current time is used. synced_at never moves backwards.
+func markSynced(db *db.PostgresDB, c *gin.Context) (int, *syncMark, error) {
+	id, err := paramID(c)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	var mark syncMark
+	if err := bindJSON(c, &mark); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if err := checkIntegration(mark.Integration); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	mark.CustomerID = id
+	if mark.SyncedAt.IsZero() {
+		mark.SyncedAt = time.Now()
+	}
+
+	return upsertSyncMark(db.DB, &mark)
+}
+
+func upsertSyncMark(conn *sqlx.DB, mark *syncMark) (int, *syncMark, error) {
+	stmt := `INSERT INTO customer_syncs (customer_id, integration, synced_at) VALUES ($1, $2, $3)
+		ON CONFLICT (integration, customer_id) DO UPDATE SET synced_at = GREATEST(customer_syncs.synced_at, EXCLUDED.synced_at)
+		RETURNING customer_id, integration, synced_at`
+	var saved syncMark
+	err := conn.QueryRowx(stmt, mark.CustomerID, mark.Integration, mark.SyncedAt).StructScan(&saved)
+	if db.IsForeignKeyViolation(err) {
+		return http.StatusNotFound, nil, fmt.Errorf("customer %d not found", mark.CustomerID)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, &saved, nil
+}
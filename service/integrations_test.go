@@ -0,0 +1,47 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUnsyncedListsWhatEachIntegrationHasNotSynced(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.GET("/customers/unsynced", a.UnsyncedHandler)
+	r.POST("/customers/:customerId/synced", a.SyncedHandler)
+	ids := seedCustomers(t, a, 3, "alice")
+	// Changed an hour ago, in id order.
+	a.db.DB.MustExec(`UPDATE customers SET updated_at = now() - interval '1 hour' + id * interval '1 second'`)
+	unsynced := func(integration string) []int {
+		t.Helper()
+		return listedIDs(listPage(t, r, "/customers/unsynced?integration="+integration))
+	}
+
+	if w := request(r, http.MethodPost, fmt.Sprintf("/customers/%d/synced", ids[0]), `{"integration": "crm"}`); w.Code != http.StatusOK {
+		t.Fatalf("marking synced: got %d: %s", w.Code, w.Body)
+	}
+	if got, want := unsynced("crm"), ids[1:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("unsynced for crm %v, want %v", got, want)
+	}
+	if got := unsynced("billing"); !reflect.DeepEqual(got, ids) {
+		t.Errorf("unsynced for billing %v, want all of %v", got, ids)
+	}
+
+	// A change after the sync makes the customer due again, last in line.
+	a.db.DB.MustExec(`UPDATE customers SET updated_at = now() + interval '1 minute' WHERE id = $1`, ids[0])
+	if got, want := unsynced("crm"), []int{ids[1], ids[2], ids[0]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unsynced for crm after a change %v, want %v", got, want)
+	}
+
+	if w := request(r, http.MethodGet, "/customers/unsynced?integration=CRM!", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("a malformed integration: got %d, want 400", w.Code)
+	}
+	if w := request(r, http.MethodPost, fmt.Sprintf("/customers/%d/synced", ids[2]+1), `{"integration": "crm"}`); w.Code != http.StatusNotFound {
+		t.Errorf("marking an unknown customer: got %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// customerLockWait bounds how long a mutation queues behind others on the
+// same customer before giving up.
+const customerLockWait = 5 * time.Second
+
+// keyedMutex serializes work per customer id within this instance. Each
+// entry is a one-slot channel, so waiting can be abandoned when the context
+// ends, and is dropped once nobody holds or waits for it.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[int]*keyLock
+}
+
+type keyLock struct {
+	slot chan struct{}
+	refs int
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: make(map[int]*keyLock)}
+}
+
+// lock blocks until id is free or ctx is done. On success the returned func
+// releases the lock and must be called exactly once.
+func (m *keyedMutex) lock(ctx context.Context, id int) (func(), error) {
+	m.mu.Lock()
+	l, ok := m.locks[id]
+	if !ok {
+		l = &keyLock{slot: make(chan struct{}, 1)}
+		m.locks[id] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	select {
+	case l.slot <- struct{}{}:
+		return func() {
+			<-l.slot
+			m.release(id, l)
+		}, nil
+	case <-ctx.Done():
+		m.release(id, l)
+		return nil, ctx.Err()
+	}
+}
+
+func (m *keyedMutex) release(id int, l *keyLock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l.refs--; l.refs == 0 {
+		delete(m.locks, id)
+	}
+}
+
+// SerializeCustomer runs mutations of one customer one at a time, so rapid
+// successive writes queue here instead of racing in the database. Each
+// request takes a single lock, which rules out lock-order deadlocks; bulk
+// endpoints touching many customers are not serialized.
+func (a *App) SerializeCustomer(c *gin.Context) {
+	id, err := paramID(c)
+	if err != nil {
+		// Let the handler reject the id.
+		c.Next()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), customerLockWait)
+	defer cancel()
+	unlock, err := a.locks.lock(ctx, id)
+	if err != nil {
+		if c.Request.Context().Err() != nil {
+			c.Abort()
+			return
+		}
+		renderError(c, http.StatusServiceUnavailable, retryLater(fmt.Errorf("customer is busy, retry shortly"), customerLockRetryAfter))
+		c.Abort()
+		return
+	}
+	defer unlock()
+
+	c.Next()
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSerializedWritesToOneCustomerLoseNothing(t *testing.T) {
+	a := GetApp(nil)
+	r := gin.New()
+	// Each request reads the count, yields, then writes it back: without
+	// the lock, concurrent requests would overwrite each other.
+	count := 0
+	r.PUT("/customers/:customerId", a.SerializeCustomer, func(c *gin.Context) {
+		n := count
+		time.Sleep(time.Millisecond)
+		count = n + 1
+		c.Status(http.StatusNoContent)
+	})
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := request(r, http.MethodPut, "/customers/7", ""); w.Code != http.StatusNoContent {
+				t.Errorf("got %d: %s", w.Code, w.Body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count != writers {
+		t.Errorf("%d of %d writes survived", count, writers)
+	}
+	if len(a.locks.locks) != 0 {
+		t.Errorf("%d locks left behind", len(a.locks.locks))
+	}
+}
+
+func TestKeyedMutexWaitEndsWithTheContext(t *testing.T) {
+	m := newKeyedMutex()
+	unlock, err := m.lock(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := m.lock(context.Background(), 8)
+	if err != nil {
+		t.Fatalf("another id was blocked: %v", err)
+	}
+	other()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.lock(ctx, 7); err == nil {
+		t.Fatal("locked a held id")
+	}
+	unlock()
+	if len(m.locks) != 0 {
+		t.Errorf("%d locks left behind", len(m.locks))
+	}
+}
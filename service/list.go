@@ -0,0 +1,289 @@
+package service
+
+import (
+	"crypto/sha256"
+	"customer-service/db"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// sortColumns lists the fields clients may sort by. desc marks fields
+// sorted in descending order unless the client says otherwise, such as
+// timestamps, where newest first is the useful default.
+var sortColumns = map[string]struct {
+	column string
+	desc   bool
+}{
+	"id":         {column: "id"},
+	"name":       {column: "name"},
+	"email":      {column: "email"},
+	"owner":      {column: "owner"},
+	"created_at": {column: "created_at", desc: true},
+	"updated_at": {column: "updated_at", desc: true},
+}
+
+type customerList struct {
+	Data   []Customer `json:"data"`
+	Total  int        `json:"total"`
+	Limit  int        `json:"limit"`
+	Offset int        `json:"offset"`
+
+	// Page, PerPage and TotalPages are set for page/perPage style paging.
+	Page       int `json:"page,omitempty"`
+	PerPage    int `json:"per_page,omitempty"`
+	TotalPages int `json:"total_pages,omitempty"`
+
+	// NextPageToken fetches the following page with the same filters and
+	// sort. It is empty on the last page.
+	NextPageToken string `json:"next_page_token,omitempty"`
+}
+
+// orderBy turns a sort parameter such as "name", "-name" or "+name" into an
+// ORDER BY clause. Without a sign the field's default direction applies. A
+// "+" left unescaped in the query string arrives as a space and is read the
+// same way. id is always appended as a tiebreaker so rows with equal sort
+// keys keep the same order from page to page.
+func orderBy(sort string) (string, error) {
+	if len(sort) == 0 {
+		sort = "id"
+	}
+
+	var explicit string
+	switch sort[0] {
+	case '-', '+', ' ':
+		explicit, sort = sort[:1], sort[1:]
+	}
+
+	field, ok := sortColumns[sort]
+	if !ok {
+		return "", fmt.Errorf("cannot sort by %q", sort)
+	}
+	desc := field.desc
+	if len(explicit) != 0 {
+		desc = explicit == "-"
+	}
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+
+	if field.column == "id" {
+		return fmt.Sprintf(" ORDER BY id %s", dir), nil
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, id ASC", field.column, dir), nil
+}
+
+// listQuery is the SELECT a list request runs, with the paging it asked for.
+type listQuery struct {
+	where  string
+	args   []interface{}
+	order  string
+	limit  int
+	offset int
+
+	state *pageState
+}
+
+// pagingParams are the two pagination styles parsePaging tells apart.
+type pagingParams struct {
+	Limit   *int `form:"limit"`
+	Offset  *int `form:"offset"`
+	Page    *int `form:"page"`
+	PerPage *int `form:"perPage"`
+}
+
+// listParams are the parameters a page token carries.
+type listParams struct {
+	pagingParams
+	savedQueryParams
+	Sort  string `form:"sort"`
+	Owner string `form:"owner"`
+}
+
+// pageParams are the list parameters or the ?page_token= replacing them.
+type pageParams struct {
+	PageToken *string `form:"page_token"`
+	listParams
+}
+
+// parseListQuery reads the list parameters, or the ?page_token= that
+// stands in for all of them.
+func parseListQuery(db *db.PostgresDB, c *gin.Context, p *pageParams) (int, *listQuery, error) {
+	status, state, err := parsePageState(db, c, p)
+	if err != nil {
+		return status, nil, err
+	}
+
+	if state.Limit < 1 || state.Limit > maxListLimit {
+		return http.StatusBadRequest, nil, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+	}
+	if state.Offset < 0 {
+		return http.StatusBadRequest, nil, fmt.Errorf("offset cannot be negative")
+	}
+	order, err := orderBy(state.Sort)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	where, args := state.Filters.where(make([]interface{}, 0))
+
+	return http.StatusOK, &listQuery{where: " WHERE " + notDeleted + where, args: args, order: order, limit: state.Limit, offset: state.Offset, state: state}, nil
+}
+
+func parsePageState(db *db.PostgresDB, c *gin.Context, p *pageParams) (int, *pageState, error) {
+	if p.PageToken != nil {
+		for _, name := range queryNames(reflect.TypeOf(p.listParams)) {
+			if _, ok := c.GetQuery(name); ok {
+				return http.StatusBadRequest, nil, fmt.Errorf("%s cannot be combined with page_token, which already carries it", name)
+			}
+		}
+		state, err := decodePageToken(*p.PageToken)
+		if err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		return http.StatusOK, state, nil
+	}
+
+	status, state, err := parsePaging(p.pagingParams)
+	if err != nil {
+		return status, nil, err
+	}
+
+	// A saved query is resolved now, so later pages keep its filters even
+	// if it is changed meanwhile.
+	status, saved, err := savedFilters(db, c, p.savedQueryParams)
+	if err != nil {
+		return status, nil, err
+	}
+	state.Sort = p.Sort
+	if saved != nil {
+		state.Filters = *saved
+	}
+	if len(p.Owner) != 0 {
+		state.Filters.Owner = p.Owner
+	}
+	return http.StatusOK, state, nil
+}
+
+// parsePaging reads either limit and offset or page and perPage, which are
+// converted to a limit and offset. Which style applies is detected from the
+// parameters present; PAGINATION_STYLE=page makes page/perPage the default
+// when neither is given and PAGINATION_STYLE=offset disallows it.
+func parsePaging(p pagingParams) (int, *pageState, error) {
+	offsetStyle, pageStyle := p.Limit != nil || p.Offset != nil, p.Page != nil || p.PerPage != nil
+	if offsetStyle && pageStyle {
+		return http.StatusBadRequest, nil, fmt.Errorf("use either limit and offset or page and perPage, not both")
+	}
+	style := os.Getenv("PAGINATION_STYLE")
+	if pageStyle && style == "offset" {
+		return http.StatusBadRequest, nil, fmt.Errorf("page and perPage are not supported; use limit and offset")
+	}
+
+	if pageStyle || (style == "page" && !offsetStyle) {
+		page, perPage := intOr(p.Page, 1), intOr(p.PerPage, defaultListLimit)
+		if page < 1 {
+			return http.StatusBadRequest, nil, fmt.Errorf("page must be at least 1")
+		}
+		if perPage < 1 || perPage > maxListLimit {
+			return http.StatusBadRequest, nil, fmt.Errorf("perPage must be between 1 and %d", maxListLimit)
+		}
+		return http.StatusOK, &pageState{Limit: perPage, Offset: (page - 1) * perPage, Paged: true}, nil
+	}
+
+	return http.StatusOK, &pageState{Limit: intOr(p.Limit, defaultListLimit), Offset: intOr(p.Offset, 0)}, nil
+}
+
+// intOr returns *v, or def when v is unset.
+func intOr(v *int, def int) int {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+// nextPageToken returns the token for the page after q, or "" when q is
+// the last one.
+func (q *listQuery) nextPageToken(total int) (string, error) {
+	if q.offset+q.limit >= total {
+		return "", nil
+	}
+	next := *q.state
+	next.Offset = q.offset + q.limit
+	return encodePageToken(&next)
+}
+
+func (q *listQuery) selectStmt() (string, []interface{}) {
+	stmt := `SELECT ` + customerColumns + ` FROM customers` + q.where + q.order
+	stmt += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(q.args)+1, len(q.args)+2)
+	args := append(append(make([]interface{}, 0, len(q.args)+2), q.args...), q.limit, q.offset)
+	return stmt, args
+}
+
+// collectionETag is the weak ETag for a page of the list. It hashes the
+// page itself, so it changes exactly when the rows on it, their order or
+// the total change, and never depends on writes being visible in order.
+// The page is hashed as render sends it, already localized and with the
+// field names the caller asked for, so each representation has its own.
+func collectionETag(c *gin.Context, list *customerList) string {
+	var obj interface{} = list
+	if camelCase(c) {
+		obj = camelTree(list)
+	}
+	body, _ := json.Marshal(obj)
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`W/"customers-%x"`, sum[:12])
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using
+// the weak comparison RFC 9110 prescribes for it.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func listCustomers(db *db.PostgresDB, c *gin.Context) (int, *customerList, error) {
+	var p pageParams
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	status, q, err := parseListQuery(db, c, &p)
+	if err != nil {
+		return status, nil, err
+	}
+
+	list := &customerList{Data: make([]Customer, 0), Limit: q.limit, Offset: q.offset}
+	if q.state.Paged {
+		list.Page, list.PerPage = q.offset/q.limit+1, q.limit
+	}
+	if err := db.DB.Get(&list.Total, `SELECT COUNT(*) FROM customers`+q.where, q.args...); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if q.state.Paged {
+		list.TotalPages = (list.Total + q.limit - 1) / q.limit
+	}
+
+	stmt, args := q.selectStmt()
+	if err := db.DB.Select(&list.Data, stmt, args...); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if list.NextPageToken, err = q.nextPageToken(list.Total); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, list, nil
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func listRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.GET("/customers", a.ListHandler)
+	return r
+}
+
+// listPage fetches one page of the list.
+func listPage(t *testing.T, r *gin.Engine, target string, headers ...string) customerList {
+	t.Helper()
+	w := request(r, http.MethodGet, target, "", headers...)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: %d %s", target, w.Code, w.Body)
+	}
+	var list customerList
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func listedIDs(list customerList) []int {
+	ids := make([]int, 0, len(list.Data))
+	for _, customer := range list.Data {
+		ids = append(ids, customer.ID)
+	}
+	return ids
+}
+
+func TestOrderByBreaksTiesByID(t *testing.T) {
+	for sort, want := range map[string]string{
+		"":      " ORDER BY id ASC",
+		"-id":   " ORDER BY id DESC",
+		"owner": " ORDER BY owner ASC, id ASC",
+		"-name": " ORDER BY name DESC, id ASC",
+	} {
+		if got, err := orderBy(sort); err != nil || got != want {
+			t.Errorf("orderBy(%q) = %q, %v, want %q", sort, got, err, want)
+		}
+	}
+}
+
+func TestSortFieldsHaveDefaultDirections(t *testing.T) {
+	for sort, want := range map[string]string{
+		"name":        " ORDER BY name ASC, id ASC",
+		"created_at":  " ORDER BY created_at DESC, id ASC",
+		"updated_at":  " ORDER BY updated_at DESC, id ASC",
+		"+created_at": " ORDER BY created_at ASC, id ASC",
+		" created_at": " ORDER BY created_at ASC, id ASC",
+		"-created_at": " ORDER BY created_at DESC, id ASC",
+	} {
+		if got, err := orderBy(sort); err != nil || got != want {
+			t.Errorf("orderBy(%q) = %q, %v, want %q", sort, got, err, want)
+		}
+	}
+	if w := request(listRouter(GetApp(nil)), http.MethodGet, "/customers?sort=-address", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("sorting by an unknown field: got %d, want 400", w.Code)
+	}
+}
+
+func TestPagingOverEqualSortKeysIsStable(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := listRouter(a)
+	ids := seedCustomers(t, a, 5, "alice")
+
+	seen := make([]int, 0, len(ids))
+	for offset := 0; offset < len(ids); offset += 2 {
+		page := listPage(t, r, "/customers?sort=owner&limit=2&offset="+strconv.Itoa(offset))
+		seen = append(seen, listedIDs(page)...)
+	}
+	if !reflect.DeepEqual(seen, ids) {
+		t.Errorf("paging by the shared owner listed %v, want each of %v once in id order", seen, ids)
+	}
+}
+
+func TestActiveCustomersQueryUsesPartialIndex(t *testing.T) {
+	pg := postgresDB(t)
+
+	var predicate string
+	err := pg.DB.Get(&predicate, `SELECT pg_get_expr(i.indpred, i.indrelid) FROM pg_index i
+	WHERE i.indexrelid = 'customers_active_idx'::regclass`)
+	if err != nil {
+		t.Fatalf("customers_active_idx is missing: %v", err)
+	}
+	if predicate != "(deleted_at IS NULL)" {
+		t.Fatalf("customers_active_idx is on %s, want deleted_at IS NULL", predicate)
+	}
+
+	pg.DB.MustExec(`INSERT INTO customers (name, email, owner, deleted_at)
+	SELECT 'c' || n, 'c' || n || '@example.com', 'o', CASE WHEN n % 2 = 0 THEN now() END
+	FROM generate_series(1, 2000) n`)
+	pg.DB.MustExec(`ANALYZE customers`)
+
+	tx := pg.DB.MustBegin()
+	defer tx.Rollback()
+	tx.MustExec(`SET LOCAL enable_seqscan = off`)
+
+	q := &listQuery{where: " WHERE " + notDeleted, order: " ORDER BY id ASC", limit: defaultListLimit}
+	stmt, args := q.selectStmt()
+	var plan []string
+	if err := tx.Select(&plan, `EXPLAIN `+stmt, args...); err != nil {
+		t.Fatal(err)
+	}
+	if joined := strings.Join(plan, "\n"); !strings.Contains(joined, "customers_active_idx") {
+		t.Errorf("the active-customers query does not use customers_active_idx:\n%s", joined)
+	}
+}
+
+func TestCollectionETagDiffersPerRepresentation(t *testing.T) {
+	created := time.Date(2024, time.March, 1, 23, 30, 0, 0, time.UTC)
+	etag := func(tz, accept string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/customers", nil)
+		c.Request.Header.Set("Accept", accept)
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Set(timezoneKey, loc)
+		list := &customerList{Data: []Customer{{ID: 1, Name: "Ada", CreatedAt: created, UpdatedAt: created}}, Total: 1}
+		localize(c, &list.Data[0])
+		return collectionETag(c, list)
+	}
+
+	base := etag("UTC", "application/json")
+	if base != etag("UTC", "application/json") {
+		t.Fatalf("the same page got two ETags")
+	}
+	if base == etag("Europe/Berlin", "application/json") {
+		t.Errorf("the page localized to another timezone kept ETag %s", base)
+	}
+	if base == etag("UTC", "application/json; naming=camel") {
+		t.Errorf("the camelCase page kept ETag %s", base)
+	}
+}
+
+func TestHeadSendsTheCountWithoutABody(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := listRouter(a)
+	r.HEAD("/customers", a.ListHandler)
+	seedCustomers(t, a, 3, "alice")
+
+	get := request(r, http.MethodGet, "/customers?owner=alice", "")
+	head := request(r, http.MethodHead, "/customers?owner=alice", "")
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Fatalf("HEAD: got %d with %d body bytes, want 200 and no body", head.Code, head.Body.Len())
+	}
+	for _, name := range []string{"X-Total-Count", "ETag"} {
+		if got, want := head.Header().Get(name), get.Header().Get(name); got != want || len(got) == 0 {
+			t.Errorf("HEAD %s is %q, GET sends %q", name, got, want)
+		}
+	}
+	if got := head.Header().Get("X-Total-Count"); got != "3" {
+		t.Errorf("X-Total-Count %s, want 3", got)
+	}
+
+	etag := head.Header().Get("ETag")
+	if w := request(r, http.MethodHead, "/customers?owner=alice", "", "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("HEAD with a current ETag: got %d, want 304", w.Code)
+	}
+	a.db.DB.MustExec(`INSERT INTO customers (name, email, owner) VALUES ('Bob', 'bob@example.com', 'bob')`)
+	if w := request(r, http.MethodHead, "/customers?owner=alice", "", "If-None-Match", etag); w.Code != http.StatusOK {
+		t.Errorf("HEAD after a write: got %d, want 200 with a new ETag", w.Code)
+	}
+}
+
+func TestTotalCountHeaderMatchesTheBody(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := listRouter(a)
+	r.GET("/customers/unsynced", a.UnsyncedHandler)
+	seedCustomers(t, a, 5, "alice")
+
+	for _, target := range []string{"/customers?limit=2", "/customers?limit=2&offset=4", "/customers/unsynced?integration=crm&limit=2"} {
+		w := request(r, http.MethodGet, target, "")
+		var list customerList
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", target, w.Code, w.Body)
+		}
+		if got := w.Header().Get("X-Total-Count"); got != strconv.Itoa(list.Total) || list.Total != 5 {
+			t.Errorf("%s: X-Total-Count %s with a body total of %d, want both 5", target, got, list.Total)
+		}
+	}
+}
+
+func TestPageTokenKeepsTheFilters(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := listRouter(a)
+	alice := seedCustomers(t, a, 3, "alice")
+	a.db.DB.MustExec(`INSERT INTO customers (name, email, owner) VALUES ('Bob', 'bob@example.com', 'bob'), ('Bo', 'bo@example.com', 'bob')`)
+
+	first := listPage(t, r, "/customers?owner=alice&limit=2")
+	if len(first.NextPageToken) == 0 {
+		t.Fatalf("first page %+v carries no next_page_token", first)
+	}
+	second := listPage(t, r, "/customers?page_token="+url.QueryEscape(first.NextPageToken))
+	if got := append(listedIDs(first), listedIDs(second)...); !reflect.DeepEqual(got, alice) {
+		t.Errorf("following the token listed %v, want alice's %v", got, alice)
+	}
+	if second.Limit != 2 || second.Offset != 2 || len(second.NextPageToken) != 0 {
+		t.Errorf("second page at %d+%d with token %q, want the last page at 2+2", second.Offset, second.Limit, second.NextPageToken)
+	}
+}
+
+func TestPageTokenCannotBeAlteredOrOverridden(t *testing.T) {
+	r := listRouter(GetApp(nil))
+	token, err := encodePageToken(&pageState{Filters: customerFilters{Owner: "alice"}, Limit: 2, Offset: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := decodePageToken(token)
+	if err != nil || state.Filters.Owner != "alice" || state.Offset != 2 {
+		t.Fatalf("decoded %+v, %v", state, err)
+	}
+
+	last := "A"
+	if strings.HasSuffix(token, last) {
+		last = "B"
+	}
+	tampered := token[:len(token)-1] + last
+	for _, target := range []string{
+		"/customers?page_token=" + url.QueryEscape(tampered),
+		"/customers?page_token=" + url.QueryEscape(token) + "&owner=bob",
+	} {
+		if w := request(r, http.MethodGet, target, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", target, w.Code)
+		}
+	}
+}
+
+func TestPagePerPageStyleReportsPageMetadata(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := listRouter(a)
+	ids := seedCustomers(t, a, 5, "alice")
+
+	list := listPage(t, r, "/customers?page=2&perPage=2")
+	if want := ids[2:4]; !reflect.DeepEqual(listedIDs(list), want) {
+		t.Errorf("page 2 listed %v, want %v", listedIDs(list), want)
+	}
+	if list.Page != 2 || list.PerPage != 2 || list.TotalPages != 3 || list.Limit != 2 || list.Offset != 2 {
+		t.Errorf("page %d of %d by %d at %d+%d, want page 2 of 3 by 2 at 2+2", list.Page, list.TotalPages, list.PerPage, list.Offset, list.Limit)
+	}
+	last := listPage(t, r, "/customers?page_token="+url.QueryEscape(list.NextPageToken))
+	if last.Page != 3 || last.TotalPages != 3 || !reflect.DeepEqual(listedIDs(last), ids[4:]) {
+		t.Errorf("next page %d of %d listed %v, want page 3 of 3 with %v", last.Page, last.TotalPages, listedIDs(last), ids[4:])
+	}
+
+	t.Setenv("PAGINATION_STYLE", "page")
+	if list := listPage(t, r, "/customers"); list.Page != 1 || list.PerPage != defaultListLimit {
+		t.Errorf("PAGINATION_STYLE=page listed page %d by %d, want page 1 by %d", list.Page, list.PerPage, defaultListLimit)
+	}
+	if list := listPage(t, r, "/customers?limit=2"); list.Page != 0 {
+		t.Errorf("limit with PAGINATION_STYLE=page reported page %d, want offset style", list.Page)
+	}
+}
+
+func TestPagingStylesCannotBeMixed(t *testing.T) {
+	r := listRouter(GetApp(nil))
+	for _, target := range []string{"/customers?page=1&limit=10", "/customers?perPage=10&offset=20", "/customers?page=0", "/customers?perPage=0"} {
+		if w := request(r, http.MethodGet, target, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", target, w.Code)
+		}
+	}
+	t.Setenv("PAGINATION_STYLE", "offset")
+	if w := request(r, http.MethodGet, "/customers?page=2", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("page with PAGINATION_STYLE=offset: got %d, want 400", w.Code)
+	}
+}
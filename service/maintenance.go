@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"customer-service/db"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const defaultVacuumInterval = 10 * time.Minute
+
+// maintainedTables are the tables the maintenance endpoints act on. Names
+// are only ever taken from here, never from the request.
+var maintainedTables = []string{"customers", "customer_events", "customer_audit", "customer_tombstones", "customer_syncs", "saved_queries"}
+
+// vacuumGate lets one vacuum run at a time, and at most one start per
+// VACUUM_MIN_INTERVAL, so the endpoint cannot be used to keep the database
+// busy.
+type vacuumGate struct {
+	mu      sync.Mutex
+	running bool
+	last    time.Time
+}
+
+func vacuumInterval() time.Duration {
+	d, err := time.ParseDuration(os.Getenv("VACUUM_MIN_INTERVAL"))
+	if err != nil || d < 0 {
+		return defaultVacuumInterval
+	}
+	return d
+}
+
+func (g *vacuumGate) begin() (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running {
+		return http.StatusConflict, fmt.Errorf("a vacuum is already running")
+	}
+	if wait := time.Until(g.last.Add(vacuumInterval())); wait > 0 {
+		return http.StatusTooManyRequests, retryLater(fmt.Errorf("the last vacuum started less than %s ago", vacuumInterval()), wait)
+	}
+	g.running = true
+	g.last = time.Now()
+	return http.StatusOK, nil
+}
+
+func (g *vacuumGate) end() {
+	g.mu.Lock()
+	g.running = false
+	g.mu.Unlock()
+}
+
+type vacuumedTable struct {
+	Table      string `json:"table"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// vacuumTables runs VACUUM (ANALYZE) on each maintained table, or on the
+// one named by ?table=. VACUUM cannot run inside a transaction and may take
+// longer than the statement timeout, so it gets a connection of its own
+// with the timeout lifted, restored before the connection is returned.
+func (a *App) vacuumTables(c *gin.Context) (int, gin.H, error) {
+	var p struct {
+		Table *string `form:"table"`
+	}
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	tables := maintainedTables
+	if table := p.Table; table != nil {
+		tables = nil
+		for _, t := range maintainedTables {
+			if t == *table {
+				tables = []string{t}
+			}
+		}
+		if tables == nil {
+			return http.StatusBadRequest, nil, fmt.Errorf("unknown table %q", *table)
+		}
+	}
+
+	if status, err := a.vacuum.begin(); err != nil {
+		return status, nil, err
+	}
+	defer a.vacuum.end()
+
+	conn, err := a.db.DB.Connx(c.Request.Context())
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(c.Request.Context(), `SET statement_timeout = 0`); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	defer conn.ExecContext(context.Background(), `RESET statement_timeout`)
+
+	done := make([]vacuumedTable, 0, len(tables))
+	for _, table := range tables {
+		start := time.Now()
+		if _, err := conn.ExecContext(c.Request.Context(), `VACUUM (ANALYZE) `+table); err != nil {
+			return http.StatusInternalServerError, nil, fmt.Errorf("vacuuming %s: %w", table, err)
+		}
+		done = append(done, vacuumedTable{Table: table, DurationMS: time.Since(start).Milliseconds()})
+	}
+	return http.StatusOK, gin.H{"data": done}, nil
+}
+
+type tableBloat struct {
+	Table          string     `json:"table" db:"table"`
+	LiveRows       int64      `json:"live_rows" db:"live_rows"`
+	DeadRows       int64      `json:"dead_rows" db:"dead_rows"`
+	DeadPercent    float64    `json:"dead_percent" db:"dead_percent"`
+	TotalBytes     int64      `json:"total_bytes" db:"total_bytes"`
+	LastVacuum     *time.Time `json:"last_vacuum" db:"last_vacuum"`
+	LastAutovacuum *time.Time `json:"last_autovacuum" db:"last_autovacuum"`
+	LastAnalyze    *time.Time `json:"last_analyze" db:"last_analyze"`
+}
+
+// reportBloat estimates bloat per maintained table from the dead tuples the
+// statistics collector has counted since the last vacuum.
+func reportBloat(db *db.PostgresDB) (int, gin.H, error) {
+	stmt := `SELECT relname AS table, n_live_tup AS live_rows, n_dead_tup AS dead_rows,
+	    ROUND(100.0 * n_dead_tup / GREATEST(n_live_tup + n_dead_tup, 1), 2)::float8 AS dead_percent,
+	    pg_total_relation_size(relid) AS total_bytes,
+	    last_vacuum, last_autovacuum, GREATEST(last_analyze, last_autoanalyze) AS last_analyze
+	FROM pg_stat_user_tables WHERE schemaname = current_schema() AND relname = ANY($1) ORDER BY n_dead_tup DESC, relname`
+	report := make([]tableBloat, 0)
+	if err := db.DB.Select(&report, stmt, pq.Array(maintainedTables)); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, gin.H{"data": report}, nil
+}
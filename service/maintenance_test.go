@@ -0,0 +1,63 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func maintenanceRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.POST("/admin/maintenance/vacuum", a.VacuumHandler)
+	r.GET("/admin/maintenance/bloat", a.BloatHandler)
+	return r
+}
+
+func TestVacuumRunsAndBloatIsReported(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := maintenanceRouter(a)
+	seedCustomers(t, a, 3, "alice")
+	a.db.DB.MustExec(`DELETE FROM customers`)
+	t.Setenv("VACUUM_MIN_INTERVAL", "0s")
+
+	w := request(r, http.MethodPost, "/admin/maintenance/vacuum?table=customers", "")
+	var vacuumed struct{ Data []vacuumedTable }
+	if err := json.Unmarshal(w.Body.Bytes(), &vacuumed); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("vacuum: got %d: %s", w.Code, w.Body)
+	}
+	if len(vacuumed.Data) != 1 || vacuumed.Data[0].Table != "customers" {
+		t.Errorf("vacuumed %+v, want customers alone", vacuumed.Data)
+	}
+
+	w = request(r, http.MethodGet, "/admin/maintenance/bloat", "")
+	var bloat struct{ Data []tableBloat }
+	if err := json.Unmarshal(w.Body.Bytes(), &bloat); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("bloat: got %d: %s", w.Code, w.Body)
+	}
+	reported := false
+	for _, table := range bloat.Data {
+		reported = reported || table.Table == "customers"
+	}
+	if !reported {
+		t.Errorf("bloat report %+v leaves out customers", bloat.Data)
+	}
+
+	t.Setenv("VACUUM_MIN_INTERVAL", "1h")
+	if w := request(r, http.MethodPost, "/admin/maintenance/vacuum", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("a vacuum right after another: got %d, want 429", w.Code)
+	}
+}
+
+func TestVacuumRefusesUnknownTablesAndOverlappingRuns(t *testing.T) {
+	a := GetApp(nil)
+	r := maintenanceRouter(a)
+	if w := request(r, http.MethodPost, "/admin/maintenance/vacuum?table=pg_class", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("an unknown table: got %d, want 400", w.Code)
+	}
+	a.vacuum.running = true
+	if w := request(r, http.MethodPost, "/admin/maintenance/vacuum", ""); w.Code != http.StatusConflict {
+		t.Errorf("while a vacuum runs: got %d, want 409", w.Code)
+	}
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const defaultMergeThreshold = 0.95
+
+// Group statuses in auto-merge mode.
+const (
+	groupMerged = "merged"
+	groupReview = "review"
+)
+
+// mergeThreshold reads DEDUP_MERGE_THRESHOLD, the name similarity two
+// customers sharing an email need before they are merged unattended.
+func mergeThreshold() float64 {
+	v, err := strconv.ParseFloat(os.Getenv("DEDUP_MERGE_THRESHOLD"), 64)
+	if err != nil || v <= 0 || v > 1 {
+		return defaultMergeThreshold
+	}
+	return v
+}
+
+// conflicts reports whether two optional values are both set and differ.
+func conflicts(a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	return len(a) != 0 && len(b) != 0 && !strings.EqualFold(a, b)
+}
+
+func conflictsPtr[T comparable](a, b *T) bool {
+	return a != nil && b != nil && *a != *b
+}
+
+// safeToMerge applies the auto-merge rules to a pair: identical email,
+// names at least threshold similar, and no field that both set to
+// different values. Anything less is left for a person to review.
+func safeToMerge(a, b *Customer, threshold float64) bool {
+	if !strings.EqualFold(strings.TrimSpace(a.Email), strings.TrimSpace(b.Email)) {
+		return false
+	}
+	if len(a.Name) == 0 || len(b.Name) == 0 || similarity(a.Name, b.Name) < threshold {
+		return false
+	}
+	if conflicts(a.Address, b.Address) || conflicts(a.Owner, b.Owner) ||
+		conflicts(a.Partner, b.Partner) || conflicts(a.Reference, b.Reference) {
+		return false
+	}
+	if conflictsPtr(a.ParentID, b.ParentID) || conflictsPtr(a.Lat, b.Lat) || conflictsPtr(a.Lng, b.Lng) {
+		return false
+	}
+	linked := (a.ParentID != nil && *a.ParentID == b.ID) || (b.ParentID != nil && *b.ParentID == a.ID)
+	return !linked
+}
+
+// mergeInto folds dup into survivor: fields survivor lacks are taken from
+// dup and the tags are combined. It returns the fields that changed.
+func mergeInto(survivor, dup *Customer) []string {
+	filled := make([]string, 0)
+	fill := func(field string, dst *string, src string) {
+		if len(strings.TrimSpace(*dst)) == 0 && len(strings.TrimSpace(src)) != 0 {
+			*dst = src
+			filled = append(filled, field)
+		}
+	}
+	fill("address", &survivor.Address, dup.Address)
+	fill("owner", &survivor.Owner, dup.Owner)
+	fill("partner", &survivor.Partner, dup.Partner)
+	fill("client_reference_id", &survivor.Reference, dup.Reference)
+	if survivor.ParentID == nil && dup.ParentID != nil {
+		survivor.ParentID = dup.ParentID
+		filled = append(filled, "parent_id")
+	}
+	if survivor.Lat == nil && dup.Lat != nil {
+		survivor.Lat, survivor.Lng = dup.Lat, dup.Lng
+		filled = append(filled, "lat", "lng")
+	}
+	tagged := false
+	for _, tag := range dup.Tags {
+		if !hasTag(survivor, tag) {
+			survivor.Tags = append(survivor.Tags, tag)
+			tagged = true
+		}
+	}
+	if tagged {
+		filled = append(filled, "tags")
+	}
+	return filled
+}
+
+// mergeGroup merges the group into its oldest customer if every other
+// member is safe to merge into it. It returns the customers it changed,
+// survivor first, or none when the group needs review, and records on the
+// group what the merge did. The rows are locked and re-read first, so the
+// rules are checked against current data. Children of the merged customers
+// move to the survivor, which is what keeps the delete from being refused.
+func mergeGroup(tx *sqlx.Tx, c *gin.Context, group *dedupGroup, threshold float64) ([]int, error) {
+	ids := make([]int, 0, len(group.Customers))
+	for _, customer := range group.Customers {
+		ids = append(ids, customer.ID)
+	}
+	members := make([]Customer, 0, len(ids))
+	stmt := `SELECT ` + customerColumns + ` FROM customers WHERE id = ANY($1) AND ` + notDeleted + ` ORDER BY id FOR UPDATE`
+	if err := tx.Select(&members, stmt, pq.Array(ids)); err != nil {
+		return nil, err
+	}
+	if len(members) < 2 {
+		return nil, nil
+	}
+
+	survivor := members[0]
+	merged := make([]int, 0, len(members)-1)
+	filled, seen := make([]string, 0), make(map[string]bool)
+	for i := range members[1:] {
+		dup := &members[i+1]
+		if !safeToMerge(&survivor, dup, threshold) {
+			return nil, nil
+		}
+		for _, field := range mergeInto(&survivor, dup) {
+			if !seen[field] {
+				seen[field] = true
+				filled = append(filled, field)
+			}
+		}
+		merged = append(merged, dup.ID)
+	}
+	if len(survivor.Tags) > maxTags() {
+		return nil, nil
+	}
+
+	moved := make([]int, 0)
+	if err := tx.Select(&moved, `UPDATE customers SET parent_id = $1, updated_at = now() WHERE parent_id = ANY($2) RETURNING id`, survivor.ID, pq.Array(merged)); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(deleteStmt(`id = ANY($1)`, `id`), pq.Array(merged)); err != nil {
+		return nil, err
+	}
+	_, err := tx.Exec(`UPDATE customers SET address = $1, owner = $2, partner = $3, client_reference_id = NULLIF($4, ''),
+	    parent_id = $5, lat = $6, lng = $7, tags = $8, updated_at = now() WHERE id = $9`,
+		survivor.Address, survivor.Owner, survivor.Partner, survivor.Reference, survivor.ParentID, survivor.Lat, survivor.Lng, survivor.Tags, survivor.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	detail, err := json.Marshal(gin.H{"merged_ids": merged, "threshold": threshold})
+	if err != nil {
+		return nil, err
+	}
+	auditStmt := `INSERT INTO customer_audit (customer_id, action, detail, actor) VALUES ($1, 'merge', $2, $3)`
+	if _, err := tx.Exec(auditStmt, survivor.ID, detail, resolveActor(c)); err != nil {
+		return nil, fmt.Errorf("auditing merge into %d: %w", survivor.ID, err)
+	}
+	sort.Ints(moved)
+	group.Survivor, group.Filled, group.MovedChildren = survivor.ID, filled, moved
+	return append([]int{survivor.ID}, merged...), nil
+}
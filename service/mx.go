@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mxResolver is the part of net.Resolver the MX check needs.
+type mxResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+var emailResolver mxResolver = net.DefaultResolver
+
+const (
+	defaultMXTimeout  = 2 * time.Second
+	defaultMXCacheTTL = time.Hour
+)
+
+// mxCache remembers which domains accept mail. Only definite answers are
+// cached; a failed lookup is retried on the next request.
+var mxCache sync.Map
+
+type mxEntry struct {
+	accepts bool
+	expires time.Time
+}
+
+// mxCheckEnabled reports whether CHECK_EMAIL_MX=true.
+func mxCheckEnabled() bool {
+	return os.Getenv("CHECK_EMAIL_MX") == "true"
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
+// domainAcceptsMail looks up the domain's MX records within EMAIL_MX_TIMEOUT.
+// A domain that does not exist, has no MX records or publishes the null MX
+// "." does not accept mail. err is set only when DNS gave no definite answer.
+func domainAcceptsMail(domain string) (bool, error) {
+	if v, ok := mxCache.Load(domain); ok {
+		if entry := v.(mxEntry); time.Now().Before(entry.expires) {
+			return entry.accepts, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), envDuration("EMAIL_MX_TIMEOUT", defaultMXTimeout))
+	defer cancel()
+
+	records, err := emailResolver.LookupMX(ctx, domain)
+	var dnsErr *net.DNSError
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		return false, err
+	}
+
+	accepts := false
+	for _, mx := range records {
+		if host := strings.TrimSuffix(mx.Host, "."); len(host) != 0 {
+			accepts = true
+			break
+		}
+	}
+	mxCache.Store(domain, mxEntry{accepts: accepts, expires: time.Now().Add(envDuration("EMAIL_MX_CACHE_TTL", defaultMXCacheTTL))})
+	return accepts, nil
+}
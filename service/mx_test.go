@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+)
+
+// stubResolver answers MX lookups from a fixed table. missing.example does
+// not exist and any other domain fails as if DNS were down.
+type stubResolver map[string][]*net.MX
+
+func (s stubResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if name == "missing.example" {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	records, ok := s[name]
+	if !ok {
+		return nil, errors.New("i/o timeout")
+	}
+	return records, nil
+}
+
+func stubMX(t *testing.T) {
+	t.Setenv("CHECK_EMAIL_MX", "true")
+	resolver := emailResolver
+	emailResolver = stubResolver{
+		"mail.example":   {{Host: "mx.mail.example.", Pref: 10}},
+		"nullmx.example": {{Host: ".", Pref: 0}},
+		"nomx.example":   {},
+	}
+	forget := func() {
+		mxCache.Range(func(k, _ interface{}) bool { mxCache.Delete(k); return true })
+	}
+	forget()
+	t.Cleanup(func() {
+		emailResolver = resolver
+		forget()
+	})
+}
+
+func TestEmailDomainWithoutMXIs422(t *testing.T) {
+	stubMX(t)
+	r := createRouter(GetApp(nil))
+	for _, domain := range []string{"missing.example", "nullmx.example", "nomx.example"} {
+		w := request(r, http.MethodPost, "/customers", `{"name": "Ada", "email": "ada@`+domain+`"}`)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: got %d, want 422: %s", domain, w.Code, w.Body)
+		}
+	}
+}
+
+func TestMXLookupFailureIsOnlyAWarning(t *testing.T) {
+	stubMX(t)
+	warnings, err := checkWarnings(&Customer{Email: "ada@mail.example"})
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("a domain with MX records: %v, %v", warnings, err)
+	}
+	warnings, err = checkWarnings(&Customer{Email: "ada@down.example"})
+	if err != nil || len(warnings) != 1 || warnings[0].Code != codeMXUnverified {
+		t.Errorf("a failed lookup: %v, %v, want one mx_unverified warning", warnings, err)
+	}
+}
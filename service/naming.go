@@ -0,0 +1,126 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// camelCase decides whether response field names are rendered as camelCase
+// instead of the snake_case the API is defined in. A request can choose with
+// an Accept parameter such as "application/json; naming=camel"; otherwise
+// JSON_NAMING applies, defaulting to snake.
+func camelCase(c *gin.Context) bool {
+	for _, accept := range strings.Split(c.GetHeader("Accept"), ",") {
+		_, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch params["naming"] {
+		case "camel":
+			return true
+		case "snake":
+			return false
+		}
+	}
+
+	return os.Getenv("JSON_NAMING") == "camel"
+}
+
+func snakeToCamel(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) != 0 {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// camelToSnake splits before each upper case letter that starts a word, so
+// acronyms stay together: "clientReferenceID" becomes "client_reference_id".
+func camelToSnake(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])
+			if prevLower || nextLower {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// renameKeys rewrites every object key in a decoded JSON value.
+func renameKeys(v interface{}, rename func(string) string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			renamed[rename(k)] = renameKeys(val, rename)
+		}
+		return renamed
+	case []interface{}:
+		for i := range v {
+			v[i] = renameKeys(v[i], rename)
+		}
+	}
+	return v
+}
+
+func decodeJSON(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// camelTree re-encodes obj with camelCase keys, or returns it unchanged if
+// it does not survive the round trip.
+func camelTree(obj interface{}) interface{} {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return obj
+	}
+	v, err := decodeJSON(b)
+	if err != nil {
+		return obj
+	}
+	return renameKeys(v, snakeToCamel)
+}
+
+// JSONNaming lets clients send camelCase JSON bodies by rewriting their keys
+// to snake_case before binding. snake_case keys pass through unchanged, so
+// both conventions are accepted whatever the response naming.
+func JSONNaming(c *gin.Context) {
+	if c.ContentType() != gin.MIMEJSON || c.Request.Body == nil {
+		c.Next()
+		return
+	}
+
+	b, err := io.ReadAll(c.Request.Body)
+	c.Request.Body.Close()
+	if err == nil {
+		if v, err := decodeJSON(b); err == nil {
+			if renamed, err := json.Marshal(renameKeys(v, camelToSnake)); err == nil {
+				b = renamed
+			}
+		}
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(b))
+	c.Request.ContentLength = int64(len(b))
+
+	c.Next()
+}
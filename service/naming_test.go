@@ -0,0 +1,52 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCamelToSnakeKeepsAcronymsTogether(t *testing.T) {
+	for in, want := range map[string]string{
+		"clientReferenceId": "client_reference_id",
+		"clientReferenceID": "client_reference_id",
+		"parentId":          "parent_id",
+		"HTTPStatus":        "http_status",
+		"email":             "email",
+		"client_reference":  "client_reference",
+	} {
+		if got := camelToSnake(in); got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestEitherNamingIsAcceptedAndRendered(t *testing.T) {
+	r := gin.New()
+	r.Use(JSONNaming)
+	r.POST("/echo", func(c *gin.Context) {
+		var customer Customer
+		if err := bindJSON(c, &customer); err != nil {
+			renderError(c, http.StatusBadRequest, err)
+			return
+		}
+		render(c, http.StatusOK, gin.H{"client_reference_id": customer.Reference, "parent_id": customer.ParentID})
+	})
+
+	for _, body := range []string{`{"clientReferenceId": "a-1", "parentId": 3}`, `{"client_reference_id": "a-1", "parent_id": 3}`} {
+		if got := request(r, http.MethodPost, "/echo", body).Body.String(); got != `{"client_reference_id":"a-1","parent_id":3}` {
+			t.Errorf("%s rendered in snake_case: %s", body, got)
+		}
+		got := request(r, http.MethodPost, "/echo", body, "Accept", "application/json; naming=camel").Body.String()
+		if got != `{"clientReferenceId":"a-1","parentId":3}` {
+			t.Errorf("%s rendered in camelCase: %s", body, got)
+		}
+	}
+
+	t.Setenv("JSON_NAMING", "camel")
+	got := request(r, http.MethodPost, "/echo", `{"client_reference_id": "a-1"}`, "Accept", "application/json; naming=snake").Body.String()
+	if got != `{"client_reference_id":"a-1","parent_id":null}` {
+		t.Errorf("naming=snake under JSON_NAMING=camel: %s", got)
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import "sync"
+
+// changeNotifier wakes goroutines waiting on a customer when it changes.
+// Notifications are local to this instance.
+type changeNotifier struct {
+	mu      sync.Mutex
+	waiters map[int]map[chan struct{}]struct{}
+}
+
+func newChangeNotifier() *changeNotifier {
+	return &changeNotifier{waiters: make(map[int]map[chan struct{}]struct{})}
+}
+
+// subscribe returns a channel closed on the next change to id and a cancel
+// func that must be called if the caller stops waiting first.
+func (n *changeNotifier) subscribe(id int) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+
+	n.mu.Lock()
+	if n.waiters[id] == nil {
+		n.waiters[id] = make(map[chan struct{}]struct{})
+	}
+	n.waiters[id][ch] = struct{}{}
+	n.mu.Unlock()
+
+	cancel := func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if _, ok := n.waiters[id][ch]; ok {
+			delete(n.waiters[id], ch)
+			if len(n.waiters[id]) == 0 {
+				delete(n.waiters, id)
+			}
+		}
+	}
+	return ch, cancel
+}
+
+func (n *changeNotifier) notify(ids ...int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, id := range ids {
+		for ch := range n.waiters[id] {
+			close(ch)
+		}
+		delete(n.waiters, id)
+	}
+}
@@ -0,0 +1,28 @@
+package service
+
+import "fmt"
+
+// pageState is everything needed to fetch a page of the list: the filters
+// in effect, the sort and the position. page_token carries it signed.
+type pageState struct {
+	Filters customerFilters `json:"f"`
+	Sort    string          `json:"s,omitempty"`
+	Limit   int             `json:"l"`
+	Offset  int             `json:"o"`
+	// Paged marks page/perPage style paging, reported back as such.
+	Paged bool `json:"p,omitempty"`
+}
+
+// encodePageToken signs state for use as ?page_token=.
+func encodePageToken(state *pageState) (string, error) {
+	return signToken("page", state)
+}
+
+// decodePageToken verifies and unpacks a token from encodePageToken.
+func decodePageToken(token string) (*pageState, error) {
+	var state pageState
+	if !openToken("page", token, &state) {
+		return nil, fmt.Errorf("invalid page_token")
+	}
+	return &state, nil
+}
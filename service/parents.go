@@ -0,0 +1,185 @@
+package service
+
+import (
+	"customer-service/db"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type parentRequest struct {
+	ParentID *int `json:"parent_id"`
+}
+
+// reparentOnDelete reports whether deleting a customer moves its children up
+// to its nearest ancestor that survives the delete (PARENT_DELETE=reparent).
+// By default a customer with children cannot be deleted.
+func reparentOnDelete() bool {
+	return os.Getenv("PARENT_DELETE") == "reparent"
+}
+
+// deleteStmt deletes the customers matching where and selects sel from the
+// deleted rows. Depending on config it also reparents their children and
+// records tombstones, all in one statement.
+func deleteStmt(where, sel string) string {
+	return deletingStmt(`DELETE FROM customers WHERE `+where+` RETURNING *`, sel)
+}
+
+// softDeleteStmt is deleteStmt for a soft delete: the matching customers
+// are kept with deleted_at set, still holding their email and
+// client_reference_id, so creating a customer with the same email is a
+// 409 until a sync brings the row back. Children are only moved with
+// PARENT_DELETE=reparent; otherwise checkNoChildren refuses the delete
+// afterwards.
+func softDeleteStmt(where, sel string) string {
+	return deletingStmt(`UPDATE customers SET deleted_at = now(), updated_at = now()
+	WHERE `+notDeleted+` AND `+where+` RETURNING *`, sel)
+}
+
+// deletingStmt wraps the statement removing the customers, which returns
+// their rows, with the reparenting and tombstones config asks for.
+// Children move to their nearest ancestor that is not deleted along
+// with their parent: lifted walks each deleted customer's ancestors
+// through the deleted ones.
+func deletingStmt(remove, sel string) string {
+	stmt := `WITH RECURSIVE deleted AS (` + remove + `)`
+	if reparentOnDelete() {
+		stmt += `,
+		lifted AS (
+		    SELECT id, parent_id FROM deleted
+		    UNION ALL
+		    SELECT l.id, d.parent_id FROM lifted l JOIN deleted d ON d.id = l.parent_id
+		),
+		reparented AS (
+		    UPDATE customers c SET parent_id = l.parent_id, updated_at = now()
+		    FROM lifted l WHERE c.parent_id = l.id AND c.id NOT IN (SELECT id FROM deleted)
+		    AND (l.parent_id IS NULL OR l.parent_id NOT IN (SELECT id FROM deleted))
+		)`
+	}
+	if tombstonesEnabled() {
+		stmt += `,
+		tombstoned AS (INSERT INTO customer_tombstones (customer_id) SELECT id FROM deleted ON CONFLICT DO NOTHING)`
+	}
+	return stmt + ` SELECT ` + sel + ` FROM deleted`
+}
+
+// deleteFailed maps a failed deleteStmt to a response status. The parent
+// link refuses to delete customers that still have children.
+func deleteFailed(err error) (int, error) {
+	if db.IsForeignKeyViolation(err) {
+		return http.StatusConflict, fmt.Errorf("customer has children; reassign or delete them first")
+	}
+	return http.StatusInternalServerError, err
+}
+
+// checkNoChildren refuses a soft delete of ids when a customer still has
+// children that are not among them.
+func checkNoChildren(tx *sqlx.Tx, ids []int) (int, error) {
+	var exists bool
+	err := tx.Get(&exists, `SELECT EXISTS (
+	    SELECT 1 FROM customers WHERE parent_id = ANY($1) AND NOT (id = ANY($1)) AND `+notDeleted+`)`, pq.Array(ids))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if exists {
+		return http.StatusConflict, fmt.Errorf("customer has children; reassign or delete them first")
+	}
+	return http.StatusOK, nil
+}
+
+// setParent links the customer to parent_id, or unlinks it when parent_id
+// is null. A customer cannot become its own ancestor.
+func setParent(db *db.PostgresDB, c *gin.Context) (int, *Customer, error) {
+	id, err := paramID(c)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	var req parentRequest
+	if err := bindJSON(c, &req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	tx, err := beginRequest(db, c)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	defer tx.Rollback()
+
+	if req.ParentID != nil {
+		if status, err := checkParent(tx, id, *req.ParentID); err != nil {
+			return status, nil, err
+		}
+	}
+
+	var customer Customer
+	stmt := `UPDATE customers SET parent_id = $1, updated_at = now()
+	WHERE id = $2 AND ` + notDeleted + ` AND parent_id IS DISTINCT FROM $1 RETURNING ` + customerColumns
+	err = tx.QueryRowx(stmt, req.ParentID, id).StructScan(&customer)
+	if err == sql.ErrNoRows {
+		return unchangedOrMissing(db, id, &customer)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, &customer, nil
+}
+
+// checkParent validates linking id under parentID. Hierarchy changes take a
+// transaction-scoped lock so two concurrent links cannot close a cycle that
+// neither would see alone.
+func checkParent(tx *sqlx.Tx, id, parentID int) (int, error) {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('customer-parents'))`); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	var exists bool
+	if err := tx.Get(&exists, `SELECT EXISTS (SELECT 1 FROM customers WHERE id = $1 AND `+notDeleted+`)`, parentID); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !exists {
+		return http.StatusBadRequest, fmt.Errorf("parent customer %d not found", parentID)
+	}
+
+	var cycle bool
+	err := tx.Get(&cycle, `WITH RECURSIVE ancestors (id) AS (
+	    SELECT $1::int
+	    UNION
+	    SELECT c.parent_id FROM customers c JOIN ancestors a ON c.id = a.id WHERE c.parent_id IS NOT NULL
+	)
+	SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)`, parentID, id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if cycle {
+		return http.StatusBadRequest, fmt.Errorf("customer %d cannot be its own ancestor", id)
+	}
+	return http.StatusOK, nil
+}
+
+// listChildren returns the customers directly under the customer.
+func listChildren(db *db.PostgresDB, c *gin.Context) (int, []Customer, error) {
+	id, err := paramID(c)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if _, err := fetchCustomer(db, id); err == sql.ErrNoRows {
+		return http.StatusNotFound, nil, err
+	} else if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	children := make([]Customer, 0)
+	if err := db.DB.Select(&children, `SELECT `+customerColumns+` FROM customers WHERE parent_id = $1 AND `+notDeleted+` ORDER BY id`, id); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, children, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParentLinksRejectCycles(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.PUT("/customers/:customerId/parent", a.ParentHandler)
+	r.GET("/customers/:customerId/children", a.ChildrenHandler)
+	ids := seedCustomers(t, a, 3, "alice")
+	link := func(child int, parent string) int {
+		t.Helper()
+		return request(r, http.MethodPut, fmt.Sprintf("/customers/%d/parent", child), `{"parent_id": `+parent+`}`).Code
+	}
+
+	// ids[2] is a child of ids[1], which is a child of ids[0].
+	if link(ids[1], fmt.Sprint(ids[0])) != http.StatusOK || link(ids[2], fmt.Sprint(ids[1])) != http.StatusOK {
+		t.Fatal("linking the chain failed")
+	}
+	children := listedIDs(listPage(t, r, fmt.Sprintf("/customers/%d/children", ids[0])))
+	if want := []int{ids[1]}; !reflect.DeepEqual(children, want) {
+		t.Errorf("children %v, want %v", children, want)
+	}
+
+	for name, parent := range map[string]int{
+		"itself":         ids[0],
+		"its child":      ids[1],
+		"its grandchild": ids[2],
+		"a missing one":  ids[2] + 1,
+	} {
+		if code := link(ids[0], fmt.Sprint(parent)); code != http.StatusBadRequest {
+			t.Errorf("parenting %d under %s: got %d, want 400", ids[0], name, code)
+		}
+	}
+	var parent *int
+	if err := a.db.DB.Get(&parent, `SELECT parent_id FROM customers WHERE id = $1`, ids[0]); err != nil || parent != nil {
+		t.Errorf("a rejected link left customer %d under %v", ids[0], parent)
+	}
+
+	if code := link(ids[2], "null"); code != http.StatusOK {
+		t.Errorf("unlinking: got %d, want 200", code)
+	}
+}
+
+func TestReparentingSkipsAncestorsDeletedAlongside(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	t.Setenv("PARENT_DELETE", "reparent")
+	t.Setenv("REQUIRE_CONFIRMATION", "false")
+	r := bulkRouter(a)
+	ids := seedCustomers(t, a, 4, "alice")
+	// ids[3] is a child of ids[2], a child of ids[1], a child of ids[0].
+	for i := 1; i < len(ids); i++ {
+		a.db.DB.MustExec(`UPDATE customers SET parent_id = $1 WHERE id = $2`, ids[i-1], ids[i])
+	}
+
+	body := fmt.Sprintf(`{"ids": [%d, %d]}`, ids[1], ids[2])
+	if w := request(r, http.MethodPost, "/customers/bulk-delete", body); w.Code != http.StatusOK {
+		t.Fatalf("deleting the middle of the chain: got %d: %s", w.Code, w.Body)
+	}
+	var parent *int
+	if err := a.db.DB.Get(&parent, `SELECT parent_id FROM customers WHERE id = $1`, ids[3]); err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil || *parent != ids[0] {
+		t.Errorf("customer %d is under %v, want its surviving grandparent %d", ids[3], parent, ids[0])
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+type partnerToken struct {
+	partner string
+	token   string
+}
+
+var (
+	partnerTokensOnce sync.Once
+	partnerTokens     []partnerToken
+)
+
+// configuredPartnerTokens reads PARTNER_TOKENS, a comma separated list of
+// partner:token pairs, on first use. Malformed entries are logged and
+// skipped.
+func configuredPartnerTokens() []partnerToken {
+	partnerTokensOnce.Do(func() {
+		for _, entry := range strings.Split(os.Getenv("PARTNER_TOKENS"), ",") {
+			entry = strings.TrimSpace(entry)
+			if len(entry) == 0 {
+				continue
+			}
+			partner, token, ok := strings.Cut(entry, ":")
+			if !ok || len(partner) == 0 || len(token) == 0 {
+				log.Printf("ignoring malformed PARTNER_TOKENS entry %q", entry)
+				continue
+			}
+			partnerTokens = append(partnerTokens, partnerToken{partner: partner, token: token})
+		}
+	})
+	return partnerTokens
+}
+
+// tokenPartner returns the partner whose token the request carries. Every
+// token is compared, in constant time, so the timing does not tell how
+// many partners there are or which one nearly matched.
+func tokenPartner(c *gin.Context) (string, bool) {
+	given := []byte(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	var partner string
+	for _, p := range configuredPartnerTokens() {
+		if subtle.ConstantTimeCompare(given, []byte(p.token)) == 1 {
+			partner = p.partner
+		}
+	}
+	return partner, len(partner) != 0
+}
+
+// partnerParams carry the ?partner= a request names.
+type partnerParams struct {
+	Partner string `form:"partner"`
+}
+
+// callerPartner resolves the partner a request acts for. A partner token
+// makes the caller that partner, and ?partner= may only repeat it. The
+// admin token can act for any partner named with ?partner=.
+func callerPartner(c *gin.Context, p partnerParams) (int, string, error) {
+	named := p.Partner
+	if isAdmin(c) {
+		if len(named) == 0 {
+			return http.StatusBadRequest, "", fmt.Errorf("partner cannot be empty")
+		}
+		return http.StatusOK, named, nil
+	}
+
+	partner, ok := tokenPartner(c)
+	if !ok {
+		return http.StatusUnauthorized, "", fmt.Errorf("a partner or admin token is required")
+	}
+	if len(named) != 0 && named != partner {
+		return http.StatusForbidden, "", fmt.Errorf("token does not belong to partner %q", named)
+	}
+	return http.StatusOK, partner, nil
+}
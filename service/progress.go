@@ -0,0 +1,108 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const progressKey = "progress"
+
+// progressSteps caps the progress events of one operation.
+const progressSteps = 100
+
+// progressFunc reports that processed of total records are done.
+type progressFunc func(processed, total int)
+
+// progressReporter returns the progress callback installed by
+// StreamProgress, or a no-op when the client did not ask for a stream.
+func progressReporter(c *gin.Context) progressFunc {
+	if fn, ok := c.Get(progressKey); ok {
+		return fn.(progressFunc)
+	}
+	return func(int, int) {}
+}
+
+func wantsEventStream(c *gin.Context) bool {
+	for _, accept := range strings.Split(c.GetHeader("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// capturedResponse holds the handler's response back so it can be sent as
+// the final event of the stream instead.
+type capturedResponse struct {
+	gin.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *capturedResponse) Header() http.Header         { return w.header }
+func (w *capturedResponse) WriteHeader(status int)      { w.status = status }
+func (w *capturedResponse) WriteHeaderNow()             {}
+func (w *capturedResponse) Write(b []byte) (int, error) { return w.body.Write(b) }
+func (w *capturedResponse) Status() int                 { return w.status }
+func (w *capturedResponse) Size() int                   { return w.body.Len() }
+func (w *capturedResponse) Written() bool               { return w.body.Len() > 0 }
+
+func (w *capturedResponse) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func writeEvent(w gin.ResponseWriter, event string, data interface{}) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	w.Flush()
+}
+
+// StreamProgress lets long batch operations answer "Accept:
+// text/event-stream" with server-sent events: "progress" events carrying
+// {"processed": N, "total": M} as records are handled, then one "result"
+// event with {"status": ..., "body": ...} holding the response the handler
+// would otherwise have sent. The stream itself is always a 200.
+func StreamProgress(c *gin.Context) {
+	if !wantsEventStream(c) {
+		c.Next()
+		return
+	}
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	last := 0
+	c.Set(progressKey, progressFunc(func(processed, total int) {
+		step := (total + progressSteps - 1) / progressSteps
+		if processed < total && processed-last < step {
+			return
+		}
+		last = processed
+		writeEvent(w, "progress", gin.H{"processed": processed, "total": total})
+	}))
+
+	captured := &capturedResponse{ResponseWriter: w, header: make(http.Header), status: http.StatusOK}
+	c.Writer = captured
+	c.Next()
+	c.Writer = w
+
+	body := json.RawMessage("null")
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, captured.body.Bytes()); err == nil && compact.Len() > 0 {
+		body = compact.Bytes()
+	}
+	writeEvent(w, "result", gin.H{"status": captured.status, "body": body})
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// progressRouter reports every one of total records, then answers 201.
+func progressRouter(total int) *gin.Engine {
+	r := gin.New()
+	r.POST("/batch", StreamProgress, func(c *gin.Context) {
+		progress := progressReporter(c)
+		for i := 1; i <= total; i++ {
+			progress(i, total)
+		}
+		render(c, http.StatusCreated, gin.H{"inserted": total})
+	})
+	return r
+}
+
+func TestProgressStreamCountsUpToTheResult(t *testing.T) {
+	w := request(progressRouter(250), http.MethodPost, "/batch", "", "Accept", "text/event-stream")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got %d %s, want a 200 event stream", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	events := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	last := 0
+	for _, event := range events[:len(events)-1] {
+		var progress struct{ Processed, Total int }
+		data := strings.TrimPrefix(event, "event: progress\ndata: ")
+		if data == event || json.Unmarshal([]byte(data), &progress) != nil {
+			t.Fatalf("malformed progress event %q", event)
+		}
+		if progress.Processed <= last || progress.Total != 250 {
+			t.Errorf("progress %d/%d after %d, want increasing counts of 250", progress.Processed, progress.Total, last)
+		}
+		last = progress.Processed
+	}
+	if last != 250 || len(events)-1 > progressSteps {
+		t.Errorf("%d progress events ending at %d, want at most %d ending at 250", len(events)-1, last, progressSteps)
+	}
+	if want := `event: result` + "\n" + `data: {"body":{"inserted":250},"status":201}`; events[len(events)-1] != want {
+		t.Errorf("final event %q, want %q", events[len(events)-1], want)
+	}
+}
+
+func TestProgressIsNotStreamedUnlessAsked(t *testing.T) {
+	w := request(progressRouter(3), http.MethodPost, "/batch", "")
+	if w.Code != http.StatusCreated || w.Body.String() != `{"inserted":3}` {
+		t.Errorf("got %d %s, want the plain 201", w.Code, w.Body)
+	}
+}
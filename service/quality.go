@@ -0,0 +1,63 @@
+package service
+
+import (
+	"customer-service/db"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// qualityFields lists the fields coverage is reported for, with the
+// aggregate counting customers that have a value.
+var qualityFields = []struct {
+	field string
+	count string
+}{
+	{"name", "COUNT(NULLIF(name, ''))"},
+	{"email", "COUNT(NULLIF(email, ''))"},
+	{"address", "COUNT(NULLIF(address, ''))"},
+	{"owner", "COUNT(NULLIF(owner, ''))"},
+	{"partner", "COUNT(NULLIF(partner, ''))"},
+	{"client_reference_id", "COUNT(NULLIF(client_reference_id, ''))"},
+	{"tags", "COUNT(*) FILTER (WHERE cardinality(tags) > 0)"},
+}
+
+type fieldCoverage struct {
+	Count   int     `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+type qualityReport struct {
+	Total  int                      `json:"total"`
+	Fields map[string]fieldCoverage `json:"fields"`
+}
+
+// customerQuality reports how many customers have each field populated,
+// computed in one aggregate pass over the table.
+func customerQuality(db *db.PostgresDB) (int, *qualityReport, error) {
+	counts := make([]string, 0, len(qualityFields)+1)
+	counts = append(counts, "COUNT(*)")
+	for _, f := range qualityFields {
+		counts = append(counts, f.count)
+	}
+
+	values := make([]int, len(counts))
+	dest := make([]interface{}, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := db.DB.QueryRow(`SELECT ` + strings.Join(counts, ", ") + ` FROM customers WHERE ` + notDeleted).Scan(dest...); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	report := &qualityReport{Total: values[0], Fields: make(map[string]fieldCoverage, len(qualityFields))}
+	for i, f := range qualityFields {
+		coverage := fieldCoverage{Count: values[i+1]}
+		if report.Total > 0 {
+			coverage.Percent = math.Round(float64(coverage.Count)*10000/float64(report.Total)) / 100
+		}
+		report.Fields[f.field] = coverage
+	}
+
+	return http.StatusOK, report, nil
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQualityReportsFieldCoverage(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.GET("/customers/quality", a.QualityHandler)
+	a.db.DB.MustExec(`INSERT INTO customers (name, email, address, tags) VALUES
+	    ('Ada', 'ada@example.com', '1 Main St', '{vip}'), ('Bob', 'bob@example.com', NULL, '{}'),
+	    (NULL, 'cy@example.com', '', '{}')`)
+	a.db.DB.MustExec(`INSERT INTO customers (name, email, address, deleted_at) VALUES ('Gone', 'gone@example.com', '2 Main St', now())`)
+
+	w := request(r, http.MethodGet, "/customers/quality", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var report qualityReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 3 {
+		t.Errorf("total %d, want the 3 customers not deleted", report.Total)
+	}
+	for field, want := range map[string]fieldCoverage{
+		"email":   {Count: 3, Percent: 100},
+		"name":    {Count: 2, Percent: 66.67},
+		"address": {Count: 1, Percent: 33.33},
+		"tags":    {Count: 1, Percent: 33.33},
+		"owner":   {Count: 0, Percent: 0},
+	} {
+		if got := report.Fields[field]; got != want {
+			t.Errorf("%s coverage %+v, want %+v", field, got, want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"customer-service/db"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// customerFilters narrows the customers a list or export covers. Saved
+// queries store it as JSON.
+type customerFilters struct {
+	Owner         string     `json:"owner,omitempty"`
+	NameContains  string     `json:"name_contains,omitempty"`
+	Tags          []string   `json:"tags,omitempty"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+}
+
+// where appends the filters to args and returns matching " AND ..." clauses.
+// A customer must carry every listed tag.
+func (f customerFilters) where(args []interface{}) (string, []interface{}) {
+	clauses := ""
+	if len(f.Owner) != 0 {
+		args = append(args, f.Owner)
+		clauses += fmt.Sprintf(" AND owner = $%d", len(args))
+	}
+	if len(f.NameContains) != 0 {
+		args = append(args, "%"+f.NameContains+"%")
+		clauses += fmt.Sprintf(" AND name ILIKE $%d", len(args))
+	}
+	if len(f.Tags) != 0 {
+		args = append(args, pq.Array(f.Tags))
+		clauses += fmt.Sprintf(" AND tags @> $%d", len(args))
+	}
+	if f.CreatedAfter != nil {
+		args = append(args, *f.CreatedAfter)
+		clauses += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if f.CreatedBefore != nil {
+		args = append(args, *f.CreatedBefore)
+		clauses += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	return clauses, args
+}
+
+func (f customerFilters) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+func (f *customerFilters) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into filters", src)
+	}
+	return json.Unmarshal(b, f)
+}
+
+// savedQuery is a named filter. Each belongs to the partner that saved it,
+// and names are unique per partner.
+type savedQuery struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Filters   customerFilters `json:"filters"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+
+	owner string
+}
+
+// savedQueryParams name a saved query by ?queryId= and the partner whose
+// query it is.
+type savedQueryParams struct {
+	QueryID *int `form:"queryId"`
+	partnerParams
+}
+
+func saveQuery(db *db.PostgresDB, c *gin.Context) (int, *savedQuery, error) {
+	var p partnerParams
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	status, partner, err := callerPartner(c, p)
+	if err != nil {
+		return status, nil, err
+	}
+	var query savedQuery
+	if err := bindJSON(c, &query); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if query.Name = strings.TrimSpace(query.Name); len(query.Name) == 0 {
+		return http.StatusBadRequest, nil, fmt.Errorf("name cannot be empty")
+	}
+	query.owner = partner
+
+	if status, err := insertQuery(db.DB, &query); err != nil {
+		return status, nil, err
+	}
+	return http.StatusCreated, &query, nil
+}
+
+func insertQuery(conn *sqlx.DB, query *savedQuery) (int, error) {
+	stmt := `INSERT INTO saved_queries (owner, name, filters) VALUES ($1, $2, $3) RETURNING id, name, filters, created_at`
+	err := conn.QueryRowx(stmt, query.owner, query.Name, query.Filters).StructScan(query)
+	if db.IsUniqueViolation(err) {
+		return http.StatusConflict, fmt.Errorf("a query named %q already exists", query.Name)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// fetchQuery loads one of owner's saved queries. Another partner's query is
+// reported as not found, so ids do not reveal which exist.
+func fetchQuery(db *db.PostgresDB, id int, owner string) (int, *savedQuery, error) {
+	var query savedQuery
+	err := db.DB.Get(&query, `SELECT id, name, filters, created_at FROM saved_queries WHERE id = $1 AND owner = $2`, id, owner)
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, nil, fmt.Errorf("saved query %d not found", id)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, &query, nil
+}
+
+func getQuery(db *db.PostgresDB, c *gin.Context) (int, *savedQuery, error) {
+	id, err := strconv.Atoi(c.Param("queryId"))
+	if err != nil {
+		return http.StatusBadRequest, nil, fmt.Errorf("invalid query id %q", c.Param("queryId"))
+	}
+	var p partnerParams
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	status, partner, err := callerPartner(c, p)
+	if err != nil {
+		return status, nil, err
+	}
+	return fetchQuery(db, id, partner)
+}
+
+// savedFilters loads the caller's saved query named by ?queryId=, or
+// returns nil filters when the parameter is absent.
+func savedFilters(db *db.PostgresDB, c *gin.Context, p savedQueryParams) (int, *customerFilters, error) {
+	if p.QueryID == nil {
+		return http.StatusOK, nil, nil
+	}
+	status, partner, err := callerPartner(c, p.partnerParams)
+	if err != nil {
+		return status, nil, err
+	}
+
+	status, query, err := fetchQuery(db, *p.QueryID, partner)
+	if status == http.StatusNotFound {
+		status = http.StatusBadRequest
+	}
+	if err != nil {
+		return status, nil, err
+	}
+	return http.StatusOK, &query.Filters, nil
+}
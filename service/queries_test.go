@@ -0,0 +1,84 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSavedQueryFiltersTheListAndExport(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	setPartnerTokens(t, "acme:acme-token")
+	r := exportRouter(a)
+	r.GET("/customers", a.ListHandler)
+	r.POST("/queries", a.QueryPostHandler)
+	r.GET("/queries/:queryId", a.QueryGetHandler)
+	alice := seedCustomers(t, a, 2, "alice")
+	a.db.DB.MustExec(`INSERT INTO customers (name, email, owner) VALUES ('Bob', 'bob@example.com', 'bob')`)
+	acme := []string{"Authorization", "Bearer acme-token"}
+
+	w := request(r, http.MethodPost, "/queries", `{"name": "alice's", "filters": {"owner": "alice"}}`, acme...)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("save: got %d: %s", w.Code, w.Body)
+	}
+	var query savedQuery
+	if err := json.Unmarshal(w.Body.Bytes(), &query); err != nil {
+		t.Fatal(err)
+	}
+	if w := request(r, http.MethodPost, "/queries", `{"name": "alice's"}`, acme...); w.Code != http.StatusConflict {
+		t.Errorf("saving the name again: got %d, want 409", w.Code)
+	}
+	if w := request(r, http.MethodGet, fmt.Sprintf("/queries/%d", query.ID), "", acme...); w.Code != http.StatusOK {
+		t.Errorf("fetching the query: got %d: %s", w.Code, w.Body)
+	}
+
+	list := listPage(t, r, fmt.Sprintf("/customers?queryId=%d", query.ID), acme...)
+	if got := listedIDs(list); !reflect.DeepEqual(got, alice) {
+		t.Errorf("listed %v, want alice's %v", got, alice)
+	}
+	job := awaitExport(t, r, fmt.Sprintf("/customers/exports?queryId=%d", query.ID), `{"format": "ndjson"}`, acme...)
+	if job.Status != exportDone || job.Rows != len(alice) {
+		t.Errorf("export finished %s with %d rows, want done with %d", job.Status, job.Rows, len(alice))
+	}
+
+	if w := request(r, http.MethodGet, fmt.Sprintf("/customers?queryId=%d", query.ID+1), "", acme...); w.Code != http.StatusBadRequest {
+		t.Errorf("listing an unknown query: got %d, want 400", w.Code)
+	}
+	if w := request(r, http.MethodGet, fmt.Sprintf("/customers?queryId=%d", query.ID), ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("listing a saved query without a token: got %d, want 401", w.Code)
+	}
+}
+
+func TestSavedQueriesBelongToTheirPartner(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	setPartnerTokens(t, "acme:acme-token,globex:globex-token")
+	r := gin.New()
+	r.GET("/customers", a.ListHandler)
+	r.POST("/queries", a.QueryPostHandler)
+	r.GET("/queries/:queryId", a.QueryGetHandler)
+	acme := []string{"Authorization", "Bearer acme-token"}
+	globex := []string{"Authorization", "Bearer globex-token"}
+
+	w := request(r, http.MethodPost, "/queries", `{"name": "vips", "filters": {"tags": ["vip"]}}`, acme...)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("save: got %d: %s", w.Code, w.Body)
+	}
+	var query savedQuery
+	if err := json.Unmarshal(w.Body.Bytes(), &query); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := request(r, http.MethodPost, "/queries", `{"name": "vips"}`, globex...); w.Code != http.StatusCreated {
+		t.Errorf("another partner saving the same name: got %d, want 201: %s", w.Code, w.Body)
+	}
+	if w := request(r, http.MethodGet, fmt.Sprintf("/queries/%d", query.ID), "", globex...); w.Code != http.StatusNotFound {
+		t.Errorf("another partner fetching the query: got %d, want 404", w.Code)
+	}
+	if w := request(r, http.MethodGet, fmt.Sprintf("/customers?queryId=%d", query.ID), "", globex...); w.Code != http.StatusBadRequest {
+		t.Errorf("another partner listing with the query: got %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// paramID parses the :customerId path parameter.
+func paramID(c *gin.Context) (int, error) {
+	return strconv.Atoi(c.Param("customerId"))
+}
+
+// The query helpers return def when the parameter is absent and a uniform
+// error, meant for a 400 response, when it is present but malformed.
+
+func queryParamError(name, raw, expected string) error {
+	return fmt.Errorf("invalid value %q for query parameter %s: expected %s", raw, name, expected)
+}
+
+func queryInt(c *gin.Context, name string, def int) (int, error) {
+	raw, ok := c.GetQuery(name)
+	if !ok {
+		return def, nil
+	}
+
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, queryParamError(name, raw, "an integer")
+	}
+	return v, nil
+}
+
+func queryFloat(c *gin.Context, name string, def float64) (float64, error) {
+	raw, ok := c.GetQuery(name)
+	if !ok {
+		return def, nil
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, queryParamError(name, raw, "a number")
+	}
+	return v, nil
+}
+
+func queryBool(c *gin.Context, name string, def bool) (bool, error) {
+	raw, ok := c.GetQuery(name)
+	if !ok {
+		return def, nil
+	}
+
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, queryParamError(name, raw, "true or false")
+	}
+	return v, nil
+}
+
+func queryDuration(c *gin.Context, name string, def time.Duration) (time.Duration, error) {
+	raw, ok := c.GetQuery(name)
+	if !ok {
+		return def, nil
+	}
+
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, queryParamError(name, raw, "a duration such as 30s")
+	}
+	return v, nil
+}
+
+func queryTime(c *gin.Context, name string, def time.Time) (time.Time, error) {
+	raw, ok := c.GetQuery(name)
+	if !ok {
+		return def, nil
+	}
+
+	v, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, queryParamError(name, raw, "an RFC 3339 timestamp")
+	}
+	return v, nil
+}
+
+// bindQuery fills the struct dst points to from the query parameters its
+// fields' form tags name, recursing into embedded structs. A field keeps
+// its value when the parameter is absent, so callers preset the defaults;
+// pointer fields are only set when the parameter is given. The tags are
+// also the route's known parameters for checkQueryNames.
+func bindQuery(c *gin.Context, dst interface{}) error {
+	v := reflect.ValueOf(dst).Elem()
+	if err := bindQueryFields(c, v); err != nil {
+		return err
+	}
+	return checkQueryNames(c, queryNames(v.Type()))
+}
+
+func bindQueryFields(c *gin.Context, v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, f := v.Field(i), v.Type().Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if err := bindQueryFields(c, field); err != nil {
+				return err
+			}
+			continue
+		}
+		name := f.Tag.Get("form")
+		if _, ok := c.GetQuery(name); len(name) == 0 || !ok {
+			continue
+		}
+		if field.Kind() == reflect.Ptr {
+			field.Set(reflect.New(field.Type().Elem()))
+			field = field.Elem()
+		}
+		if err := bindQueryValue(c, name, field.Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bindQueryValue(c *gin.Context, name string, dst interface{}) error {
+	var err error
+	switch dst := dst.(type) {
+	case *string:
+		*dst = c.Query(name)
+	case *int:
+		*dst, err = queryInt(c, name, *dst)
+	case *float64:
+		*dst, err = queryFloat(c, name, *dst)
+	case *bool:
+		*dst, err = queryBool(c, name, *dst)
+	case *time.Duration:
+		*dst, err = queryDuration(c, name, *dst)
+	case *time.Time:
+		*dst, err = queryTime(c, name, *dst)
+	default:
+		panic(fmt.Sprintf("bindQuery: query parameter %s has unsupported type %T", name, dst))
+	}
+	return err
+}
+
+// queryNames lists the query parameters bindQuery reads into t.
+func queryNames(t reflect.Type) []string {
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			names = append(names, queryNames(f.Type)...)
+		} else if name := f.Tag.Get("form"); len(name) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
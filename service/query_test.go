@@ -0,0 +1,58 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMalformedQueryParamsAreUniform400s(t *testing.T) {
+	r := gin.New()
+	r.GET("/", func(c *gin.Context) {
+		for _, parse := range []func() error{
+			func() error { _, err := queryInt(c, "limit", 10); return err },
+			func() error { _, err := queryFloat(c, "threshold", 0.5); return err },
+			func() error { _, err := queryBool(c, "merge", false); return err },
+			func() error { _, err := queryDuration(c, "timeout", time.Second); return err },
+			func() error { _, err := queryTime(c, "from", time.Time{}); return err },
+		} {
+			if err := parse(); err != nil {
+				renderError(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	for target, want := range map[string]string{
+		"/?limit=ten":       `invalid value "ten" for query parameter limit: expected an integer`,
+		"/?threshold=high":  `invalid value "high" for query parameter threshold: expected a number`,
+		"/?merge=yes":       `invalid value "yes" for query parameter merge: expected true or false`,
+		"/?timeout=5":       `invalid value "5" for query parameter timeout: expected a duration such as 30s`,
+		"/?from=2024-01-01": `invalid value "2024-01-01" for query parameter from: expected an RFC 3339 timestamp`,
+	} {
+		w := request(r, http.MethodGet, target, "")
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != http.StatusBadRequest || body.Error != want {
+			t.Errorf("%s: got %d %s, want 400 %q", target, w.Code, w.Body, want)
+		}
+	}
+
+	if w := request(r, http.MethodGet, "/?limit=5&threshold=0.9&merge=true&timeout=2s&from=2024-01-01T00:00:00Z", ""); w.Code != http.StatusNoContent {
+		t.Errorf("well formed params: got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestMalformedEndpointParamIs400(t *testing.T) {
+	r := gin.New()
+	r.GET("/customers/events/log", GetApp(nil).EventsHandler)
+	if w := request(r, http.MethodGet, "/customers/events/log?limit=lots", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want 400: %s", w.Code, w.Body)
+	}
+}
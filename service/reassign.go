@@ -0,0 +1,75 @@
+package service
+
+import (
+	"customer-service/db"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type reassignRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type reassignResult struct {
+	TransactionID string `json:"transaction_id"`
+	Reassigned    int    `json:"reassigned"`
+	IDs           []int  `json:"ids"`
+}
+
+func reassignCustomers(db *db.PostgresDB, c *gin.Context) (int, *reassignResult, error) {
+	var req reassignRequest
+	if err := bindJSON(c, &req); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	if len(req.From) == 0 || len(req.To) == 0 {
+		return http.StatusBadRequest, nil, fmt.Errorf("from and to cannot be empty")
+	}
+	if req.From == req.To {
+		return http.StatusBadRequest, nil, fmt.Errorf("from and to must differ")
+	}
+
+	detail, err := json.Marshal(req)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	txID, err := newRandomID()
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	tx, err := beginRequest(db, c)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	defer tx.Rollback()
+	if err := tagTransaction(tx, txID); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	ids := make([]int, 0)
+	stmt := `UPDATE customers SET owner = $1, updated_at = now() WHERE owner = $2 AND ` + notDeleted + ` RETURNING id`
+	if err := tx.Select(&ids, stmt, req.To, req.From); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	// Record one audit entry per customer so each ownership change is traceable.
+	auditStmt := `INSERT INTO customer_audit (customer_id, action, detail, actor) VALUES ($1, 'reassign', $2, $3)`
+	actor := resolveActor(c)
+	for _, id := range ids {
+		if _, err := tx.Exec(auditStmt, id, detail, actor); err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, &reassignResult{TransactionID: txID, Reassigned: len(ids), IDs: ids}, nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReassignRejectsMissingOrEqualOwners(t *testing.T) {
+	r := gin.New()
+	r.POST("/customers/reassign", GetApp(nil).ReassignHandler)
+
+	for _, body := range []string{`{"from": "alice"}`, `{"to": "bob"}`, `{"from": "alice", "to": "alice"}`} {
+		if w := request(r, http.MethodPost, "/customers/reassign", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", body, w.Code)
+		}
+	}
+}
+
+func TestReassignMovesEveryCustomerOfAnOwner(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.POST("/customers/reassign", a.ReassignHandler)
+	moved := seedCustomers(t, a, 2, "alice")
+	a.db.DB.MustExec(`INSERT INTO customers (name, email, owner) VALUES ('Carol', 'carol@example.com', 'carol')`)
+
+	w := request(r, http.MethodPost, "/customers/reassign", `{"from": "alice", "to": "bob"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var result reassignResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Reassigned != 2 {
+		t.Errorf("reassigned %d, want 2", result.Reassigned)
+	}
+
+	got := owners(t, a)
+	for _, id := range moved {
+		if got[id] != "bob" {
+			t.Errorf("customer %d is owned by %q, want bob", id, got[id])
+		}
+	}
+	var kept, audited int
+	a.db.DB.Get(&kept, `SELECT count(*) FROM customers WHERE owner = 'carol'`)
+	a.db.DB.Get(&audited, `SELECT count(*) FROM customer_audit WHERE action = 'reassign'`)
+	if kept != 1 || audited != 2 {
+		t.Errorf("%d customers still owned by carol and %d audit entries, want 1 and 2", kept, audited)
+	}
+}
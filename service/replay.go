@@ -0,0 +1,126 @@
+package service
+
+import (
+	"customer-service/db"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultReplayRate = 10
+
+type replayResult struct {
+	Event  string    `json:"event"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Queued int       `json:"queued"`
+}
+
+// replayRate reads WEBHOOK_REPLAY_RATE, the deliveries started per second.
+func replayRate() int {
+	v, err := strconv.Atoi(os.Getenv("WEBHOOK_REPLAY_RATE"))
+	if err != nil || v < 1 {
+		return defaultReplayRate
+	}
+	return v
+}
+
+// replayWebhooks delivers again the events logged in [from, to) to the
+// subscriber of that event, skipping those it was never sent. The create
+// hook, which receives customer.created, is the only subscriber, so that
+// is the only event that can be replayed. Deliveries carry the same Idempotency-Key and
+// X-Correlation-ID as the original and run one at a time in the background, starting at most
+// WEBHOOK_REPLAY_RATE per second, each retried like any create hook call.
+// Only one replay runs at a time; another is refused with 409 until it
+// finishes.
+func (a *App) replayWebhooks(c *gin.Context) (int, *replayResult, error) {
+	if _, ok := a.createHook.(noopCreateHook); ok {
+		return http.StatusConflict, nil, fmt.Errorf("no webhook subscriber is configured")
+	}
+
+	p := struct {
+		Event string    `form:"event"`
+		From  time.Time `form:"from"`
+		To    time.Time `form:"to"`
+	}{Event: "customer.created", To: time.Now()}
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	event, from, to := p.Event, p.From, p.To
+	if event != "customer.created" {
+		return http.StatusBadRequest, nil, fmt.Errorf("cannot replay %q: only customer.created has a subscriber", event)
+	}
+	if from.IsZero() {
+		return http.StatusBadRequest, nil, fmt.Errorf("from is required")
+	}
+	if !from.Before(to) {
+		return http.StatusBadRequest, nil, fmt.Errorf("from must be before to")
+	}
+
+	if !a.replaying.TryLock() {
+		return http.StatusConflict, nil, fmt.Errorf("a webhook replay is already running")
+	}
+	customers, err := loggedCustomers(a.db, event, from, to)
+	if err != nil {
+		a.replaying.Unlock()
+		return http.StatusInternalServerError, nil, err
+	}
+
+	go a.deliverPaced(customers)
+	return http.StatusAccepted, &replayResult{Event: event, From: from, To: to, Queued: len(customers)}, nil
+}
+
+// loggedCustomer is a logged payload with the id of the request that
+// caused it.
+type loggedCustomer struct {
+	Customer
+	correlation string
+}
+
+// replayedEvents keeps the events the create hook was sent: plain creates
+// and everything a sync created, including customers it brought back from
+// a soft delete. Restores, undos and other un-deletes never ran the hook.
+const replayedEvents = `((origin IS NULL AND previous IS NULL) OR origin = '` + originSync + `')`
+
+// loggedCustomers returns the payloads of the matching events in log order.
+func loggedCustomers(db *db.PostgresDB, event string, from, to time.Time) ([]loggedCustomer, error) {
+	var rows []struct {
+		Payload     json.RawMessage `db:"payload"`
+		Correlation string          `db:"correlation_id"`
+	}
+	stmt := `SELECT payload, COALESCE(correlation_id, '') AS correlation_id FROM customer_events
+		WHERE type = $1 AND created_at >= $2 AND created_at < $3 AND ` + replayedEvents + ` ORDER BY seq`
+	if err := db.DB.Select(&rows, stmt, event, from, to); err != nil {
+		return nil, err
+	}
+
+	customers := make([]loggedCustomer, 0, len(rows))
+	for _, row := range rows {
+		logged := loggedCustomer{correlation: row.Correlation}
+		if err := json.Unmarshal(row.Payload, &logged.Customer); err != nil {
+			return nil, err
+		}
+		customers = append(customers, logged)
+	}
+	return customers, nil
+}
+
+// deliverPaced delivers to the create hook serially, so a slow or failing
+// subscriber slows the replay down instead of piling up deliveries, and
+// releases the replay when done.
+func (a *App) deliverPaced(customers []loggedCustomer) {
+	defer a.replaying.Unlock()
+	tick := time.NewTicker(time.Second / time.Duration(replayRate()))
+	defer tick.Stop()
+	for _, logged := range customers {
+		<-tick.C
+		a.runCreateHook(logged.correlation, logged.Customer)
+	}
+	log.Printf("webhook replay delivered %d events", len(customers))
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReplayRedeliversTheWindowOneReplayAtATime(t *testing.T) {
+	pg := postgresDB(t)
+	t.Setenv("WEBHOOK_REPLAY_RATE", "1000")
+	a := GetApp(pg)
+	hook := make(recordingHook)
+	a.SetCreateHook(hook)
+	r := gin.New()
+	r.POST("/admin/webhooks/replay", a.ReplayHandler)
+
+	from := time.Now().Add(-time.Minute)
+	ids := seedCustomers(t, a, 3, "alice")
+	target := "/admin/webhooks/replay?from=" + url.QueryEscape(from.Format(time.RFC3339))
+
+	if w := request(r, http.MethodPost, target, ""); w.Code != http.StatusAccepted {
+		t.Fatalf("replay: %d %s", w.Code, w.Body)
+	}
+	// The hook blocks until it is read, so the first replay is still
+	// delivering its first event.
+	if w := request(r, http.MethodPost, target, ""); w.Code != http.StatusConflict {
+		t.Errorf("a second replay: got %d, want 409: %s", w.Code, w.Body)
+	}
+
+	for _, id := range ids {
+		if got := hook.nextCreated(t); got.ID != id {
+			t.Errorf("replayed customer %d, want %d in log order", got.ID, id)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := request(r, http.MethodPost, target+"&to="+url.QueryEscape(from.Add(time.Second).Format(time.RFC3339)), "")
+		if w.Code == http.StatusAccepted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("replays still refused after the first one finished: %d %s", w.Code, w.Body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplayOnlyResendsWhatTheHookWasSent(t *testing.T) {
+	pg := postgresDB(t)
+	a := GetApp(pg)
+	from := time.Now().Add(-time.Minute)
+	ids := seedCustomers(t, a, 3, "alice")
+	plain, undeleted, synced := ids[0], ids[1], ids[2]
+	withOrigin := func(origin, stmt string, args ...interface{}) {
+		t.Helper()
+		tx := pg.DB.MustBegin()
+		defer tx.Rollback()
+		if err := tagOrigin(tx, origin); err != nil {
+			t.Fatal(err)
+		}
+		tx.MustExec(stmt, args...)
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	withOrigin(originRestore, `INSERT INTO customers (name, email) VALUES ('Restored', 'restored@example.com')`)
+	pg.DB.MustExec(`UPDATE customers SET deleted_at = now() WHERE id IN ($1, $2)`, undeleted, synced)
+	pg.DB.MustExec(`UPDATE customers SET deleted_at = NULL WHERE id = $1`, undeleted)
+	withOrigin(originSync, `UPDATE customers SET deleted_at = NULL WHERE id = $1`, synced)
+
+	customers, err := loggedCustomers(pg, "customer.created", from, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]int, 0, len(customers))
+	for _, logged := range customers {
+		got = append(got, logged.ID)
+	}
+	if want := []int{plain, undeleted, synced, synced}; !reflect.DeepEqual(got, want) {
+		t.Errorf("replay covers %v, want %v: the creates and the sync's un-delete", got, want)
+	}
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Retry-After values by cause of backpressure.
+const (
+	unavailableRetryAfter  = 5 * time.Second
+	exportQueueRetryAfter  = 30 * time.Second
+	customerLockRetryAfter = time.Second
+)
+
+// backpressureKey marks a response that turned a request away on purpose,
+// which the breakers do not count as a failure.
+const backpressureKey = "backpressure"
+
+// retryableError marks a temporary failure with how long clients should
+// wait before retrying.
+type retryableError struct {
+	error
+	after time.Duration
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.error
+}
+
+func retryLater(err error, after time.Duration) error {
+	return &retryableError{error: err, after: after}
+}
+
+// setRetryAfter writes d as whole seconds, rounded up.
+func setRetryAfter(c *gin.Context, d time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+}
+
+// retryAfterFor picks the Retry-After of a 429 or 503: the error's own
+// value when it carries one, unavailableRetryAfter otherwise.
+func retryAfterFor(err error) time.Duration {
+	var re *retryableError
+	if errors.As(err, &re) {
+		return re.after
+	}
+	return unavailableRetryAfter
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"customer-service/db"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestEveryThrottlingPathSendsRetryAfter(t *testing.T) {
+	conn, err := sqlx.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("VACUUM_MIN_INTERVAL", "1m")
+
+	a := GetApp(&db.PostgresDB{DB: conn})
+	a.vacuum.last = time.Now()
+	r := gin.New()
+	r.Use(a.Bulkhead)
+	r.GET("/customers/:customerId", a.GetHandler)
+	r.PUT("/customers/:customerId", a.SerializeCustomer, a.PutHandler)
+	// No worker takes from this queue, so it is always full.
+	full := &App{db: a.db, exports: &exportStore{jobs: make(map[string]*exportJob), queue: make(chan *exportJob), ttl: time.Hour}}
+	r.POST("/customers/exports", full.ExportPostHandler)
+	r.POST("/admin/maintenance/vacuum", a.VacuumHandler)
+
+	check := func(name, method, target string, status int, retryAfter string) {
+		t.Helper()
+		w := request(r, method, target, "{}")
+		if w.Code != status || w.Header().Get("Retry-After") != retryAfter {
+			t.Errorf("%s: got %d with Retry-After %q, want %d with %q", name, w.Code, w.Header().Get("Retry-After"), status, retryAfter)
+		}
+	}
+
+	check("unavailable database", http.MethodGet, "/customers/1", http.StatusServiceUnavailable, "5")
+	check("full export queue", http.MethodPost, "/customers/exports", http.StatusServiceUnavailable, "30")
+	check("recent vacuum", http.MethodPost, "/admin/maintenance/vacuum", http.StatusTooManyRequests, "60")
+
+	unlock, err := a.locks.lock(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("busy customer", http.MethodPut, "/customers/1", http.StatusServiceUnavailable, "1")
+	unlock()
+
+	a.bulkheads[classRead].slots = make(chan struct{}, 1)
+	a.bulkheads[classRead].slots <- struct{}{}
+	check("full bulkhead", http.MethodGet, "/customers/1", http.StatusServiceUnavailable, "1")
+
+	a.bulkheads[classWrite].openUntil = time.Now().Add(10 * time.Second)
+	check("open breaker", http.MethodPut, "/customers/1", http.StatusServiceUnavailable, "10")
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSchemaMaxLengthIsTheEnforcedLimit(t *testing.T) {
+	t.Setenv("MAX_LENGTH_ADDRESS", "20")
+	customerSpecOnce, customerSpec = sync.Once{}, nil
+	t.Cleanup(func() { customerSpecOnce, customerSpec = sync.Once{}, nil })
+
+	a := GetApp(nil)
+	r := createRouter(a)
+	r.GET("/customers/schema", a.SchemaHandler)
+	w := request(r, http.MethodGet, "/customers/schema", "")
+	var schema struct {
+		Properties map[string]struct {
+			MaxLength int `json:"maxLength"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &schema); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("schema: %d %s", w.Code, w.Body)
+	}
+	limit := schema.Properties["address"].MaxLength
+	if limit != 20 {
+		t.Fatalf("schema publishes address maxLength %d, want 20", limit)
+	}
+	if got := schema.Properties["name"].MaxLength; got != columnLength {
+		t.Errorf("schema publishes name maxLength %d, want the column size %d", got, columnLength)
+	}
+
+	if err := validateFields(&Customer{Address: strings.Repeat("a", limit)}); err != nil {
+		t.Errorf("an address at the published limit was rejected: %v", err)
+	}
+	body := `{"email": "ada@example.com", "address": "` + strings.Repeat("a", limit+1) + `"}`
+	if w := request(r, http.MethodPost, "/customers", body); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("an address past the published limit: got %d, want 422: %s", w.Code, w.Body)
+	}
+}
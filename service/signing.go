@@ -0,0 +1,73 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	tokenKeyOnce sync.Once
+	tokenKey     []byte
+)
+
+// tokenSecret is TOKEN_SECRET, or PAGE_TOKEN_SECRET as it used to be
+// called, or a random key when neither is set, in which case tokens do not
+// survive a restart or work across instances.
+func tokenSecret() []byte {
+	tokenKeyOnce.Do(func() {
+		if secret := os.Getenv("TOKEN_SECRET"); len(secret) != 0 {
+			tokenKey = []byte(secret)
+			return
+		}
+		if secret := os.Getenv("PAGE_TOKEN_SECRET"); len(secret) != 0 {
+			log.Printf("PAGE_TOKEN_SECRET is deprecated; set TOKEN_SECRET instead")
+			tokenKey = []byte(secret)
+			return
+		}
+		tokenKey = make([]byte, 32)
+		if _, err := rand.Read(tokenKey); err != nil {
+			log.Fatalf("generating token key: %v", err)
+		}
+		log.Printf("TOKEN_SECRET is not set; signed tokens are only valid on this instance until it restarts")
+	})
+	return tokenKey
+}
+
+// sign MACs payload under purpose, so a token issued for one use is never
+// accepted for another.
+func sign(purpose, payload string) string {
+	mac := hmac.New(sha256.New, tokenSecret())
+	mac.Write([]byte(purpose + "." + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signToken renders v as "<payload>.<signature>", both base64url.
+func signToken(purpose string, v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + sign(purpose, payload), nil
+}
+
+// openToken verifies a token from signToken and unpacks it into v. It
+// reports false for a tampered or malformed token.
+func openToken(purpose, token string, v interface{}) bool {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(sign(purpose, payload))) {
+		return false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(b, v) == nil
+}
@@ -0,0 +1,17 @@
+package service
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestTokenSecretFallsBackToPageTokenSecret(t *testing.T) {
+	t.Setenv("TOKEN_SECRET", "")
+	t.Setenv("PAGE_TOKEN_SECRET", "old-secret")
+	tokenKeyOnce, tokenKey = sync.Once{}, nil
+	t.Cleanup(func() { tokenKeyOnce, tokenKey = sync.Once{}, nil })
+
+	if got := string(tokenSecret()); got != "old-secret" {
+		t.Errorf("got key %q, want PAGE_TOKEN_SECRET", got)
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// trigrams splits s into the padded three-rune shingles pg_trgm uses, so
+// scores line up with what similarity() would return in the database.
+func trigrams(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, w := range words {
+		runes := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			set[string(runes[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
+
+// similarity returns the trigram similarity of a and b in [0, 1].
+func similarity(a, b string) float64 {
+	return trigramSimilarity(trigrams(a), trigrams(b))
+}
+
+// trigramSimilarity is similarity for trigram sets already computed.
+func trigramSimilarity(ta, tb map[string]struct{}) float64 {
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for t := range ta {
+		if _, ok := tb[t]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+// similarPairs returns the pairs {i, j}, i < j, of sets that might be at
+// least threshold similar, a superset of those that are. With the trigrams
+// of every set ordered rarest first, two sets that similar always share
+// one of the first len - ceil(threshold*len) + 1 trigrams of each, so
+// only sets sharing such a prefix trigram are paired. Rare trigrams keep
+// the pairs few; the caller still scores each one.
+func similarPairs(sets []map[string]struct{}, threshold float64) [][2]int {
+	counts := make(map[string]int)
+	for _, set := range sets {
+		for t := range set {
+			counts[t]++
+		}
+	}
+
+	pairs := make([][2]int, 0)
+	index := make(map[string][]int)
+	for j, set := range sets {
+		if len(set) == 0 {
+			continue
+		}
+		ordered := make([]string, 0, len(set))
+		for t := range set {
+			ordered = append(ordered, t)
+		}
+		sort.Slice(ordered, func(a, b int) bool {
+			if counts[ordered[a]] != counts[ordered[b]] {
+				return counts[ordered[a]] < counts[ordered[b]]
+			}
+			return ordered[a] < ordered[b]
+		})
+
+		// Rounding down only lengthens the prefix, which never loses a pair.
+		prefix := len(ordered) - int(math.Ceil(threshold*float64(len(ordered))-1e-9)) + 1
+		if prefix > len(ordered) {
+			prefix = len(ordered)
+		}
+		seen := make(map[int]bool)
+		for _, t := range ordered[:prefix] {
+			for _, i := range index[t] {
+				if !seen[i] {
+					seen[i] = true
+					pairs = append(pairs, [2]int{i, j})
+				}
+			}
+			index[t] = append(index[t], j)
+		}
+	}
+	return pairs
+}
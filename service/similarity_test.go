@@ -0,0 +1,40 @@
+package service
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSimilarPairsFindsEveryPairAtTheThreshold(t *testing.T) {
+	words := []string{"ada", "adah", "lovelace", "lovelance", "bob", "bobby", "stone", "stones", "carol", "king", "kings", "o'neil"}
+	rng := rand.New(rand.NewSource(1))
+	sets := make([]map[string]struct{}, 300)
+	for i := range sets {
+		name := ""
+		for n := rng.Intn(3); n >= 0; n-- {
+			name += words[rng.Intn(len(words))] + " "
+		}
+		sets[i] = trigrams(name)
+	}
+
+	for _, threshold := range []float64{0.3, 0.5, 0.8, 1} {
+		found := make(map[[2]int]bool)
+		for _, pair := range similarPairs(sets, threshold) {
+			if pair[0] >= pair[1] || found[pair] {
+				t.Fatalf("threshold %v: pair %v is out of order or repeated", threshold, pair)
+			}
+			found[pair] = true
+		}
+		for i := range sets {
+			for j := i + 1; j < len(sets); j++ {
+				if trigramSimilarity(sets[i], sets[j]) >= threshold && !found[[2]int{i, j}] {
+					t.Fatalf("threshold %v: sets %d and %d are %v similar but were not paired",
+						threshold, i, j, trigramSimilarity(sets[i], sets[j]))
+				}
+			}
+		}
+		if len(found) == len(sets)*(len(sets)-1)/2 {
+			t.Errorf("threshold %v paired every set with every other", threshold)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"customer-service/db"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type restoreResult struct {
+	Restored int `json:"restored"`
+}
+
+// snapshotCustomers queues an unfiltered NDJSON export of every customer,
+// soft-deleted ones included, which restoreCustomers can load back in.
+func (s *exportStore) snapshotCustomers() (int, *exportJob, error) {
+	return s.add(exportRequest{Format: "ndjson", withDeleted: true})
+}
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// restoreCustomers loads an NDJSON snapshot, keeping the original ids and
+// timestamps. It refuses a non-empty table unless ?force=true, in which case
+// the existing customers are replaced. Everything runs in one transaction.
+func restoreCustomers(db *db.PostgresDB, c *gin.Context) (int, *restoreResult, error) {
+	var p struct {
+		Force bool `form:"force"`
+	}
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	force := p.Force
+
+	tx, err := beginRequest(db, c)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	defer tx.Rollback()
+	if err := tagOrigin(tx, originRestore); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	if _, err := tx.Exec(`LOCK TABLE customers IN EXCLUSIVE MODE`); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	var existing bool
+	if err := tx.Get(&existing, `SELECT EXISTS (SELECT 1 FROM customers)`); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if existing {
+		if !force {
+			return http.StatusConflict, nil, fmt.Errorf("customers table is not empty; pass force=true to replace it")
+		}
+		if _, err := tx.Exec(`DELETE FROM customers`); err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+	}
+
+	// Parents may come after their children in the snapshot; the links are
+	// checked once everything is in, at commit.
+	if _, err := tx.Exec(`SET CONSTRAINTS customers_parent_id_fkey DEFERRED`); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	stmt := `INSERT INTO customers (id, name, email, address, owner, partner, client_reference_id, tags, parent_id, lat, lng, created_at, updated_at, deleted_at)
+	VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10, $11, COALESCE($12, now()), COALESCE($13, now()), $14)`
+	result := &restoreResult{}
+	dec := json.NewDecoder(c.Request.Body)
+	for {
+		var customer Customer
+		err := dec.Decode(&customer)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return http.StatusBadRequest, nil, fmt.Errorf("line %d: %w", result.Restored+1, err)
+		}
+
+		tags := customer.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		_, err = tx.Exec(stmt, customer.ID, customer.Name, customer.Email, customer.Address, customer.Owner,
+			customer.Partner, customer.Reference, tags, customer.ParentID, customer.Lat, customer.Lng, nullTime(customer.CreatedAt), nullTime(customer.UpdatedAt), customer.DeletedAt)
+		if err != nil {
+			return http.StatusInternalServerError, nil, fmt.Errorf("line %d: %w", result.Restored+1, err)
+		}
+		result.Restored++
+	}
+
+	// Move the id sequence past the restored ids so new customers do not collide.
+	_, err = tx.Exec(`SELECT setval(pg_get_serial_sequence('customers', 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM customers`)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	if status, err := commitRestore(tx); err != nil {
+		return status, nil, err
+	}
+	return http.StatusOK, result, nil
+}
+
+// commitRestore commits, which is when the deferred parent links are checked.
+func commitRestore(tx *sqlx.Tx) (int, error) {
+	err := tx.Commit()
+	if db.IsForeignKeyViolation(err) {
+		return http.StatusBadRequest, fmt.Errorf("snapshot references a parent it does not contain: %w", err)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
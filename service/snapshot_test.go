@@ -0,0 +1,66 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotRestoresTheCustomersItTook(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := exportRouter(a)
+	r.POST("/admin/customers/snapshot", a.SnapshotHandler)
+	r.POST("/admin/customers/restore", a.RestoreHandler)
+	seedCustomers(t, a, 3, "alice")
+	a.db.DB.MustExec(`UPDATE customers SET deleted_at = now() WHERE email = 'c1@example.com'`)
+	var before []Customer
+	if err := a.db.DB.Select(&before, `SELECT `+customerColumns+` FROM customers ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+
+	job := awaitExport(t, r, "/admin/customers/snapshot", "")
+	if job.Status != exportDone || job.Rows != 3 {
+		t.Fatalf("snapshot finished %s with %d rows (%s), want done with all 3", job.Status, job.Rows, job.Error)
+	}
+	snapshot := request(r, http.MethodGet, job.DownloadURL, "").Body.String()
+
+	a.db.DB.MustExec(`INSERT INTO customers (name, email) VALUES ('Later', 'later@example.com')`)
+	if w := request(r, http.MethodPost, "/admin/customers/restore", snapshot); w.Code != http.StatusConflict {
+		t.Fatalf("restore over existing customers: got %d, want 409", w.Code)
+	}
+
+	w := request(r, http.MethodPost, "/admin/customers/restore?force=true", snapshot)
+	if w.Code != http.StatusOK {
+		t.Fatalf("forced restore: got %d: %s", w.Code, w.Body)
+	}
+	var result restoreResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || result.Restored != 3 {
+		t.Fatalf("restored %s, want 3", w.Body)
+	}
+	var after []Customer
+	if err := a.db.DB.Select(&after, `SELECT `+customerColumns+` FROM customers ORDER BY id`); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("restored customers:\n%+v\nwant\n%+v", after, before)
+	}
+}
+
+func TestRestoreRejectsMalformedSnapshots(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := exportRouter(a)
+	r.POST("/admin/customers/restore", a.RestoreHandler)
+
+	for _, snapshot := range []string{
+		`{"id": 1, "name": "Ada"` + "\n",
+		`{"id": 2, "name": "Child", "email": "child@example.com", "parent_id": 99}` + "\n",
+	} {
+		if w := request(r, http.MethodPost, "/admin/customers/restore", snapshot); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400: %s", snapshot, w.Code, w.Body)
+		}
+	}
+	if len(owners(t, a)) != 0 {
+		t.Errorf("a rejected restore left customers behind")
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// globalParams are accepted on every route.
+var globalParams = []string{"pretty", "tz"}
+
+// levenshtein is the edit distance between a and b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// suggest returns the allowed parameter closest to name, if any is close
+// enough to be a plausible typo.
+func suggest(name string, allowed []string) string {
+	best, bestDist := "", 3
+	for _, a := range allowed {
+		if d := levenshtein(strings.ToLower(name), strings.ToLower(a)); d < bestDist {
+			best, bestDist = a, d
+		}
+	}
+	return best
+}
+
+// strictQueryParams reports whether unknown query parameters are rejected
+// with 400. By default they only earn a Warning header.
+func strictQueryParams() bool {
+	return os.Getenv("STRICT_QUERY_PARAMS") == "true"
+}
+
+// unknownParamsError lists the query parameters a route does not read,
+// with the closest known one for each that looks like a typo.
+type unknownParamsError struct {
+	Unknown     []string
+	Suggestions map[string]string
+}
+
+func (e *unknownParamsError) Error() string {
+	messages := make([]string, 0, len(e.Unknown))
+	for _, name := range e.Unknown {
+		msg := fmt.Sprintf("unknown query parameter %q", name)
+		if s, ok := e.Suggestions[name]; ok {
+			msg += fmt.Sprintf(", did you mean %q?", s)
+		}
+		messages = append(messages, msg)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// checkQueryNames looks for query parameters outside allowed and the
+// global ones, so a typo does not go unnoticed. With
+// STRICT_QUERY_PARAMS=true they are an error; otherwise the response
+// carries a Warning naming them and the request goes ahead.
+func checkQueryNames(c *gin.Context, allowed []string) error {
+	allowed = append(append(make([]string, 0, len(allowed)+len(globalParams)), allowed...), globalParams...)
+	known := make(map[string]bool, len(allowed))
+	for _, a := range allowed {
+		known[a] = true
+	}
+
+	e := &unknownParamsError{Unknown: make([]string, 0), Suggestions: map[string]string{}}
+	for name := range c.Request.URL.Query() {
+		if !known[name] {
+			e.Unknown = append(e.Unknown, name)
+		}
+	}
+	if len(e.Unknown) == 0 {
+		return nil
+	}
+	sort.Strings(e.Unknown)
+	for _, name := range e.Unknown {
+		if s := suggest(name, allowed); len(s) != 0 {
+			e.Suggestions[name] = s
+		}
+	}
+
+	if strictQueryParams() {
+		return e
+	}
+	c.Header("Warning", "299 - "+strconv.Quote(e.Error()))
+	return nil
+}
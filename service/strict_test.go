@@ -0,0 +1,78 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func strictRouter() *gin.Engine {
+	r := gin.New()
+	r.GET("/customers", func(c *gin.Context) {
+		var p pageParams
+		if err := bindQuery(c, &p); err != nil {
+			renderError(c, http.StatusBadRequest, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	return r
+}
+
+func TestMisspelledQueryParamGetsASuggestion(t *testing.T) {
+	t.Setenv("STRICT_QUERY_PARAMS", "true")
+	w := request(strictRouter(), http.MethodGet, "/customers?offsett=10&limit=5", "")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400", w.Code)
+	}
+	var body struct {
+		Error       string            `json:"error"`
+		Unknown     []string          `json:"unknown"`
+		Suggestions map[string]string `json:"suggestions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if want := `unknown query parameter "offsett", did you mean "offset"?`; body.Error != want {
+		t.Errorf("error %q, want %q", body.Error, want)
+	}
+	if !reflect.DeepEqual(body.Unknown, []string{"offsett"}) || body.Suggestions["offsett"] != "offset" {
+		t.Errorf("unknown %v with suggestions %v, want offsett corrected to offset", body.Unknown, body.Suggestions)
+	}
+}
+
+func TestKnownQueryParamsPassStrictQuery(t *testing.T) {
+	t.Setenv("STRICT_QUERY_PARAMS", "true")
+	if w := request(strictRouter(), http.MethodGet, "/customers?offset=10&limit=5&pretty=true", ""); w.Code != http.StatusNoContent {
+		t.Errorf("got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestUnknownQueryParamsOnlyWarnByDefault(t *testing.T) {
+	t.Setenv("STRICT_QUERY_PARAMS", "")
+	w := request(strictRouter(), http.MethodGet, "/customers?offsett=10", "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("got %d, want the request to go ahead: %s", w.Code, w.Body)
+	}
+	if warning := w.Header().Get("Warning"); !strings.HasPrefix(warning, "299 - ") || !strings.Contains(warning, `did you mean \"offset\"?`) {
+		t.Errorf("Warning %q, want a 299 suggesting offset", warning)
+	}
+}
+
+func TestHandlersAcceptTheParamsTheyBind(t *testing.T) {
+	t.Setenv("STRICT_QUERY_PARAMS", "true")
+	r := gin.New()
+	r.GET("/customers/events/log", GetApp(nil).EventsHandler)
+	w := request(r, http.MethodGet, "/customers/events/log?afterSeq=-1&schemaVersoin=2", "")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `did you mean \"schemaVersion\"?`) {
+		t.Errorf("got %d %s, want 400 suggesting schemaVersion", w.Code, w.Body)
+	}
+	w = request(r, http.MethodGet, "/customers/events/log?afterSeq=-1&schemaVersion=2", "")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "afterSeq cannot be negative") {
+		t.Errorf("known params: got %d %s, want them bound and afterSeq rejected", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,387 @@
+package service
+
+import (
+	"customer-service/db"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	syncInserted  = "inserted"
+	syncUpdated   = "updated"
+	syncUnchanged = "unchanged"
+	syncDeleted   = "deleted"
+	syncInvalid   = "skipped_invalid"
+	syncConflict  = "skipped_conflict"
+)
+
+type syncRecord struct {
+	Index     *int   `json:"index,omitempty"`
+	Reference string `json:"client_reference_id,omitempty"`
+	Email     string `json:"email,omitempty"`
+	ID        int    `json:"id,omitempty"`
+	Outcome   string `json:"outcome"`
+	Error     string `json:"error,omitempty"`
+}
+
+type syncResult struct {
+	TransactionID string       `json:"transaction_id,omitempty"`
+	Inserted      int          `json:"inserted"`
+	Updated       int          `json:"updated"`
+	Unchanged     int          `json:"unchanged"`
+	Deleted       int          `json:"deleted"`
+	Skipped       int          `json:"skipped"`
+	Records       []syncRecord `json:"records"`
+
+	// A preview reports what a sync with delete would do without doing it,
+	// and the token that confirms it.
+	Preview             bool       `json:"preview,omitempty"`
+	ConfirmationToken   string     `json:"confirmation_token,omitempty"`
+	ConfirmationExpires *time.Time `json:"confirmation_expires_at,omitempty"`
+
+	changed []int
+	created []Customer
+}
+
+func (r *syncResult) add(record syncRecord) {
+	switch record.Outcome {
+	case syncInserted:
+		r.Inserted++
+	case syncUpdated:
+		r.Updated++
+	case syncUnchanged:
+		r.Unchanged++
+	case syncDeleted:
+		r.Deleted++
+	default:
+		r.Skipped++
+	}
+	if record.ID != 0 && record.Outcome != syncUnchanged {
+		r.changed = append(r.changed, record.ID)
+	}
+	r.Records = append(r.Records, record)
+}
+
+// syncKey is a column sync can match records on. Its upsert's conditional
+// DO UPDATE returns no row when nothing differs, and xmax = 0 only holds for
+// freshly inserted rows. A soft-deleted match is always brought back, which
+// counts as an insert; prior reads it as it was before the statement.
+type syncKey struct {
+	columns []string
+	upsert  string
+	value   func(*Customer) string
+
+	// scoped keys include partner, so a conflicting row is always the
+	// partner's own. Otherwise a matching row may belong to another partner.
+	scoped bool
+}
+
+var syncKeys = map[string]syncKey{
+	"client_reference_id": {
+		columns: []string{"partner", "client_reference_id"},
+		scoped:  true,
+		value:   func(c *Customer) string { return c.Reference },
+		upsert: `WITH prior AS (SELECT deleted_at FROM customers WHERE partner = $1 AND client_reference_id = $2)
+		INSERT INTO customers (partner, client_reference_id, name, email, address, owner)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (partner, client_reference_id) DO UPDATE
+		SET name = EXCLUDED.name, email = EXCLUDED.email, address = EXCLUDED.address, owner = EXCLUDED.owner,
+		    deleted_at = NULL, updated_at = now()
+		WHERE customers.deleted_at IS NOT NULL
+		    OR (customers.name, customers.email, customers.address, customers.owner)
+		    IS DISTINCT FROM (EXCLUDED.name, EXCLUDED.email, EXCLUDED.address, EXCLUDED.owner)
+		RETURNING ` + customerColumns + `, xmax = 0 OR EXISTS (SELECT 1 FROM prior WHERE deleted_at IS NOT NULL) AS inserted`,
+	},
+	"email": {
+		columns: []string{"email"},
+		value:   func(c *Customer) string { return c.Email },
+		upsert: `WITH prior AS (SELECT deleted_at FROM customers WHERE email = $4)
+		INSERT INTO customers (partner, client_reference_id, name, email, address, owner)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6)
+		ON CONFLICT (email) DO UPDATE
+		SET name = EXCLUDED.name, address = EXCLUDED.address, owner = EXCLUDED.owner, deleted_at = NULL, updated_at = now(),
+		    client_reference_id = COALESCE(EXCLUDED.client_reference_id, customers.client_reference_id)
+		WHERE customers.partner = EXCLUDED.partner
+		    AND (customers.deleted_at IS NOT NULL
+		    OR (customers.name, customers.address, customers.owner, customers.client_reference_id)
+		    IS DISTINCT FROM (EXCLUDED.name, EXCLUDED.address, EXCLUDED.owner,
+		        COALESCE(EXCLUDED.client_reference_id, customers.client_reference_id)))
+		RETURNING ` + customerColumns + `, xmax = 0 OR EXISTS (SELECT 1 FROM prior WHERE deleted_at IS NOT NULL) AS inserted`,
+	},
+}
+
+// field is the customer field the key is matched on.
+func (k syncKey) field() string {
+	return k.columns[len(k.columns)-1]
+}
+
+// checkUniqueKey confirms a unique index on exactly the key's columns
+// exists, since ON CONFLICT cannot target anything else.
+func checkUniqueKey(tx *sqlx.Tx, key syncKey) error {
+	var exists bool
+	err := tx.Get(&exists, `SELECT EXISTS (
+	    SELECT 1 FROM pg_index i
+	    WHERE i.indrelid = 'customers'::regclass AND i.indisunique
+	    AND ARRAY(
+	        SELECT a.attname::text
+	        FROM unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord)
+	        JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+	        ORDER BY k.ord
+	    ) = $1
+	)`, pq.Array(key.columns))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%s has no unique constraint to upsert on", key.field())
+	}
+	return nil
+}
+
+// validateSyncRecord checks one record of the payload; seen tracks the key
+// values of earlier records.
+func validateSyncRecord(customer *Customer, key syncKey, seen map[string]bool) error {
+	field, v := key.field(), key.value(customer)
+	if len(v) == 0 {
+		return invalid(field, codeRequired, "%s cannot be empty", field)
+	}
+	if seen[v] {
+		return invalid(field, codeDuplicate, "duplicate %s %q", field, v)
+	}
+	seen[v] = true
+
+	if err := validateCustomer(customer); err != nil {
+		return err
+	}
+	return validateFields(customer)
+}
+
+// applySyncRecord upserts one validated record and fills in its outcome,
+// returning the customer when it was inserted. A savepoint per record lets
+// a conflicting row be skipped without aborting the records applied before
+// it; only unexpected errors are returned.
+func applySyncRecord(tx *sqlx.Tx, key syncKey, partner string, customer Customer, record *syncRecord) (*Customer, error) {
+	if _, err := tx.Exec(`SAVEPOINT sync_record`); err != nil {
+		return nil, err
+	}
+
+	var row struct {
+		Customer
+		Inserted bool `db:"inserted"`
+	}
+	var created *Customer
+	err := tx.QueryRowx(key.upsert, partner, customer.Reference, customer.Name, customer.Email, customer.Address, customer.Owner).StructScan(&row)
+	switch {
+	case err == sql.ErrNoRows && !key.scoped:
+		var owner string
+		if err := tx.Get(&owner, `SELECT partner FROM customers WHERE email = $1`, customer.Email); err != nil {
+			return nil, err
+		}
+		record.Outcome = syncUnchanged
+		if owner != partner {
+			record.Outcome = syncConflict
+			record.Error = fmt.Sprintf("%s %q belongs to another partner", key.field(), key.value(&customer))
+		}
+	case err == sql.ErrNoRows:
+		record.Outcome = syncUnchanged
+	case err == nil:
+		record.ID = row.ID
+		record.Outcome = syncUpdated
+		if row.Inserted {
+			// A customer brought back is no longer gone.
+			record.Outcome = syncInserted
+			created = &row.Customer
+			if _, err := tx.Exec(`DELETE FROM customer_tombstones WHERE customer_id = $1`, row.ID); err != nil {
+				return nil, err
+			}
+		}
+	case db.IsUniqueViolation(err):
+		if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT sync_record`); err != nil {
+			return nil, err
+		}
+		record.Outcome = syncConflict
+		record.Error = err.Error()
+		return nil, nil
+	default:
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`RELEASE SAVEPOINT sync_record`); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// syncCustomers converges a partner's customers to the posted dataset. Each
+// valid record is upserted by client_reference_id, or by email with
+// ?onConflict=email; with ?delete=true, the partner's customers whose key is
+// missing from the payload are soft-deleted too, and a later sync that
+// lists them again brings them back. Invalid or conflicting records are
+// skipped and reported while the rest are applied in one transaction. The
+// partner comes from the caller's token, see callerPartner.
+//
+// Deleting needs confirmation: without ?confirm= the sync only runs as a
+// preview and is rolled back, returning a token. Repeating the same request
+// with ?confirm=<token>&expectedCount=<deleted> applies it, unless the
+// number of customers it would delete has changed, which aborts with 409.
+func syncCustomers(db *db.PostgresDB, c *gin.Context) (int, *syncResult, error) {
+	p := struct {
+		partnerParams
+		confirmParams
+		Delete     bool   `form:"delete"`
+		OnConflict string `form:"onConflict"`
+	}{OnConflict: "client_reference_id"}
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	status, partner, err := callerPartner(c, p.partnerParams)
+	if err != nil {
+		return status, nil, err
+	}
+	deleteMissing := p.Delete
+	key, ok := syncKeys[p.OnConflict]
+	if !ok {
+		return http.StatusBadRequest, nil, fmt.Errorf("onConflict must be client_reference_id or email")
+	}
+
+	confirm := deleteMissing && confirmationRequired()
+	scope := partner + "/" + key.field()
+	var hash string
+	expected := -1
+	if confirm {
+		if hash, err = bodyHash(c); err != nil {
+			return http.StatusBadRequest, nil, err
+		}
+		if p.Confirm != nil {
+			status, n, err := checkConfirmation(p.confirmParams, "sync-delete", scope, hash)
+			if err != nil {
+				return status, nil, err
+			}
+			expected = n
+		}
+	}
+
+	var customers []Customer
+	if err := bindJSON(c, &customers); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	txID, err := newRandomID()
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	tx, err := beginRequest(db, c)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	defer tx.Rollback()
+	if err := tagTransaction(tx, txID); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if err := tagOrigin(tx, originSync); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	if err := checkUniqueKey(tx, key); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+
+	result := &syncResult{TransactionID: txID, Records: make([]syncRecord, 0, len(customers)), changed: make([]int, 0)}
+	progress := progressReporter(c)
+
+	// Every key in the payload counts as present, even on a skipped record,
+	// so a bad update never deletes the partner's customer.
+	present := make([]string, 0, len(customers))
+	seen := make(map[string]bool)
+	for i, customer := range customers {
+		index := i
+		record := syncRecord{Index: &index, Reference: customer.Reference}
+		if !key.scoped {
+			record.Email = customer.Email
+		}
+		if v := key.value(&customer); len(v) != 0 {
+			present = append(present, v)
+		}
+
+		if err := validateSyncRecord(&customer, key, seen); err != nil {
+			record.Outcome = syncInvalid
+			record.Error = err.Error()
+			result.add(record)
+			progress(i+1, len(customers))
+			continue
+		}
+
+		created, err := applySyncRecord(tx, key, partner, customer, &record)
+		if err != nil {
+			return http.StatusInternalServerError, nil, fmt.Errorf("customer %d: %w", i, err)
+		}
+		if created != nil {
+			result.created = append(result.created, *created)
+		}
+		result.add(record)
+		progress(i+1, len(customers))
+	}
+
+	if deleteMissing {
+		column := key.field()
+		where := `partner = $1 AND ` + column + ` IS NOT NULL AND NOT (` + column + ` = ANY($2))`
+		sel := `id, COALESCE(client_reference_id, '') AS client_reference_id, COALESCE(email, '') AS email`
+		stmt := softDeleteStmt(where, sel)
+		// A preview only reads which customers would go, so it locks none
+		// of them however many there are.
+		if confirm && expected < 0 {
+			stmt = `SELECT ` + sel + ` FROM customers WHERE ` + notDeleted + ` AND ` + where
+		}
+
+		var deleted []struct {
+			ID        int    `db:"id"`
+			Reference string `db:"client_reference_id"`
+			Email     string `db:"email"`
+		}
+		if err := tx.Select(&deleted, stmt, partner, pq.Array(present)); err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+		ids := make([]int, 0, len(deleted))
+		for _, d := range deleted {
+			ids = append(ids, d.ID)
+		}
+		if !reparentOnDelete() {
+			if status, err := checkNoChildren(tx, ids); err != nil {
+				return status, nil, err
+			}
+		}
+		for _, d := range deleted {
+			record := syncRecord{Reference: d.Reference, ID: d.ID, Outcome: syncDeleted}
+			if !key.scoped {
+				record.Email = d.Email
+			}
+			result.add(record)
+		}
+	}
+
+	if confirm && expected < 0 {
+		token, expires, err := issueConfirmation("sync-delete", scope, hash, result.Deleted)
+		if err != nil {
+			return http.StatusInternalServerError, nil, err
+		}
+		result.TransactionID, result.changed, result.created = "", nil, nil
+		result.Preview, result.ConfirmationToken, result.ConfirmationExpires = true, token, &expires
+		return http.StatusOK, result, nil
+	}
+	if confirm && result.Deleted != expected {
+		return http.StatusConflict, nil, fmt.Errorf("sync would now delete %d customers, not the %d confirmed; preview it again", result.Deleted, expected)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, result, nil
+}
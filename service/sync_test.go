@@ -0,0 +1,240 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setPartnerTokens configures PARTNER_TOKENS for one test.
+func setPartnerTokens(t *testing.T, tokens string) {
+	t.Setenv("PARTNER_TOKENS", tokens)
+	partnerTokensOnce, partnerTokens = sync.Once{}, nil
+	t.Cleanup(func() { partnerTokensOnce, partnerTokens = sync.Once{}, nil })
+}
+
+func syncRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.POST("/customers/sync", a.SyncHandler)
+	return r
+}
+
+func TestSyncTakesPartnerFromToken(t *testing.T) {
+	setPartnerTokens(t, "acme:acme-token,globex:globex-token")
+	r := syncRouter(GetApp(nil))
+
+	if w := request(r, http.MethodPost, "/customers/sync?partner=acme", `[]`); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: got %d, want 401: %s", w.Code, w.Body)
+	}
+	w := request(r, http.MethodPost, "/customers/sync?partner=acme", `[]`, "Authorization", "Bearer globex-token")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("with another partner's token: got %d, want 403: %s", w.Code, w.Body)
+	}
+}
+
+func TestSyncConvergesToNewDataset(t *testing.T) {
+	pg := postgresDB(t)
+	setPartnerTokens(t, "acme:acme-token")
+	t.Setenv("REQUIRE_CONFIRMATION", "false")
+	r := syncRouter(GetApp(pg))
+
+	run := func(query, body string) syncResult {
+		t.Helper()
+		w := request(r, http.MethodPost, "/customers/sync"+query, body, "Authorization", "Bearer acme-token")
+		if w.Code != http.StatusOK {
+			t.Fatalf("sync%s: got %d: %s", query, w.Code, w.Body)
+		}
+		var result syncResult
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	first := run("", `[
+	    {"client_reference_id": "a", "name": "Ada", "email": "ada@example.com"},
+	    {"client_reference_id": "b", "name": "Bob", "email": "bob@example.com"},
+	    {"client_reference_id": "c", "name": "Cy", "email": "cy@example.com"}
+	]`)
+	if first.Inserted != 3 {
+		t.Fatalf("first sync inserted %d, want 3", first.Inserted)
+	}
+
+	second := run("?delete=true", `[
+	    {"client_reference_id": "b", "name": "Bobby", "email": "bob@example.com"},
+	    {"client_reference_id": "d", "name": "Di", "email": "di@example.com"}
+	]`)
+	if second.Inserted != 1 || second.Updated != 1 || second.Deleted != 2 {
+		t.Fatalf("second sync: %+v, want 1 inserted, 1 updated, 2 deleted", second)
+	}
+
+	var active []string
+	if err := pg.DB.Select(&active, `SELECT client_reference_id FROM customers WHERE deleted_at IS NULL ORDER BY client_reference_id`); err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 2 || active[0] != "b" || active[1] != "d" {
+		t.Errorf("active customers %v, want [b d]", active)
+	}
+	var kept int
+	if err := pg.DB.Get(&kept, `SELECT COUNT(*) FROM customers`); err != nil {
+		t.Fatal(err)
+	}
+	if kept != 4 {
+		t.Errorf("%d rows left, want the 2 deleted ones kept soft-deleted", kept)
+	}
+
+	back := run("", `[{"client_reference_id": "a", "name": "Ada", "email": "ada@example.com"}]`)
+	if back.Inserted != 1 || back.Records[0].ID != first.Records[0].ID {
+		t.Errorf("syncing a again: %+v, want it restored as customer %d", back, first.Records[0].ID)
+	}
+}
+
+func TestSyncDeleteIsPreviewedThenConfirmed(t *testing.T) {
+	pg := postgresDB(t)
+	setPartnerTokens(t, "acme:acme-token")
+	r := syncRouter(GetApp(pg))
+	send := func(query, body string) *httptest.ResponseRecorder {
+		return request(r, http.MethodPost, "/customers/sync"+query, body, "Authorization", "Bearer acme-token")
+	}
+	active := func() int {
+		var n int
+		if err := pg.DB.Get(&n, `SELECT COUNT(*) FROM customers WHERE deleted_at IS NULL`); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if w := send("", `[
+	    {"client_reference_id": "a", "email": "a@example.com"},
+	    {"client_reference_id": "b", "email": "b@example.com"},
+	    {"client_reference_id": "c", "email": "c@example.com"}
+	]`); w.Code != http.StatusOK {
+		t.Fatalf("seeding: %d %s", w.Code, w.Body)
+	}
+
+	payload := `[{"client_reference_id": "a", "email": "a@example.com"}]`
+	w := send("?delete=true", payload)
+	var preview syncResult
+	if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("preview: %d %s", w.Code, w.Body)
+	}
+	if !preview.Preview || preview.Deleted != 2 || len(preview.ConfirmationToken) == 0 {
+		t.Fatalf("preview: %+v, want 2 deletions and a token", preview)
+	}
+	if n := active(); n != 3 {
+		t.Fatalf("the preview left %d active customers, want all 3", n)
+	}
+
+	confirm := "?delete=true&confirm=" + url.QueryEscape(preview.ConfirmationToken)
+	if w := send(confirm+"&expectedCount=1", payload); w.Code != http.StatusConflict {
+		t.Errorf("confirming the wrong count: got %d, want 409: %s", w.Code, w.Body)
+	}
+
+	pg.DB.MustExec(`INSERT INTO customers (partner, client_reference_id, email) VALUES ('acme', 'd', 'd@example.com')`)
+	if w := send(confirm+"&expectedCount=2", payload); w.Code != http.StatusConflict {
+		t.Errorf("confirming after the count changed: got %d, want 409: %s", w.Code, w.Body)
+	}
+	if n := active(); n != 4 {
+		t.Fatalf("a refused confirmation left %d active customers, want 4", n)
+	}
+
+	pg.DB.MustExec(`DELETE FROM customers WHERE client_reference_id = 'd'`)
+	if w := send(confirm+"&expectedCount=2", payload); w.Code != http.StatusOK {
+		t.Fatalf("confirming: got %d: %s", w.Code, w.Body)
+	}
+	if n := active(); n != 1 {
+		t.Errorf("%d active customers after the confirmed sync, want 1", n)
+	}
+}
+
+func TestSyncSkipsBadRecordsAndAppliesTheRest(t *testing.T) {
+	pg := postgresDB(t)
+	setPartnerTokens(t, "acme:acme-token")
+	r := syncRouter(GetApp(pg))
+	pg.DB.MustExec(`INSERT INTO customers (partner, client_reference_id, email) VALUES ('globex', 'x', 'taken@example.com')`)
+
+	w := request(r, http.MethodPost, "/customers/sync", `[
+	    {"client_reference_id": "a", "name": "Ada", "email": "ada@example.com"},
+	    {"client_reference_id": "b", "name": "R2D2", "email": "bob@example.com"},
+	    {"client_reference_id": "c", "name": "Cy", "email": "taken@example.com"},
+	    {"client_reference_id": "d", "name": "Di", "email": "di@example.com"}
+	]`, "Authorization", "Bearer acme-token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var result syncResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Inserted != 2 || result.Skipped != 2 || len(result.Records) != 4 {
+		t.Fatalf("result %+v, want 2 inserted and 2 skipped", result)
+	}
+	for i, want := range []string{syncInserted, syncInvalid, syncConflict, syncInserted} {
+		record := result.Records[i]
+		if record.Outcome != want || *record.Index != i {
+			t.Errorf("record %d: %+v, want %s", i, record, want)
+		}
+		if want != syncInserted && len(record.Error) == 0 {
+			t.Errorf("skipped record %d carries no error", i)
+		}
+	}
+
+	var stored []string
+	if err := pg.DB.Select(&stored, `SELECT client_reference_id FROM customers WHERE partner = 'acme' ORDER BY client_reference_id`); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 || stored[0] != "a" || stored[1] != "d" {
+		t.Errorf("stored %v, want [a d]", stored)
+	}
+}
+
+func TestSyncRejectsAnUnknownConflictColumn(t *testing.T) {
+	setPartnerTokens(t, "acme:acme-token")
+	r := syncRouter(GetApp(nil))
+	w := request(r, http.MethodPost, "/customers/sync?onConflict=name", `[]`, "Authorization", "Bearer acme-token")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want 400: %s", w.Code, w.Body)
+	}
+}
+
+func TestSyncOnEmailMatchesRecordsByEmail(t *testing.T) {
+	pg := postgresDB(t)
+	setPartnerTokens(t, "acme:acme-token,globex:globex-token")
+	r := syncRouter(GetApp(pg))
+	run := func(token, body string) syncResult {
+		t.Helper()
+		w := request(r, http.MethodPost, "/customers/sync?onConflict=email", body, "Authorization", "Bearer "+token)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", w.Code, w.Body)
+		}
+		var result syncResult
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	first := run("acme-token", `[{"name": "Ada", "email": "ada@example.com"}, {"name": "Bob", "email": "bob@example.com"}]`)
+	if first.Inserted != 2 {
+		t.Fatalf("first sync: %+v, want 2 inserted without references", first)
+	}
+
+	second := run("acme-token", `[{"name": "Ada King", "email": "ada@example.com", "client_reference_id": "a"}, {"name": "Bob", "email": "bob@example.com"}]`)
+	if second.Updated != 1 || second.Unchanged != 1 || second.Records[0].ID != first.Records[0].ID {
+		t.Fatalf("second sync: %+v, want ada updated in place and bob unchanged", second)
+	}
+	var reference string
+	if err := pg.DB.Get(&reference, `SELECT client_reference_id FROM customers WHERE email = 'ada@example.com'`); err != nil || reference != "a" {
+		t.Errorf("ada's reference is %q, want the one the update supplied", reference)
+	}
+
+	other := run("globex-token", `[{"name": "Ada", "email": "ada@example.com"}]`)
+	if other.Skipped != 1 || other.Records[0].Outcome != syncConflict {
+		t.Errorf("another partner's sync of the email: %+v, want it skipped as a conflict", other)
+	}
+}
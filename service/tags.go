@@ -0,0 +1,126 @@
+package service
+
+import (
+	"customer-service/db"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// defaultMaxTags caps the tags on one customer unless MAX_TAGS says otherwise.
+const defaultMaxTags = 50
+
+// maxTags reads MAX_TAGS, falling back to defaultMaxTags.
+func maxTags() int {
+	raw, ok := os.LookupEnv("MAX_TAGS")
+	if !ok {
+		return defaultMaxTags
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 1 {
+		log.Printf("MAX_TAGS must be a positive integer, using %d", defaultMaxTags)
+		return defaultMaxTags
+	}
+	return v
+}
+
+type tagRequest struct {
+	Tag string `json:"tag"`
+}
+
+// Each op is a single UPDATE using the array functions, so concurrent edits
+// of different tags on one customer never overwrite each other. The WHERE
+// clause skips the write when the op would not change the tags, and an add
+// when the customer already has the maximum number of tags, passed as $3.
+var tagOps = map[string]string{
+	"add":    `UPDATE customers SET tags = array_append(tags, $1), updated_at = now() WHERE id = $2 AND ` + notDeleted + ` AND NOT ($1 = ANY(tags)) AND cardinality(tags) < $3`,
+	"remove": `UPDATE customers SET tags = array_remove(tags, $1), updated_at = now() WHERE id = $2 AND ` + notDeleted + ` AND $1 = ANY(tags)`,
+}
+
+// editTags applies ?op=add or ?op=remove with the posted tag. It returns the
+// tag so the caller can purge it, and reports whether the tags changed.
+func editTags(db *db.PostgresDB, c *gin.Context) (int, *Customer, string, bool, error) {
+	id, err := paramID(c)
+	if err != nil {
+		return http.StatusBadRequest, nil, "", false, err
+	}
+
+	p := struct {
+		Op string `form:"op"`
+	}{Op: "add"}
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, "", false, err
+	}
+	op := p.Op
+	stmt, ok := tagOps[op]
+	if !ok {
+		return http.StatusBadRequest, nil, "", false, fmt.Errorf("op must be add or remove")
+	}
+
+	var req tagRequest
+	if err := bindJSON(c, &req); err != nil {
+		return http.StatusBadRequest, nil, "", false, err
+	}
+	tag := strings.TrimSpace(req.Tag)
+	if len(tag) == 0 {
+		return http.StatusBadRequest, nil, "", false, fmt.Errorf("tag cannot be empty")
+	}
+	// Only new tags are checked, so one stored before the check can still
+	// be removed.
+	if op == "add" {
+		if err := validateTag(tag); err != nil {
+			return http.StatusUnprocessableEntity, nil, "", false, err
+		}
+	}
+
+	limit := maxTags()
+	args := []interface{}{tag, id}
+	if op == "add" {
+		args = append(args, limit)
+	}
+	var n int64
+	err = inRequest(db, c, func(tx *sqlx.Tx) error {
+		res, err := tx.Exec(stmt, args...)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", false, err
+	}
+
+	customer, err := fetchCustomer(db, id)
+	if err == sql.ErrNoRows {
+		return http.StatusNotFound, nil, "", false, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, nil, "", false, err
+	}
+	// An add that changed nothing either found the tag already present or
+	// hit the limit; the fetched row tells which.
+	if n == 0 && op == "add" && !hasTag(customer, tag) && len(customer.Tags) >= limit {
+		return http.StatusUnprocessableEntity, nil, "", false,
+			invalid("tags", codeMaxItems, "a customer cannot have more than %d tags", limit)
+	}
+
+	return http.StatusOK, customer, tag, n > 0, nil
+}
+
+// hasTag reports whether customer already carries tag.
+func hasTag(customer *Customer, tag string) bool {
+	for _, t := range customer.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
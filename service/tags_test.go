@@ -0,0 +1,115 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func tagsRouter(a *App) *gin.Engine {
+	r := gin.New()
+	// Without SerializeCustomer, so concurrent edits race in the database.
+	r.POST("/customers/:customerId/tags", a.TagsHandler)
+	return r
+}
+
+func TestConcurrentTagAddsAllSurvive(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := tagsRouter(a)
+	id := seedCustomers(t, a, 1, "alice")[0]
+	target := fmt.Sprintf("/customers/%d/tags?op=add", id)
+
+	want := make([]string, 10)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range want {
+		want[i] = fmt.Sprintf("tag-%d", i)
+		wg.Add(1)
+		go func(tag string) {
+			defer wg.Done()
+			<-start
+			if w := request(r, http.MethodPost, target, `{"tag": "`+tag+`"}`); w.Code != http.StatusOK {
+				t.Errorf("adding %s: %d %s", tag, w.Code, w.Body)
+			}
+		}(want[i])
+	}
+	close(start)
+	wg.Wait()
+
+	customer, err := fetchCustomer(a.db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := append([]string(nil), customer.Tags...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("tags %v, want all of %v", got, want)
+	}
+}
+
+func TestTagRemoveAndRepeatedAdd(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := tagsRouter(a)
+	id := seedCustomers(t, a, 1, "alice")[0]
+	target := fmt.Sprintf("/customers/%d/tags", id)
+
+	for range [2]struct{}{} {
+		if w := request(r, http.MethodPost, target+"?op=add", `{"tag": "vip"}`); w.Code != http.StatusOK {
+			t.Fatalf("add: %d %s", w.Code, w.Body)
+		}
+	}
+	if customer, _ := fetchCustomer(a.db, id); len(customer.Tags) != 1 {
+		t.Errorf("adding a tag twice left %v", customer.Tags)
+	}
+	if w := request(r, http.MethodPost, target+"?op=remove", `{"tag": "vip"}`); w.Code != http.StatusOK {
+		t.Fatalf("remove: %d %s", w.Code, w.Body)
+	}
+	if customer, _ := fetchCustomer(a.db, id); len(customer.Tags) != 0 {
+		t.Errorf("tags %v after the remove", customer.Tags)
+	}
+	if w := request(r, http.MethodPost, target+"?op=toggle", `{"tag": "vip"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("an unknown op: got %d, want 400", w.Code)
+	}
+}
+
+func TestTagsStopAtMaxTags(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := tagsRouter(a)
+	t.Setenv("MAX_TAGS", "2")
+	id := seedCustomers(t, a, 1, "alice")[0]
+	target := fmt.Sprintf("/customers/%d/tags?op=add", id)
+
+	for _, tag := range []string{"a", "b", "b"} {
+		if w := request(r, http.MethodPost, target, `{"tag": "`+tag+`"}`); w.Code != http.StatusOK {
+			t.Fatalf("adding %s: got %d: %s", tag, w.Code, w.Body)
+		}
+	}
+	if w := request(r, http.MethodPost, target, `{"tag": "c"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("adding past the limit: got %d, want 422: %s", w.Code, w.Body)
+	}
+
+	customer, err := fetchCustomer(a.db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(customer.Tags) != "[a b]" {
+		t.Errorf("tags %v, want [a b]", customer.Tags)
+	}
+}
+
+func TestTagAddRejectsTagsOutsideTheCharset(t *testing.T) {
+	r := tagsRouter(GetApp(nil))
+	tooLong := strings.Repeat("a", 65)
+	for _, tag := range []string{"a b", "vip,gold", "a\tb", "x\u00a0y", tooLong} {
+		body := fmt.Sprintf(`{"tag": %q}`, tag)
+		if w := request(r, http.MethodPost, "/customers/1/tags?op=add", body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("tag %q: got %d, want 422: %s", tag, w.Code, w.Body)
+		}
+	}
+}
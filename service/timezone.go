@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/gin-gonic/gin"
+)
+
+const timezoneKey = "timezone"
+
+var locations sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// Timezone resolves the zone timestamps are rendered in: the ?tz= parameter,
+// else DEFAULT_TIMEZONE, else UTC. Unknown zone names are rejected with 400
+// before the handler runs. Timestamps are always stored in UTC.
+func Timezone(c *gin.Context) {
+	name := c.Query("tz")
+	if len(name) == 0 {
+		name = os.Getenv("DEFAULT_TIMEZONE")
+	}
+	if len(name) == 0 {
+		name = "UTC"
+	}
+
+	loc, err := loadLocation(name)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Set(timezoneKey, loc)
+	c.Next()
+}
+
+// localize converts the customers' timestamps into the request's timezone.
+func localize(c *gin.Context, customers ...*Customer) {
+	loc := time.UTC
+	if v, ok := c.Get(timezoneKey); ok {
+		loc = v.(*time.Location)
+	}
+
+	for _, customer := range customers {
+		customer.CreatedAt = customer.CreatedAt.In(loc)
+		customer.UpdatedAt = customer.UpdatedAt.In(loc)
+	}
+}
+
+// ageDays counts the calendar days between created and now as seen in loc,
+// so a customer created late in the evening is a day old after midnight
+// local time rather than after midnight UTC.
+func ageDays(created, now time.Time, loc *time.Location) int {
+	day := func(t time.Time) time.Time {
+		y, m, d := t.In(loc).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	return int(day(now).Sub(day(created)).Hours() / 24)
+}
+
+// setAge fills in the customer's age_days in the request's timezone.
+func setAge(c *gin.Context, customer *Customer) {
+	loc := time.UTC
+	if v, ok := c.Get(timezoneKey); ok {
+		loc = v.(*time.Location)
+	}
+	days := ageDays(customer.CreatedAt, time.Now(), loc)
+	customer.AgeDays = &days
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTimestampsAreRenderedInTheRequestedZone(t *testing.T) {
+	created := time.Date(2024, time.January, 15, 12, 0, 0, 0, time.UTC)
+	r := gin.New()
+	r.Use(Timezone)
+	r.GET("/", func(c *gin.Context) {
+		customer := Customer{ID: 1, CreatedAt: created, UpdatedAt: created.Add(180 * 24 * time.Hour)}
+		localize(c, &customer)
+		render(c, http.StatusOK, customer)
+	})
+
+	w := request(r, http.MethodGet, "/?tz=America/New_York", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	for _, want := range []string{`"created_at":"2024-01-15T07:00:00-05:00"`, `"updated_at":"2024-07-13T08:00:00-04:00"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s does not contain %s", w.Body, want)
+		}
+	}
+
+	t.Setenv("DEFAULT_TIMEZONE", "Asia/Tokyo")
+	if w := request(r, http.MethodGet, "/", ""); !strings.Contains(w.Body.String(), `"created_at":"2024-01-15T21:00:00+09:00"`) {
+		t.Errorf("DEFAULT_TIMEZONE was not applied: %s", w.Body)
+	}
+	if w := request(r, http.MethodGet, "/?tz=Mars/Olympus", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("an unknown zone: got %d, want 400", w.Code)
+	}
+}
+
+func TestGetRendersTheCustomerInTheRequestedZone(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.Use(Timezone)
+	r.GET("/customers/:customerId", a.GetHandler)
+	id := seedCustomers(t, a, 1, "alice")[0]
+	a.db.DB.MustExec(`UPDATE customers SET created_at = '2024-01-15T12:00:00Z' WHERE id = $1`, id)
+
+	w := request(r, http.MethodGet, fmt.Sprintf("/customers/%d?tz=America/New_York", id), "")
+	var customer struct {
+		CreatedAt string `json:"created_at"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &customer); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	if customer.CreatedAt != "2024-01-15T07:00:00-05:00" {
+		t.Errorf("created_at %s, want 2024-01-15T07:00:00-05:00", customer.CreatedAt)
+	}
+}
+
+func TestAgeDaysCountsLocalCalendarDays(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	late := time.Date(2024, time.January, 1, 23, 30, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name         string
+		created, now time.Time
+		loc          *time.Location
+		want         int
+	}{
+		{"past midnight UTC", late, late.Add(time.Hour), time.UTC, 1},
+		{"same evening in New York", late, late.Add(time.Hour), newYork, 0},
+		{"same instant", late, late, time.UTC, 0},
+		{"across the spring DST change", time.Date(2024, time.March, 9, 12, 0, 0, 0, newYork), time.Date(2024, time.March, 11, 12, 0, 0, 0, newYork), newYork, 2},
+	} {
+		if got := ageDays(tc.created, tc.now, tc.loc); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGetReportsAgeDays(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.Use(Timezone)
+	r.GET("/customers/:customerId", a.GetHandler)
+	id := seedCustomers(t, a, 1, "alice")[0]
+	a.db.DB.MustExec(`UPDATE customers SET created_at = now() - interval '3 days' WHERE id = $1`, id)
+
+	w := request(r, http.MethodGet, fmt.Sprintf("/customers/%d", id), "")
+	var customer Customer
+	if err := json.Unmarshal(w.Body.Bytes(), &customer); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	if customer.AgeDays == nil || *customer.AgeDays != 3 {
+		t.Errorf("age_days %v, want 3", customer.AgeDays)
+	}
+}
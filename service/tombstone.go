@@ -0,0 +1,18 @@
+package service
+
+import (
+	"customer-service/db"
+	"os"
+)
+
+// Tombstones remember the ids of deleted customers so a later GET can answer
+// 410 Gone instead of 404. They are kept only when TRACK_TOMBSTONES=true.
+func tombstonesEnabled() bool {
+	return os.Getenv("TRACK_TOMBSTONES") == "true"
+}
+
+func isTombstoned(db *db.PostgresDB, id int) (bool, error) {
+	var gone bool
+	err := db.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM customer_tombstones WHERE customer_id = $1)`, id).Scan(&gone)
+	return gone, err
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPurgedIDIsGoneAndUnknownIDIsNotFound(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	t.Setenv("TRACK_TOMBSTONES", "true")
+	r := gin.New()
+	r.GET("/customers/:customerId", a.GetHandler)
+	r.DELETE("/customers/:customerId", a.SerializeCustomer, a.DeleteHandler)
+	id := seedCustomers(t, a, 1, "alice")[0]
+	target := fmt.Sprintf("/customers/%d", id)
+
+	if w := request(r, http.MethodDelete, target, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if w := request(r, http.MethodGet, target, ""); w.Code != http.StatusGone {
+		t.Errorf("purged id: got %d, want 410: %s", w.Code, w.Body)
+	}
+	if w := request(r, http.MethodGet, fmt.Sprintf("/customers/%d", id+1), ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown id: got %d, want 404", w.Code)
+	}
+
+	t.Setenv("TRACK_TOMBSTONES", "false")
+	if w := request(r, http.MethodGet, target, ""); w.Code != http.StatusNotFound {
+		t.Errorf("purged id without tombstones: got %d, want 404", w.Code)
+	}
+}
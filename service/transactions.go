@@ -0,0 +1,153 @@
+package service
+
+import (
+	"customer-service/db"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+type undoResult struct {
+	TransactionID string `json:"transaction_id"`
+	Undone        int    `json:"undone"`
+	IDs           []int  `json:"ids"`
+}
+
+// tagTransaction makes the event trigger record txID on every change made
+// in tx, so the changes can later be found and undone together. Bulk
+// operations use one id across all their database transactions.
+func tagTransaction(tx *sqlx.Tx, txID string) error {
+	_, err := tx.Exec(`SELECT set_config('app.tx_id', $1, true)`, txID)
+	return err
+}
+
+// Event origins, recorded for the writes whose customer.created events
+// differ from a plain create. Replays use them to send the create hook
+// only what it was sent the first time.
+const (
+	originRestore = "restore"
+	originSync    = "sync"
+	originUndo    = "undo"
+)
+
+// tagOrigin makes the event trigger record origin on every change made in tx.
+func tagOrigin(tx *sqlx.Tx, origin string) error {
+	_, err := tx.Exec(`SELECT set_config('app.origin', $1, true)`, origin)
+	return err
+}
+
+// Each undo statement reverses one event. Undone rows are restored from
+// the event's before-image with jsonb_populate_record. Any event that has a
+// before-image, including a soft delete, is undone by writing it back.
+const (
+	undoCreated = `DELETE FROM customers WHERE id = $1`
+	undoUpdated = `UPDATE customers c
+	SET (name, email, address, owner, partner, client_reference_id, tags, parent_id, lat, lng, created_at, updated_at, deleted_at) =
+	    (r.name, r.email, r.address, r.owner, r.partner, r.client_reference_id, r.tags, r.parent_id, r.lat, r.lng, r.created_at, r.updated_at, r.deleted_at)
+	FROM jsonb_populate_record(NULL::customers, $2) r
+	WHERE c.id = $1`
+	undoDeleted = `INSERT INTO customers SELECT * FROM jsonb_populate_record(NULL::customers, $1)`
+)
+
+// undoTransaction reverses every change recorded under :txId, newest first,
+// in one new transaction that is itself tagged with a fresh id. It refuses
+// with 409 when any of the customers changed again after the batch.
+func undoTransaction(db *db.PostgresDB, c *gin.Context) (int, *undoResult, error) {
+	txID := c.Param("txId")
+
+	undoID, err := newRandomID()
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	tx, err := beginRequest(db, c)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the batch's customers, in id order, keeps them from changing
+	// between the conflict check and the undo. A later write to one of them
+	// had to wait for the batch to commit, so its event has a higher seq.
+	lock := `SELECT id FROM customers
+	WHERE id IN (SELECT customer_id FROM customer_events WHERE tx_id = $1) ORDER BY id FOR UPDATE`
+	if _, err := tx.Exec(lock, txID); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if err := tagTransaction(tx, undoID); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if err := tagOrigin(tx, originUndo); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	var events []struct {
+		Type       string          `db:"type"`
+		CustomerID int             `db:"customer_id"`
+		Payload    json.RawMessage `db:"payload"`
+		Previous   json.RawMessage `db:"previous"`
+	}
+	stmt := `SELECT type, customer_id, payload, COALESCE(previous, 'null') AS previous
+	FROM customer_events WHERE tx_id = $1 ORDER BY seq DESC`
+	if err := tx.Select(&events, stmt, txID); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if len(events) == 0 {
+		return http.StatusNotFound, nil, fmt.Errorf("transaction %q not found", txID)
+	}
+
+	var changed bool
+	err = tx.Get(&changed, `SELECT EXISTS (
+	    SELECT 1 FROM customer_events later
+	    WHERE later.customer_id IN (SELECT customer_id FROM customer_events WHERE tx_id = $1)
+	    AND later.seq > (SELECT MAX(seq) FROM customer_events WHERE tx_id = $1)
+	)`, txID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	if changed {
+		return http.StatusConflict, nil, fmt.Errorf("customers in transaction %q changed since; undo would overwrite those changes", txID)
+	}
+
+	result := &undoResult{TransactionID: undoID, IDs: make([]int, 0, len(events))}
+	for _, e := range events {
+		var err error
+		switch {
+		case string(e.Previous) != "null":
+			_, err = tx.Exec(undoUpdated, e.CustomerID, []byte(e.Previous))
+		case e.Type == "customer.created":
+			_, err = tx.Exec(undoCreated, e.CustomerID)
+		case e.Type == "customer.deleted":
+			_, err = tx.Exec(undoDeleted, []byte(e.Payload))
+		}
+		if err != nil {
+			status, err := undoFailed(err)
+			return status, nil, err
+		}
+		if e.Type == "customer.deleted" {
+			if _, err := tx.Exec(`DELETE FROM customer_tombstones WHERE customer_id = $1`, e.CustomerID); err != nil {
+				return http.StatusInternalServerError, nil, err
+			}
+		}
+		result.Undone++
+		result.IDs = append(result.IDs, e.CustomerID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, result, nil
+}
+
+// undoFailed maps a failed undo statement to a response status. Restoring
+// the old state can clash with rows the batch did not touch, such as a
+// child added under a created customer or a reused email.
+func undoFailed(err error) (int, error) {
+	if db.IsForeignKeyViolation(err) || db.IsUniqueViolation(err) {
+		return http.StatusConflict, fmt.Errorf("undo conflicts with the current data: %w", err)
+	}
+	return http.StatusInternalServerError, err
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"customer-service/db"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listTrash pages through the soft-deleted customers, most recently
+// deleted first.
+func listTrash(db *db.PostgresDB, c *gin.Context) (int, *customerList, error) {
+	p := struct {
+		Limit  int `form:"limit"`
+		Offset int `form:"offset"`
+	}{Limit: defaultListLimit}
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if p.Limit < 1 || p.Limit > maxListLimit {
+		return http.StatusBadRequest, nil, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+	}
+	if p.Offset < 0 {
+		return http.StatusBadRequest, nil, fmt.Errorf("offset cannot be negative")
+	}
+
+	list := &customerList{Data: make([]Customer, 0), Limit: p.Limit, Offset: p.Offset}
+	if err := db.DB.Get(&list.Total, `SELECT COUNT(*) FROM customers WHERE deleted_at IS NOT NULL`); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	stmt := `SELECT ` + customerColumns + ` FROM customers WHERE deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC, id DESC LIMIT $1 OFFSET $2`
+	if err := db.DB.Select(&list.Data, stmt, p.Limit, p.Offset); err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, list, nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func trashRouter(a *App) *gin.Engine {
+	r := syncRouter(a)
+	r.GET("/customers/trash", a.RequireAdmin, a.TrashHandler)
+	r.POST("/customers/bulk-restore", a.RequireAdmin, a.BulkRestoreHandler)
+	return r
+}
+
+func TestTrashNeedsTheAdminToken(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "secret")
+	if w := request(trashRouter(GetApp(nil)), http.MethodGet, "/customers/trash", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("got %d, want 401", w.Code)
+	}
+}
+
+func TestTrashListsSyncDeletionsNewestFirst(t *testing.T) {
+	pg := postgresDB(t)
+	t.Setenv("ADMIN_TOKEN", "secret")
+	t.Setenv("REQUIRE_CONFIRMATION", "false")
+	setPartnerTokens(t, "acme:acme-token")
+	a := GetApp(pg)
+	r := trashRouter(a)
+	sync := func(query, body string) {
+		t.Helper()
+		if w := request(r, http.MethodPost, "/customers/sync"+query, body, "Authorization", "Bearer acme-token"); w.Code != http.StatusOK {
+			t.Fatalf("sync%s: got %d: %s", query, w.Code, w.Body)
+		}
+	}
+
+	sync("", `[
+	    {"client_reference_id": "a", "email": "a@example.com"},
+	    {"client_reference_id": "b", "email": "b@example.com"},
+	    {"client_reference_id": "c", "email": "c@example.com"}
+	]`)
+	sync("?delete=true", `[{"client_reference_id": "b", "email": "b@example.com"}, {"client_reference_id": "c", "email": "c@example.com"}]`)
+	sync("?delete=true", `[{"client_reference_id": "b", "email": "b@example.com"}]`)
+
+	list := listPage(t, r, "/customers/trash", "Authorization", "Bearer secret")
+	emails := make([]string, 0, len(list.Data))
+	for _, customer := range list.Data {
+		emails = append(emails, customer.Email)
+		if customer.DeletedAt == nil {
+			t.Errorf("customer %d in the trash has no deleted_at", customer.ID)
+		}
+	}
+	if want := []string{"c@example.com", "a@example.com"}; !reflect.DeepEqual(emails, want) || list.Total != 2 {
+		t.Errorf("trash %v of %d, want %v", emails, list.Total, want)
+	}
+}
+
+func TestBulkRestoreBringsBackSyncDeletions(t *testing.T) {
+	pg := postgresDB(t)
+	t.Setenv("ADMIN_TOKEN", "secret")
+	t.Setenv("REQUIRE_CONFIRMATION", "false")
+	setPartnerTokens(t, "acme:acme-token")
+	r := trashRouter(GetApp(pg))
+
+	w := request(r, http.MethodPost, "/customers/sync", `[
+	    {"client_reference_id": "a", "email": "a@example.com"},
+	    {"client_reference_id": "b", "email": "b@example.com"}
+	]`, "Authorization", "Bearer acme-token")
+	var seeded syncResult
+	if err := json.Unmarshal(w.Body.Bytes(), &seeded); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("seeding: %d %s", w.Code, w.Body)
+	}
+	deleted, active := seeded.Records[0].ID, seeded.Records[1].ID
+	if w := request(r, http.MethodPost, "/customers/sync?delete=true", `[{"client_reference_id": "b", "email": "b@example.com"}]`,
+		"Authorization", "Bearer acme-token"); w.Code != http.StatusOK {
+		t.Fatalf("deleting a: %d %s", w.Code, w.Body)
+	}
+
+	body := fmt.Sprintf(`{"ids": [%d, %d, %d]}`, deleted, active, active+100)
+	if w := request(r, http.MethodPost, "/customers/bulk-restore", body); w.Code != http.StatusUnauthorized {
+		t.Errorf("without the admin token: got %d, want 401", w.Code)
+	}
+	w = request(r, http.MethodPost, "/customers/bulk-restore", body, "Authorization", "Bearer secret")
+	var result bulkRestoreResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("restoring: %d %s", w.Code, w.Body)
+	}
+	if result.Restored != 1 || !reflect.DeepEqual(result.IDs, []int{deleted}) || !reflect.DeepEqual(result.Skipped, []int{active, active + 100}) {
+		t.Errorf("restore %+v, want %d restored and the rest skipped", result, deleted)
+	}
+	if trash := listPage(t, r, "/customers/trash", "Authorization", "Bearer secret"); trash.Total != 0 {
+		t.Errorf("%d customers left in the trash, want none", trash.Total)
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Validation codes. Together with the field names they are the only labels
+// the failure counter ever sees, which keeps its cardinality bounded.
+const (
+	codeRequired     = "required"
+	codeFormat       = "format"
+	codeDuplicate    = "duplicate"
+	codeMaxLength    = "max_length"
+	codeFreeEmail    = "free_email"
+	codeMXUnverified = "mx_unverified"
+	codeMaxItems     = "max_items"
+	codeNoMX         = "no_mx"
+	codeRange        = "range"
+)
+
+// validationFailures counts rejected input by "field.code", published on
+// the metrics endpoint.
+var validationFailures = expvar.NewMap("validation_failures")
+
+// validationWarnings counts accepted input that raised a warning.
+var validationWarnings = expvar.NewMap("validation_warnings")
+
+// fieldError is a validation failure attributable to one input field.
+type fieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+func (e *fieldError) Error() string {
+	return e.Message
+}
+
+// invalid records a validation failure for field and returns it as an error.
+func invalid(field, code, format string, args ...interface{}) error {
+	validationFailures.Add(field+"."+code, 1)
+	return &fieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// fieldWarning is an advisory about otherwise valid input. It is returned
+// with the saved customer instead of blocking the request.
+type fieldWarning struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// columnLength is the size of the VARCHAR columns backing every field, the
+// ceiling for any configured maximum length.
+const columnLength = 255
+
+// defaultNamePattern allows letters, combining marks, spaces, hyphens and
+// apostrophes.
+const defaultNamePattern = `^[\p{L}\p{M} '’-]*$`
+
+// fieldSpec is the single definition of a field's constraints. The
+// validators enforce it and /customers/schema publishes it, so the two
+// cannot drift apart.
+type fieldSpec struct {
+	Field     string
+	Required  bool
+	MaxLength int
+	Pattern   *regexp.Regexp
+
+	value func(*Customer) string
+}
+
+// tagSpec constrains each tag. Tags name cache surrogate keys, which are
+// separated by spaces, so a tag is a single short word.
+var tagSpec = fieldSpec{Field: "tags", MaxLength: 64, Pattern: regexp.MustCompile(`^[\p{L}\p{N}._:-]+$`)}
+
+var (
+	customerSpecOnce sync.Once
+	customerSpec     []fieldSpec
+)
+
+// maxLength reads MAX_LENGTH_<FIELD>, falling back to the column size.
+func maxLength(field string) int {
+	name := "MAX_LENGTH_" + strings.ToUpper(field)
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return columnLength
+	}
+	if v <= 0 || v > columnLength {
+		log.Printf("%s must be between 1 and %d, using %d", name, columnLength, columnLength)
+		return columnLength
+	}
+	return v
+}
+
+// namePatternRegexp compiles NAME_PATTERN, falling back to the default.
+func namePatternRegexp() *regexp.Regexp {
+	raw := os.Getenv("NAME_PATTERN")
+	if len(raw) == 0 {
+		raw = defaultNamePattern
+	}
+
+	re, err := regexp.Compile(raw)
+	if err != nil {
+		log.Printf("invalid NAME_PATTERN %q, using default: %v", raw, err)
+		re = regexp.MustCompile(defaultNamePattern)
+	}
+	return re
+}
+
+// fieldSpecs builds the spec on first use, once .env is loaded.
+func fieldSpecs() []fieldSpec {
+	customerSpecOnce.Do(func() {
+		customerSpec = []fieldSpec{
+			{Field: "name", MaxLength: maxLength("name"), Pattern: namePatternRegexp(), value: func(c *Customer) string { return c.Name }},
+			{Field: "email", Required: true, MaxLength: maxLength("email"), value: func(c *Customer) string { return c.Email }},
+			{Field: "address", MaxLength: maxLength("address"), value: func(c *Customer) string { return c.Address }},
+			{Field: "owner", MaxLength: maxLength("owner"), value: func(c *Customer) string { return c.Owner }},
+			{Field: "client_reference_id", MaxLength: maxLength("client_reference_id"), value: func(c *Customer) string { return c.Reference }},
+		}
+	})
+	return customerSpec
+}
+
+// validateCustomer checks the fields a new customer must have.
+func validateCustomer(customer *Customer) error {
+	for _, spec := range fieldSpecs() {
+		if spec.Required && len(spec.value(customer)) == 0 {
+			return invalid(spec.Field, codeRequired, "%s cannot be empty", spec.Field)
+		}
+	}
+	return nil
+}
+
+// validateFields checks the length and format of every field that is set.
+func validateFields(customer *Customer) error {
+	for _, spec := range fieldSpecs() {
+		v := spec.value(customer)
+		if len(v) == 0 {
+			continue
+		}
+		if utf8.RuneCountInString(v) > spec.MaxLength {
+			return invalid(spec.Field, codeMaxLength, "%s cannot be longer than %d characters", spec.Field, spec.MaxLength)
+		}
+		if spec.Pattern != nil && !spec.Pattern.MatchString(v) {
+			return invalid(spec.Field, codeFormat, "%s %q contains characters that are not allowed", spec.Field, v)
+		}
+	}
+	return nil
+}
+
+// validateTag checks a tag being added against tagSpec.
+func validateTag(tag string) error {
+	if utf8.RuneCountInString(tag) > tagSpec.MaxLength {
+		return invalid(tagSpec.Field, codeMaxLength, "a tag cannot be longer than %d characters", tagSpec.MaxLength)
+	}
+	if !tagSpec.Pattern.MatchString(tag) {
+		return invalid(tagSpec.Field, codeFormat, "tag %q may only contain letters, digits, '.', '_', ':' and '-'", tag)
+	}
+	return nil
+}
+
+// freeEmailDomains reads the comma separated FREE_EMAIL_DOMAINS, defaulting
+// to the common consumer mail providers.
+func freeEmailDomains() map[string]bool {
+	raw, ok := os.LookupEnv("FREE_EMAIL_DOMAINS")
+	if !ok {
+		raw = "gmail.com,googlemail.com,yahoo.com,hotmail.com,outlook.com,live.com,aol.com,icloud.com,gmx.com,proton.me"
+	}
+
+	domains := map[string]bool{}
+	for _, d := range strings.Split(raw, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); len(d) != 0 {
+			domains[d] = true
+		}
+	}
+	return domains
+}
+
+// checkWarnings returns the non-blocking issues with customer. With
+// WARNINGS_AS_ERRORS=true the first one is returned as a validation error
+// instead. With CHECK_EMAIL_MX=true it also rejects email domains that do
+// not accept mail.
+func checkWarnings(customer *Customer) ([]fieldWarning, error) {
+	warnings := make([]fieldWarning, 0)
+	if at := strings.LastIndex(customer.Email, "@"); at >= 0 {
+		domain := strings.ToLower(customer.Email[at+1:])
+		if freeEmailDomains()[domain] {
+			warnings = append(warnings, fieldWarning{
+				Field:   "email",
+				Code:    codeFreeEmail,
+				Message: fmt.Sprintf("email uses the free provider %s", domain),
+			})
+		}
+	}
+
+	if len(warnings) != 0 && os.Getenv("WARNINGS_AS_ERRORS") == "true" {
+		w := warnings[0]
+		return nil, invalid(w.Field, w.Code, "%s", w.Message)
+	}
+
+	// A failed MX lookup must not block writes while DNS is down, so it is
+	// only ever a warning.
+	if at := strings.LastIndex(customer.Email, "@"); at >= 0 && mxCheckEnabled() {
+		domain := strings.ToLower(customer.Email[at+1:])
+		accepts, err := domainAcceptsMail(domain)
+		if err != nil {
+			log.Printf("MX lookup for %s failed, accepting email: %v", domain, err)
+			warnings = append(warnings, fieldWarning{
+				Field:   "email",
+				Code:    codeMXUnverified,
+				Message: fmt.Sprintf("could not verify that %s accepts mail", domain),
+			})
+		} else if !accepts {
+			return nil, invalid("email", codeNoMX, "email domain %s does not accept mail", domain)
+		}
+	}
+
+	for _, w := range warnings {
+		validationWarnings.Add(w.Field+"."+w.Code, 1)
+	}
+	return warnings, nil
+}
+
+// customerSchema renders the spec as a JSON Schema for customer input.
+func customerSchema() gin.H {
+	properties := gin.H{}
+	required := make([]string, 0)
+	for _, spec := range fieldSpecs() {
+		property := gin.H{"type": "string", "maxLength": spec.MaxLength}
+		if spec.Pattern != nil {
+			property["pattern"] = spec.Pattern.String()
+		}
+		properties[spec.Field] = property
+		if spec.Required {
+			required = append(required, spec.Field)
+		}
+	}
+
+	return gin.H{
+		"$schema":    "https://json-schema.org/draft/2020-12/schema",
+		"title":      "CustomerInput",
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
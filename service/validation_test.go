@@ -0,0 +1,92 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func createRouter(a *App) *gin.Engine {
+	r := gin.New()
+	r.POST("/customers", a.PostHandler)
+	return r
+}
+
+func TestNameWithAControlCharacterIsRejected(t *testing.T) {
+	r := createRouter(GetApp(nil))
+
+	w := request(r, http.MethodPost, "/customers", `{"name": "Ada\u0007 Lovelace", "email": "ada@example.com"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got %d, want 422: %s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "contains characters that are not allowed") {
+		t.Errorf("the error does not explain the rejection: %s", w.Body)
+	}
+}
+
+func TestNamePatternAllowsLettersMarksAndPunctuation(t *testing.T) {
+	for _, name := range []string{"Ada Lovelace", "Zoë O'Brien-Smith", "José Núñez", "Ng’ang’a", "渡辺"} {
+		if err := validateFields(&Customer{Name: name}); err != nil {
+			t.Errorf("%q: %v", name, err)
+		}
+	}
+	for _, name := range []string{"Ada\tLovelace", "Ada\x00", "Robert'); DROP TABLE", "R2D2"} {
+		if err := validateFields(&Customer{Name: name}); err == nil {
+			t.Errorf("%q was accepted", name)
+		}
+	}
+}
+
+// validationFailureCount reads a counter from the /metrics payload.
+func validationFailureCount(t *testing.T, r *gin.Engine, key string) float64 {
+	t.Helper()
+	var metrics struct {
+		Failures map[string]float64 `json:"validation_failures"`
+	}
+	if err := json.Unmarshal(request(r, http.MethodGet, "/metrics", "").Body.Bytes(), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	return metrics.Failures[key]
+}
+
+func TestValidationFailuresAreCountedOnMetrics(t *testing.T) {
+	a := GetApp(nil)
+	r := createRouter(a)
+	r.GET("/metrics", a.MetricsHandler)
+
+	before := validationFailureCount(t, r, "email.required")
+	if w := request(r, http.MethodPost, "/customers", `{"name": "Ada"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400: %s", w.Code, w.Body)
+	}
+	if after := validationFailureCount(t, r, "email.required"); after != before+1 {
+		t.Errorf("email.required went from %v to %v, want one more", before, after)
+	}
+}
+
+func TestFreeEmailIsCreatedWithAWarning(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	t.Setenv("WARNINGS_AS_ERRORS", "")
+
+	w := request(createRouter(a), http.MethodPost, "/customers", `{"name": "Ada", "email": "ada@gmail.com"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("got %d, want 201: %s", w.Code, w.Body)
+	}
+	var customer Customer
+	if err := json.Unmarshal(w.Body.Bytes(), &customer); err != nil {
+		t.Fatal(err)
+	}
+	if len(customer.Warnings) != 1 || customer.Warnings[0].Field != "email" || customer.Warnings[0].Code != codeFreeEmail {
+		t.Errorf("warnings %+v, want one free_email warning on email", customer.Warnings)
+	}
+}
+
+func TestFreeEmailIsRejectedWithWarningsAsErrors(t *testing.T) {
+	t.Setenv("WARNINGS_AS_ERRORS", "true")
+	w := request(createRouter(GetApp(nil)), http.MethodPost, "/customers", `{"name": "Ada", "email": "ada@gmail.com"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got %d, want 422: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"customer-service/db"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version and Commit are set at build time, e.g.
+// go build -ldflags "-X customer-service/service.Version=1.2.0 -X customer-service/service.Commit=$(git rev-parse HEAD)"
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+type versionInfo struct {
+	Version          string `json:"version"`
+	Commit           string `json:"commit"`
+	MigrationVersion int    `json:"migration_version"`
+}
+
+// buildCommit falls back to the VCS revision Go stamps into the binary.
+func buildCommit() string {
+	if len(Commit) != 0 {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+func getVersion(db *db.PostgresDB, c *gin.Context) (int, *versionInfo, error) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthTimeout)
+	defer cancel()
+
+	migration, err := db.MigrationVersion(ctx)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+
+	return http.StatusOK, &versionInfo{Version: Version, Commit: buildCommit(), MigrationVersion: migration}, nil
+}
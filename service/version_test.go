@@ -0,0 +1,36 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVersionReportsTheAppliedMigration(t *testing.T) {
+	pg := postgresDB(t)
+	r := gin.New()
+	r.GET("/version", GetApp(pg).VersionHandler)
+
+	w := request(r, http.MethodGet, "/version", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var info map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	migration, ok := info["migration_version"].(float64)
+	if !ok || migration < 1 {
+		t.Fatalf("migration_version is %v, want a positive number", info["migration_version"])
+	}
+	var applied int
+	pg.DB.Get(&applied, `SELECT MAX(version) FROM schema_migrations`)
+	if int(migration) != applied {
+		t.Errorf("migration_version %v, but migration %d is applied", migration, applied)
+	}
+	if info["version"] != Version {
+		t.Errorf("version %v, want %s", info["version"], Version)
+	}
+}
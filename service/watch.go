@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultWatchTimeout = 30 * time.Second
+	maxWatchTimeout     = 60 * time.Second
+)
+
+// watchCustomer blocks until the customer changes, the timeout elapses or
+// the client goes away. It returns the new state on change and 304 on
+// timeout.
+func (a *App) watchCustomer(c *gin.Context) (int, *Customer, error) {
+	id, err := paramID(c)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	p := struct {
+		Timeout time.Duration `form:"timeout"`
+	}{Timeout: defaultWatchTimeout}
+	if err := bindQuery(c, &p); err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	timeout := p.Timeout
+	if timeout <= 0 || timeout > maxWatchTimeout {
+		return http.StatusBadRequest, nil, fmt.Errorf("timeout must be between 0 and %s", maxWatchTimeout)
+	}
+
+	// Subscribe before the existence check so a change in between is not missed.
+	changed, cancel := a.changes.subscribe(id)
+	defer cancel()
+
+	if status, customer, err := getCustomer(a.db, c); err != nil {
+		return status, customer, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-changed:
+		return getCustomer(a.db, c)
+	case <-timer.C:
+		return http.StatusNotModified, nil, nil
+	case <-c.Request.Context().Done():
+		return 0, nil, c.Request.Context().Err()
+	}
+}
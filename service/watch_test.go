@@ -0,0 +1,84 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// awaitWatcher waits until someone is subscribed to changes of id.
+func awaitWatcher(t *testing.T, n *changeNotifier, id int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n.mu.Lock()
+		waiting := len(n.waiters[id])
+		n.mu.Unlock()
+		if waiting > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nobody is watching customer %d", id)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNotifyWakesOnlyTheChangedCustomersWatchers(t *testing.T) {
+	n := newChangeNotifier()
+	one, cancelOne := n.subscribe(1)
+	defer cancelOne()
+	two, cancelTwo := n.subscribe(2)
+
+	n.notify(1)
+	select {
+	case <-one:
+	default:
+		t.Error("the watcher of 1 was not woken")
+	}
+	select {
+	case <-two:
+		t.Error("the watcher of 2 was woken")
+	default:
+	}
+	cancelTwo()
+	if len(n.waiters) != 0 {
+		t.Errorf("waiters left behind: %v", n.waiters)
+	}
+}
+
+func TestUpdateUnblocksAWaitingWatcher(t *testing.T) {
+	a := GetApp(postgresDB(t))
+	r := gin.New()
+	r.GET("/customers/:customerId/watch", a.WatchHandler)
+	r.PUT("/customers/:customerId", a.SerializeCustomer, a.PutHandler)
+	id := seedCustomers(t, a, 1, "alice")[0]
+
+	watched := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		watched <- request(r, http.MethodGet, fmt.Sprintf("/customers/%d/watch?timeout=10s", id), "")
+	}()
+	awaitWatcher(t, a.changes, id)
+
+	if w := request(r, http.MethodPut, fmt.Sprintf("/customers/%d", id), `{"name": "Ada", "email": "ada@example.com"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT: %d %s", w.Code, w.Body)
+	}
+	select {
+	case w := <-watched:
+		var customer Customer
+		if err := json.Unmarshal(w.Body.Bytes(), &customer); err != nil || w.Code != http.StatusOK || customer.Name != "Ada" {
+			t.Errorf("the watcher got %d %s, want 200 with the update", w.Code, w.Body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the update did not unblock the watcher")
+	}
+
+	if w := request(r, http.MethodGet, fmt.Sprintf("/customers/%d/watch?timeout=10ms", id), ""); w.Code != http.StatusNotModified {
+		t.Errorf("an unchanged customer: got %d, want 304", w.Code)
+	}
+}